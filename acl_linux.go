@@ -0,0 +1,114 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// aclSupported reports whether --compare-acls can read ACLs on this platform
+const aclSupported = true
+
+// POSIX ACL extended attribute name and on-disk entry tags (see acl(5))
+const (
+	aclAccessXattr  = "system.posix_acl_access"
+	aclXattrVersion = 2
+	aclTagUserObj   = 0x01
+	aclTagUser      = 0x02
+	aclTagGroupObj  = 0x04
+	aclTagGroup     = 0x08
+	aclTagMask      = 0x10
+	aclTagOther     = 0x20
+)
+
+// readACL returns a file's access ACL in getfacl's short text form.
+// Files without an extended ACL get the minimal ACL implied by their permission bits.
+func readACL(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	access, err := readACLXattr(path, aclAccessXattr)
+	if err != nil {
+		return "", err
+	}
+	if access == nil {
+		perm := info.Mode().Perm()
+		access = []string{
+			"user::" + formatACLPerm(uint16(perm>>6)),
+			"group::" + formatACLPerm(uint16(perm>>3)),
+			"other::" + formatACLPerm(uint16(perm)),
+		}
+	}
+	return strings.Join(access, ","), nil
+}
+
+// readACLXattr reads and decodes one ACL attribute, returning nil when the file has none
+func readACLXattr(path, name string) ([]string, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err == syscall.ENODATA || err == syscall.ENOTSUP {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return decodeACL(buf[:size])
+}
+
+// decodeACL converts the kernel's binary ACL xattr format into text entries
+func decodeACL(data []byte) ([]string, error) {
+	if len(data) < 4 || binary.LittleEndian.Uint32(data) != aclXattrVersion {
+		return nil, fmt.Errorf("unrecognized ACL format")
+	}
+
+	var entries []string
+	for offset := 4; offset+8 <= len(data); offset += 8 {
+		tag := binary.LittleEndian.Uint16(data[offset:])
+		perm := formatACLPerm(binary.LittleEndian.Uint16(data[offset+2:]))
+		id := binary.LittleEndian.Uint32(data[offset+4:])
+
+		switch tag {
+		case aclTagUserObj:
+			entries = append(entries, "user::"+perm)
+		case aclTagUser:
+			entries = append(entries, fmt.Sprintf("user:%d:%s", id, perm))
+		case aclTagGroupObj:
+			entries = append(entries, "group::"+perm)
+		case aclTagGroup:
+			entries = append(entries, fmt.Sprintf("group:%d:%s", id, perm))
+		case aclTagMask:
+			entries = append(entries, "mask::"+perm)
+		case aclTagOther:
+			entries = append(entries, "other::"+perm)
+		default:
+			return nil, fmt.Errorf("unknown ACL tag 0x%x", tag)
+		}
+	}
+	return entries, nil
+}
+
+// formatACLPerm renders the low three permission bits as "rwx"
+func formatACLPerm(perm uint16) string {
+	bits := []byte("---")
+	if perm&4 != 0 {
+		bits[0] = 'r'
+	}
+	if perm&2 != 0 {
+		bits[1] = 'w'
+	}
+	if perm&1 != 0 {
+		bits[2] = 'x'
+	}
+	return string(bits)
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestDecodeACL tests decoding the kernel's binary POSIX ACL format
+func TestDecodeACL(t *testing.T) {
+	encode := func(entries [][3]uint32) []byte {
+		data := binary.LittleEndian.AppendUint32(nil, aclXattrVersion)
+		for _, entry := range entries {
+			data = binary.LittleEndian.AppendUint16(data, uint16(entry[0]))
+			data = binary.LittleEndian.AppendUint16(data, uint16(entry[1]))
+			data = binary.LittleEndian.AppendUint32(data, entry[2])
+		}
+		return data
+	}
+
+	data := encode([][3]uint32{
+		{aclTagUserObj, 6, 0},
+		{aclTagUser, 4, 1000},
+		{aclTagGroupObj, 4, 0},
+		{aclTagGroup, 5, 50},
+		{aclTagMask, 7, 0},
+		{aclTagOther, 0, 0},
+	})
+	entries, err := decodeACL(data)
+	if err != nil {
+		t.Fatalf("decodeACL failed: %v", err)
+	}
+
+	expected := []string{"user::rw-", "user:1000:r--", "group::r--", "group:50:r-x", "mask::rwx", "other::---"}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Entry %d: expected %s, got %s", i, expected[i], entries[i])
+		}
+	}
+
+	if _, err := decodeACL([]byte{1, 0, 0, 0}); err == nil {
+		t.Error("Expected error for unknown ACL version")
+	}
+}
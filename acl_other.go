@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// aclSupported reports whether --compare-acls can read ACLs on this platform
+const aclSupported = false
+
+// readACL is only implemented on Linux
+func readACL(path string) (string, error) {
+	return "", fmt.Errorf("reading ACLs is not supported on this platform")
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileIdentity is only implemented on Unix, where os.FileInfo carries the device and inode
+func fileIdentity(info os.FileInfo) string {
+	return ""
+}
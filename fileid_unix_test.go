@@ -0,0 +1,70 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckpointFollowsRenamedFiles tests that a resumed checkpoint reuses hashes of files moved since they were recorded
+func TestCheckpointFollowsRenamedFiles(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{"photos/2023/beach.jpg": "sand and sea"})
+	oldPath := filepath.Join(tmpDir, "photos", "2023", "beach.jpg")
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+
+	checkpoint, err := openCheckpoint(checkpointPath, false, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint failed: %v", err)
+	}
+	if _, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{Checkpoint: checkpoint}); err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	checkpoint.Close()
+
+	// Reorganize the tree; the file keeps its inode
+	newPath := filepath.Join(tmpDir, "archive", "beach.jpg")
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	info, err := os.Stat(newPath)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if fileIdentity(info) == "" {
+		t.Fatal("Expected a device:inode identity on Unix")
+	}
+
+	resumed, err := openCheckpoint(checkpointPath, true, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint failed: %v", err)
+	}
+	defer resumed.Close()
+	hash, ok := resumed.Lookup(newPath, info)
+	if !ok {
+		t.Fatal("Expected the moved file to be found by its identity")
+	}
+	expected, err := hashFile(newPath)
+	if err != nil {
+		t.Fatalf("hashFile failed: %v", err)
+	}
+	if hash != expected {
+		t.Errorf("Expected hash %s, got %s", expected, hash)
+	}
+
+	// Changing the content invalidates the identity entry too
+	if err := os.WriteFile(newPath, []byte("different size now"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	info, err = os.Stat(newPath)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if _, ok := resumed.Lookup(newPath, info); ok {
+		t.Error("Expected a modified file not to be found")
+	}
+}
@@ -2,10 +2,24 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5" // #nosec G501 - used only to match MD5 manifests, not for security
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 - used only to reproduce git blob IDs
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -14,23 +28,99 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// version is the tool version, overridable at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// Names the two sets go by in all output, overridable with --label1 and --label2
+var (
+	set1Label = "Set 1"
+	set2Label = "Set 2"
+)
+
+// setLabel returns the display name of the set at index 0 or 1
+func setLabel(index int) string {
+	if index == 0 {
+		return set1Label
+	}
+	return set2Label
+}
+
+// exitCodeMissingSet is returned when every directory of a set is missing, so nothing meaningful was compared
+const exitCodeMissingSet = 2
+
+// exitCodeDifferences is returned when a difference category selected with --fail-on is not empty
+const exitCodeDifferences = 3
+
+// exitCodePartial is returned when --deadline or an interrupt stopped the scan, so the results are incomplete
+const exitCodePartial = 4
+
+// Difference categories accepted by --fail-on
+const (
+	failOnModified = "modified"
+	failOnUnique1  = "unique1"
+	failOnUnique2  = "unique2"
+)
+
+// parseFailOn parses a comma-separated --fail-on list into the set of selected categories
+func parseFailOn(list string) (map[string]bool, error) {
+	categories := make(map[string]bool)
+	for _, category := range strings.Split(list, ",") {
+		category = strings.TrimSpace(category)
+		switch category {
+		case failOnModified, failOnUnique1, failOnUnique2:
+			categories[category] = true
+		default:
+			return nil, fmt.Errorf("unknown category %q (expected %s, %s or %s)", category, failOnModified, failOnUnique1, failOnUnique2)
+		}
+	}
+	return categories, nil
+}
+
+// failingCategories returns "<category> (<count>)" for every selected category that has differences
+func failingCategories(result *ComparisonResult, failOn map[string]bool) []string {
+	counts := []struct {
+		category string
+		count    int
+	}{
+		{failOnModified, len(result.SameNameDifferentHash)},
+		{failOnUnique1, len(result.UniqueToSet1)},
+		{failOnUnique2, len(result.UniqueToSet2)},
+	}
+
+	var failing []string
+	for _, entry := range counts {
+		if failOn[entry.category] && entry.count > 0 {
+			failing = append(failing, fmt.Sprintf("%s (%d)", entry.category, entry.count))
+		}
+	}
+	return failing
+}
+
 // FileInfo represents metadata about a file
 type FileInfo struct {
-	RelativePath string // Path relative to the root directory
-	AbsolutePath string // Full path
-	Name         string // Just the filename
-	Hash         string // SHA256 hash of contents
-	Size         int64  // File size
-	RootDir      string // Which root directory this file came from
+	RelativePath string    // Path relative to the root directory
+	AbsolutePath string    // Full path
+	Name         string    // Just the filename
+	Hash         string    // Hash of contents (SHA256 unless another --hash is chosen)
+	Size         int64     // File size
+	RootDir      string    // Which root directory this file came from
+	ModTime      time.Time // Last modification time
 }
 
 // FileSet represents a collection of files with lookup maps
 type FileSet struct {
-	Files   []*FileInfo
-	NameMap map[string][]*FileInfo // filename -> list of FileInfo
-	HashMap map[string][]*FileInfo // hash -> list of FileInfo
+	Files    []*FileInfo
+	NameMap  map[string][]*FileInfo // filename -> list of FileInfo
+	HashMap  map[string][]*FileInfo // hash -> list of FileInfo
+	Warnings []ScanWarning          // Problems encountered while scanning, such as skipped files
+
+	Roots        []string // Root directories that were scanned
+	MissingRoots []string // Root directories that did not exist
+	Partial      bool     // The scan was stopped before every file was hashed
 }
 
 // ComparisonResult holds the results of comparing two file sets
@@ -39,6 +129,9 @@ type ComparisonResult struct {
 	NameMappings          map[string][]*FileInfo // For same-name files, maps set2 file name to set1 files with same name
 	UniqueToSet2          []*FileInfo            // Files in set2 with no name or hash match in set1
 	UniqueToSet1          []*FileInfo            // Files in set1 with no name or hash match in set2
+	TimestampOnlyChanged  []*FileInfo            // Files in set2 whose content matches set1 at the same path but whose mod time differs
+	IgnoredByHash         []*FileInfo            // Files in either set left out of every category because their hash is blocklisted
+	IdenticalInSet1       []*FileInfo            // Files in set1 whose content also exists in set2
 }
 
 // TreeNode represents a node in the directory tree for output
@@ -51,6 +144,17 @@ type TreeNode struct {
 	IsEntireDir bool // True if this entire directory is missing
 }
 
+// RunMetadata describes the context of a comparison run so saved reports are self-describing
+type RunMetadata struct {
+	Title     string
+	Timestamp time.Time
+	Hostname  string
+	Version   string
+	Arguments []string // Exact command line arguments, excluding the program name
+	Set1Dirs  []string
+	Set2Dirs  []string
+}
+
 // SpeedSample represents a point-in-time measurement for speed calculation
 type SpeedSample struct {
 	Timestamp time.Time
@@ -59,8 +163,10 @@ type SpeedSample struct {
 
 // ProgressTracker tracks and displays progress during file processing
 type ProgressTracker struct {
-	totalFiles     int64
-	totalBytes     int64
+	totalFiles     int64 // atomic; grows while a streaming scan is still discovering files
+	totalBytes     int64 // atomic
+	discovering    int32 // atomic; non-zero until every file to process has been found
+	drawn          int32 // atomic; non-zero once a progress line has been displayed
 	processedFiles int64 // atomic
 	processedBytes int64 // atomic
 	startTime      time.Time
@@ -92,6 +198,21 @@ func (pt *ProgressTracker) UpdateProgress(files int64, bytes int64) {
 	atomic.AddInt64(&pt.processedBytes, bytes)
 }
 
+// AddTotals grows the totals as a streaming scan discovers more files
+func (pt *ProgressTracker) AddTotals(files int64, bytes int64) {
+	atomic.AddInt64(&pt.totalFiles, files)
+	atomic.AddInt64(&pt.totalBytes, bytes)
+}
+
+// SetDiscovering marks whether files are still being discovered, so the totals shown aren't final yet
+func (pt *ProgressTracker) SetDiscovering(discovering bool) {
+	var value int32
+	if discovering {
+		value = 1
+	}
+	atomic.StoreInt32(&pt.discovering, value)
+}
+
 // GetStats returns current progress statistics
 func (pt *ProgressTracker) GetStats() (filesProcessed, bytesProcessed int64, speedMBps float64) {
 	filesProcessed = atomic.LoadInt64(&pt.processedFiles)
@@ -130,19 +251,30 @@ func (pt *ProgressTracker) GetStats() (filesProcessed, bytesProcessed int64, spe
 // DisplayProgress shows the current progress line
 func (pt *ProgressTracker) DisplayProgress(prefix string) {
 	filesProcessed, bytesProcessed, speedMBps := pt.GetStats()
+	totalFiles := atomic.LoadInt64(&pt.totalFiles)
+	totalBytes := atomic.LoadInt64(&pt.totalBytes)
+	if totalFiles == 0 {
+		return // A streaming scan hasn't found anything yet
+	}
+	filePercent := float64(filesProcessed) / float64(totalFiles) * 100
+	bytePercent := float64(bytesProcessed) / float64(totalBytes) * 100
 
-	filePercent := float64(filesProcessed) / float64(pt.totalFiles) * 100
-	bytePercent := float64(bytesProcessed) / float64(pt.totalBytes) * 100
+	// While the walk is still running, the totals are only what has been found so far
+	more := ""
+	if atomic.LoadInt32(&pt.discovering) != 0 {
+		more = "+"
+	}
 
 	speedText := "calculating..."
 	if speedMBps > 0 {
 		speedText = fmt.Sprintf("%.1f MB/s", speedMBps)
 	}
 
-	fmt.Printf("\r%s Files: %d/%d (%.0f%%) | Size: %s/%s (%.0f%%) | Speed: %s",
+	atomic.StoreInt32(&pt.drawn, 1)
+	fmt.Printf("\r%s Files: %d/%d%s (%.0f%%) | Size: %s/%s%s (%.0f%%) | Speed: %s",
 		prefix,
-		filesProcessed, pt.totalFiles, filePercent,
-		formatSize(bytesProcessed), formatSize(pt.totalBytes), bytePercent,
+		filesProcessed, totalFiles, more, filePercent,
+		formatSize(bytesProcessed), formatSize(totalBytes), more, bytePercent,
 		speedText)
 }
 
@@ -151,8 +283,199 @@ func (pt *ProgressTracker) ClearLine() {
 	fmt.Print("\r" + strings.Repeat(" ", 100) + "\r")
 }
 
+// ClearDrawnLine clears the progress line only if one was displayed, so quick scans leave no blank padding behind
+func (pt *ProgressTracker) ClearDrawnLine() {
+	if atomic.LoadInt32(&pt.drawn) != 0 {
+		pt.ClearLine()
+	}
+}
+
 // hashFile calculates SHA256 hash of a file
 func hashFile(filePath string) (string, error) {
+	return hashFileBuffered(filePath, HashSHA256, nil)
+}
+
+// Supported values for --hash
+const (
+	HashSHA256 = "sha256"
+	HashGit    = "git" // Git blob ID: SHA-1 over "blob <size>\0<content>"
+	HashMD5    = "md5" // For comparing against MD5 manifests from other tools
+)
+
+// isSupportedHashAlgorithm reports whether a --hash value is known
+func isSupportedHashAlgorithm(algorithm string) bool {
+	return algorithm == HashSHA256 || algorithm == HashGit || algorithm == HashMD5
+}
+
+// hashFileWithAlgorithm calculates a file's hash with the given algorithm (SHA256 when empty)
+func hashFileWithAlgorithm(filePath string, algorithm string) (string, error) {
+	return hashFileBuffered(filePath, algorithm, nil)
+}
+
+// maxHashBufferSize caps --buffer-size, since every worker allocates its own buffer
+const maxHashBufferSize = 256 * 1024 * 1024
+
+// newHashBuffer allocates a read buffer for hashing, or returns nil to use io.CopyBuffer's 32KB default
+func newHashBuffer(size int) []byte {
+	if size <= 0 {
+		return nil
+	}
+	return make([]byte, size)
+}
+
+// hashFileBuffered calculates a file's hash, reading through buf so callers can reuse one buffer across files
+func hashFileBuffered(filePath string, algorithm string, buf []byte) (string, error) {
+	return hashFileContent(filePath, ScanOptions{HashAlgorithm: algorithm}, buf)
+}
+
+// hashMode identifies how hashes are computed under opts. Hashes are only comparable when their modes match,
+// so checkpoints and manifests record the mode rather than just the algorithm.
+func hashMode(opts ScanOptions) string {
+	mode := opts.HashAlgorithm
+	if mode == "" {
+		mode = HashSHA256
+	}
+	if opts.IgnoreTrailingNulls {
+		mode += "+" + hashModeIgnoreTrailingNulls
+	}
+	if opts.IgnoreBOM {
+		mode += "+" + hashModeIgnoreBOM
+	}
+	if opts.HashSkipBytes > 0 {
+		mode += fmt.Sprintf("+%s=%d", hashModeSkipBytes, opts.HashSkipBytes)
+	}
+	if opts.HashLimitBytes > 0 {
+		mode += fmt.Sprintf("+%s=%d", hashModeLimitBytes, opts.HashLimitBytes)
+	}
+	return mode
+}
+
+// Suffixes hashMode adds for --ignore-trailing-nulls, --ignore-bom, --hash-skip-bytes and --hash-limit-bytes
+const (
+	hashModeIgnoreTrailingNulls = "ignore-trailing-nulls"
+	hashModeIgnoreBOM           = "ignore-bom"
+	hashModeSkipBytes           = "skip-bytes"
+	hashModeLimitBytes          = "limit-bytes"
+)
+
+// applyHashMode sets the hashing options of opts from a hashMode string, e.g. "sha256+ignore-trailing-nulls"
+func applyHashMode(opts *ScanOptions, mode string) error {
+	parts := strings.Split(mode, "+")
+	if !isSupportedHashAlgorithm(parts[0]) {
+		return fmt.Errorf("unsupported hash algorithm %q", parts[0])
+	}
+	opts.HashAlgorithm = parts[0]
+	opts.IgnoreTrailingNulls = false
+	opts.IgnoreBOM = false
+	opts.HashSkipBytes, opts.HashLimitBytes = 0, 0
+	for _, option := range parts[1:] {
+		name, value, hasValue := strings.Cut(option, "=")
+		if hasValue {
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || count <= 0 {
+				return fmt.Errorf("invalid hashing option %q", option)
+			}
+			switch name {
+			case hashModeSkipBytes:
+				opts.HashSkipBytes = count
+				continue
+			case hashModeLimitBytes:
+				opts.HashLimitBytes = count
+				continue
+			}
+		}
+
+		switch option {
+		case hashModeIgnoreTrailingNulls:
+			opts.IgnoreTrailingNulls = true
+		case hashModeIgnoreBOM:
+			opts.IgnoreBOM = true
+		default:
+			return fmt.Errorf("unsupported hashing option %q", option)
+		}
+	}
+	return nil
+}
+
+// trailingNullScanSize is how much of a file's end is read at a time when looking for trailing null bytes
+const trailingNullScanSize = 64 * 1024
+
+// lengthWithoutTrailingNulls returns the length of a file's content once trailing null bytes are dropped.
+// It reads backwards from the end, so only the padding and one block of real content are read.
+func lengthWithoutTrailingNulls(file *os.File, size int64) (int64, error) {
+	block := make([]byte, trailingNullScanSize)
+	for end := size; end > 0; {
+		start := end - int64(len(block))
+		if start < 0 {
+			start = 0
+		}
+		chunk := block[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// bomTextExtensions are extensions of text files whose byte-order mark --ignore-bom strips. Other files keep
+// their leading bytes, since binary formats can start with the same bytes as a mark.
+var bomTextExtensions = map[string]bool{
+	".txt": true, ".md": true, ".csv": true, ".tsv": true, ".log": true, ".ini": true, ".cfg": true, ".conf": true,
+	".json": true, ".xml": true, ".yaml": true, ".yml": true, ".html": true, ".htm": true, ".css": true, ".js": true,
+	".ts": true, ".sql": true, ".srt": true, ".vtt": true, ".rtf": true, ".tex": true, ".bat": true, ".cmd": true,
+	".ps1": true, ".sh": true, ".py": true, ".go": true, ".java": true, ".c": true, ".h": true, ".cpp": true,
+	".cs": true, ".vb": true, ".php": true, ".rb": true,
+}
+
+// bomEligible reports whether --ignore-bom applies to a file, i.e. whether its extension marks it as text
+func bomEligible(name string) bool {
+	return bomTextExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// detectBOM names the UTF-8 or UTF-16 byte-order mark a file starts with and returns its length in bytes,
+// or "" and 0 when there is none
+func detectBOM(file io.ReaderAt) (string, int64, error) {
+	prefix := make([]byte, 3)
+	n, err := file.ReadAt(prefix, 0)
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	prefix = prefix[:n]
+
+	switch {
+	case bytes.HasPrefix(prefix, []byte{0xEF, 0xBB, 0xBF}):
+		return "UTF-8", 3, nil
+	case bytes.HasPrefix(prefix, []byte{0xFF, 0xFE}):
+		return "UTF-16LE", 2, nil
+	case bytes.HasPrefix(prefix, []byte{0xFE, 0xFF}):
+		return "UTF-16BE", 2, nil
+	}
+	return "", 0, nil
+}
+
+// hashFileContent calculates a file's hash with the algorithm and content rules of opts, reading through buf
+func hashFileContent(filePath string, opts ScanOptions, buf []byte) (string, error) {
+	algorithm := opts.HashAlgorithm
+	var hasher hash.Hash
+	switch algorithm {
+	case "", HashSHA256:
+		hasher = sha256.New()
+	case HashGit:
+		// #nosec G401 - SHA-1 is required to reproduce git object IDs, not for security
+		hasher = sha1.New()
+	case HashMD5:
+		// #nosec G401 - MD5 is only used to match existing MD5 manifests, not for security
+		hasher = md5.New()
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm %q", algorithm)
+	}
+
 	// #nosec G304 - filePath is intentionally user-provided for file comparison tool
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -160,12 +483,256 @@ func hashFile(filePath string) (string, error) {
 	}
 	defer file.Close()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	length := info.Size()
+	if opts.IgnoreTrailingNulls {
+		// Padding to a block boundary shouldn't make otherwise identical files differ
+		if length, err = lengthWithoutTrailingNulls(file, length); err != nil {
+			return "", err
+		}
+	}
+	var start int64
+	if opts.IgnoreBOM && bomEligible(info.Name()) {
+		// A BOM added or dropped by an editor shouldn't make otherwise identical text files differ
+		if _, start, err = detectBOM(file); err != nil {
+			return "", err
+		}
+	}
+
+	// Only compare a region of each file, e.g. to leave out a header with an embedded timestamp
+	start = min(start+opts.HashSkipBytes, length)
+	if opts.HashLimitBytes > 0 {
+		length = min(length, start+opts.HashLimitBytes)
+	}
+
+	if algorithm == HashGit {
+		fmt.Fprintf(hasher, "blob %d\x00", length-start)
+	}
+
+	// Hide *os.File's WriteTo so io.CopyBuffer reads through buf instead of allocating its own
+	var reader io.Reader = io.NewSectionReader(file, start, length-start)
+	if opts.Context != nil {
+		reader = contextReader{ctx: opts.Context, reader: reader}
+	}
+	if _, err := io.CopyBuffer(hasher, struct{ io.Reader }{reader}, buf); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// defaultCheckpointPath is used by --resume when no --checkpoint file is given
+const defaultCheckpointPath = ".dir-compare-checkpoint"
+
+// checkpointEntry is a previously computed hash together with the file state it was computed for
+type checkpointEntry struct {
+	Hash     string
+	Size     int64
+	ModTime  int64  // Unix nanoseconds
+	Identity string // fileIdentity of the file, or "" where the platform has none
+}
+
+// matches reports whether the entry was recorded for a file in the state described by info
+func (e checkpointEntry) matches(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+// checkpointNoIdentity stands in for an empty identity in checkpoint lines
+const checkpointNoIdentity = "-"
+
+// Checkpoint persists every hashed file so an interrupted scan can resume without rehashing
+type Checkpoint struct {
+	mu         sync.Mutex
+	path       string // Absolute path of the checkpoint file, which scans leave out
+	file       *os.File
+	writer     *bufio.Writer              // Buffers recorded lines so workers don't wait on a write each; flushed by Close
+	err        error                      // First error writing the file; recording stops after it
+	algorithm  string                     // Hash algorithm of the entries; entries for other algorithms are ignored
+	entries    map[string]checkpointEntry // absolute path -> entry
+	identities map[string]checkpointEntry // device:inode -> entry, so renamed or moved files are still found
+}
+
+// openCheckpoint opens a checkpoint file for recording, loading its existing entries when resuming
+func openCheckpoint(path string, resume bool, algorithm string) (*Checkpoint, error) {
+	if algorithm == "" {
+		algorithm = HashSHA256
+	}
+	checkpoint := &Checkpoint{algorithm: algorithm, entries: make(map[string]checkpointEntry), identities: make(map[string]checkpointEntry)}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		if err := checkpoint.load(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	// #nosec G304 - the checkpoint path is intentionally user-provided
+	file, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.file = file
+	checkpoint.writer = bufio.NewWriter(file)
+	if checkpoint.path, err = filepath.Abs(path); err != nil {
+		checkpoint.path = path
+	}
+	return checkpoint, nil
+}
+
+// isCheckpointFile reports whether a file found while scanning is a checkpoint: the default one, which a run
+// over "." would otherwise hash, or the one being written
+func isCheckpointFile(path string, info os.FileInfo, opts ScanOptions) bool {
+	if info.Name() == defaultCheckpointPath {
+		return true
+	}
+	if opts.Checkpoint == nil || info.Name() != filepath.Base(opts.Checkpoint.path) {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	return err == nil && absPath == opts.Checkpoint.path
+}
+
+// load reads "<algorithm>\t<hash>\t<size>\t<mtime>\t<identity>\t<path>" lines, ignoring any that are malformed
+// (e.g. cut off by a crash) or were recorded with a different hash algorithm. Lines from older versions
+// have no identity field; their fifth field is the absolute path itself.
+func (c *Checkpoint) load(path string) error {
+	// #nosec G304 - the checkpoint path is intentionally user-provided
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(fields) != 5 || fields[0] != c.algorithm {
+			continue
+		}
+		size, sizeErr := strconv.ParseInt(fields[2], 10, 64)
+		modTime, modErr := strconv.ParseInt(fields[3], 10, 64)
+		if sizeErr != nil || modErr != nil {
+			continue
+		}
+
+		entry := checkpointEntry{Hash: fields[1], Size: size, ModTime: modTime}
+		path := fields[4]
+		if identity, rest, ok := strings.Cut(fields[4], "\t"); ok && !filepath.IsAbs(identity) {
+			path = rest
+			if identity != checkpointNoIdentity {
+				entry.Identity = identity
+				c.identities[identity] = entry
+			}
+		}
+		c.entries[path] = entry
+	}
+	return scanner.Err()
+}
+
+// Len returns the number of files already recorded in the checkpoint
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Lookup returns the recorded hash for a file if it has not changed since it was recorded
+func (c *Checkpoint) Lookup(path string, info os.FileInfo) (string, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, exists := c.entries[absPath]; exists && entry.matches(info) {
+		return entry.Hash, true
+	}
+
+	// A file renamed or moved since it was recorded keeps its device and inode
+	if identity := fileIdentity(info); identity != "" {
+		if entry, exists := c.identities[identity]; exists && entry.matches(info) {
+			return entry.Hash, true
+		}
+	}
+	return "", false
+}
+
+// Record appends a freshly computed hash to the checkpoint file. After the first write error, which it
+// returns, nothing more is written; the error is reported again by Close.
+func (c *Checkpoint) Record(path string, info os.FileInfo, hash string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	entry := checkpointEntry{Hash: hash, Size: info.Size(), ModTime: info.ModTime().UnixNano(), Identity: fileIdentity(info)}
+	identity := checkpointNoIdentity
+	if entry.Identity != "" {
+		identity = entry.Identity
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[absPath] = entry
+	if entry.Identity != "" {
+		c.identities[entry.Identity] = entry
+	}
+	if c.err != nil || c.file == nil {
+		return nil
+	}
+	if _, err = fmt.Fprintf(c.writer, "%s\t%s\t%d\t%d\t%s\t%s\n", c.algorithm, entry.Hash, entry.Size, entry.ModTime, identity, absPath); err != nil {
+		c.err = err
+	}
+	return err
+}
+
+// Close flushes and closes the checkpoint file, returning the first error writing it. Closing twice is harmless.
+func (c *Checkpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return c.err
+	}
+	if err := c.writer.Flush(); err != nil && c.err == nil {
+		c.err = err
+	}
+	if err := c.file.Close(); err != nil && c.err == nil {
+		c.err = err
+	}
+	c.file = nil
+	return c.err
+}
+
+// hashTask hashes a task's file through buf, reusing and recording checkpoint entries when a checkpoint is active
+func hashTask(task FileTask, opts ScanOptions, buf []byte) (string, error) {
+	if scanStopped(opts) {
+		return "", errScanStopped
+	}
+	if task.SkipHash || (opts.SkipHash != nil && opts.SkipHash(task)) {
+		return fmt.Sprintf("%s%d:%s", unhashedPrefix, task.Info.Size(), task.Path), nil
+	}
+
+	if opts.Checkpoint != nil {
+		if hash, ok := opts.Checkpoint.Lookup(task.Path, task.Info); ok {
+			return hash, nil
+		}
+	}
+
+	hash, err := hashFileContent(task.Path, opts, buf)
+	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	if opts.Checkpoint != nil {
+		// The hash is good even if it can't be saved (e.g. a full disk); Close reports the failure once
+		_ = opts.Checkpoint.Record(task.Path, task.Info, hash)
+	}
+	return hash, nil
 }
 
 // FileJob represents a batch of files to be hashed
@@ -175,10 +742,74 @@ type FileJob struct {
 
 // FileTask represents a single file to be hashed
 type FileTask struct {
-	Path    string
-	Info    os.FileInfo
-	RootDir string
-	RelPath string
+	Path     string
+	Info     os.FileInfo
+	RootDir  string
+	RelPath  string
+	SkipHash bool // Content can't match anything in the other set, so a size placeholder stands in for the hash
+}
+
+// unhashedPrefix starts the placeholder hash of files whose hashing was skipped because of a sizeIndex
+const unhashedPrefix = "unhashed-size:"
+
+// sizeIndex records the file names and file sizes present in a set. A file of the other set that shares a
+// name with one here but has a size no file here has is certainly modified and can't match any content, so
+// hashing it is wasted work; it gets a placeholder hash, unique to the file, that can never equal any other hash.
+type sizeIndex struct {
+	names map[string][]*FileInfo // The indexed set's NameMap, shared rather than copied
+	sizes map[int64]bool
+}
+
+// indexSetSizes indexes the names and sizes of a set that has already been scanned, so the index costs
+// no extra walk and only a map of the distinct sizes on top of the set itself
+func indexSetSizes(fileSet *FileSet) *sizeIndex {
+	index := &sizeIndex{names: fileSet.NameMap, sizes: make(map[int64]bool)}
+	for _, file := range fileSet.Files {
+		index.sizes[file.Size] = true
+	}
+	return index
+}
+
+// rulesOut reports whether a task from the other set shares a name with a file of this set but has a size
+// no file of this set has, so it is certainly modified and its content can't match anything here
+func (idx *sizeIndex) rulesOut(task FileTask) bool {
+	_, sameName := idx.names[task.Info.Name()]
+	return sameName && !idx.sizes[task.Info.Size()]
+}
+
+// skipSizeMismatches returns a ScanOptions.SkipHash that skips files ruled out by the other set's index,
+// counting them in skipped
+func skipSizeMismatches(other *sizeIndex, skipped *int64) func(FileTask) bool {
+	return func(task FileTask) bool {
+		if other.rulesOut(task) {
+			atomic.AddInt64(skipped, 1)
+			return true
+		}
+		return false
+	}
+}
+
+// hashSkippedDuplicates gives a real hash to the files of a set that kept a size placeholder but share their
+// size with another file of the same set. Their size rules out a match in the other set, not a copy within
+// their own, and content totals must count such copies once. Files that can't be hashed keep the placeholder.
+func hashSkippedDuplicates(fileSet *FileSet, opts ScanOptions) {
+	sizes := make(map[int64]int)
+	for _, file := range fileSet.Files {
+		sizes[file.Size]++
+	}
+
+	for _, file := range fileSet.Files {
+		if !strings.HasPrefix(file.Hash, unhashedPrefix) || sizes[file.Size] < 2 {
+			continue
+		}
+		hash, err := hashFileContent(file.AbsolutePath, opts, nil)
+		if err != nil {
+			continue
+		}
+		delete(fileSet.HashMap, file.Hash)
+		file.Hash = hash
+		fileSet.HashMap[hash] = append(fileSet.HashMap[hash], file)
+	}
 }
 
 // FileResult represents the result of hashing a batch of files
@@ -188,9 +819,12 @@ type FileResult struct {
 }
 
 // hashWorker processes batches of files from the job channel
-func hashWorker(jobs <-chan FileJob, results chan<- FileResult, progress chan<- ProgressUpdate, wg *sync.WaitGroup) {
+func hashWorker(jobs <-chan FileJob, results chan<- FileResult, progress chan<- ProgressUpdate, wg *sync.WaitGroup, opts ScanOptions) {
 	defer wg.Done()
 
+	// One read buffer per worker, reused for every file it hashes
+	buf := newHashBuffer(opts.BufferSize)
+
 	for job := range jobs {
 		batch := FileResult{
 			FileInfos: make([]*FileInfo, 0, len(job.Files)),
@@ -201,10 +835,12 @@ func hashWorker(jobs <-chan FileJob, results chan<- FileResult, progress chan<-
 		var batchBytes int64 = 0
 
 		for _, task := range job.Files {
-			hash, err := hashFile(task.Path)
+			hash, err := hashTask(task, opts, buf)
+			if errors.Is(err, errScanStopped) {
+				continue // Left out of the partial results rather than reported as a failure
+			}
 			if err != nil {
-				batch.Errors = append(batch.Errors,
-					fmt.Errorf("could not hash file %s: %v", task.Path, err))
+				batch.Errors = append(batch.Errors, &hashFailure{path: task.Path, err: err})
 				continue
 			}
 
@@ -215,6 +851,7 @@ func hashWorker(jobs <-chan FileJob, results chan<- FileResult, progress chan<-
 				Hash:         hash,
 				Size:         task.Info.Size(),
 				RootDir:      task.RootDir,
+				ModTime:      task.Info.ModTime(),
 			}
 
 			batch.FileInfos = append(batch.FileInfos, fileInfo)
@@ -235,980 +872,5708 @@ func hashWorker(jobs <-chan FileJob, results chan<- FileResult, progress chan<-
 	}
 }
 
-// walkDirectories recursively walks through directories and builds a FileSet
-func walkDirectories(dirs []string) (*FileSet, error) {
-	return walkDirectoriesWithLimit(dirs, -1)
+// ScanOptions controls which files are collected while walking a directory set
+type ScanOptions struct {
+	Filter              FilterNode          // Optional predicate a file must satisfy to be compared
+	QuietWarnings       bool                // Record warnings without printing them as they occur
+	OnWarning           func(ScanWarning)   // Optional: receives each warning instead of it being printed, on the goroutine that started the scan
+	BaseDir             string              // Directory that relative set directories are resolved against
+	Checkpoint          *Checkpoint         // Optional record of hashed files used to resume interrupted scans
+	HashAlgorithm       string              // Content hash to compute (HashSHA256 when empty)
+	BufferSize          int                 // Read buffer size for hashing; 0 uses io.CopyBuffer's 32KB default
+	HideProgress        bool                // Don't draw the progress line, e.g. while another scan is drawing its own
+	IgnoreTrailingNulls bool                // Hash files as if trailing null bytes (block padding) weren't there
+	IgnoreBOM           bool                // Hash text files as if a leading UTF-8/UTF-16 byte-order mark weren't there
+	HashSkipBytes       int64               // Leave this many leading bytes (after any BOM) out of the hash
+	HashLimitBytes      int64               // Hash at most this many bytes after the skipped ones; 0 hashes to the end
+	SkipHash            func(FileTask) bool // Optional: files for which a size placeholder stands in for the hash
+	StableSample        bool                // With a limit, pick the files by a hash of their relative path instead of walk order
+	Context             context.Context     // Optional: canceling it stops the scan, leaving a partial FileSet
 }
 
-// walkDirectoriesWithLimit recursively walks through directories and builds a FileSet with optional file limit
-func walkDirectoriesWithLimit(dirs []string, limit int) (*FileSet, error) {
-	// First, collect all files to determine if parallelization is worthwhile
-	var allTasks []FileTask
-	taskCount := 0
-	var totalSize int64
-
-	for _, dir := range dirs {
-		// Check if directory exists
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			fmt.Printf("Warning: Directory %s does not exist, skipping...\n", dir)
-			continue
-		}
-
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				fmt.Printf("Warning: Error accessing %s: %v\n", path, err)
-				return nil // Continue walking
-			}
+// errScanStopped is returned for files that weren't hashed because the scan's context was canceled
+var errScanStopped = errors.New("scan stopped")
 
-			if info.IsDir() {
-				return nil
-			}
+// scanStopped reports whether the scan's context has been canceled, by --deadline or an interrupt
+func scanStopped(opts ScanOptions) bool {
+	return opts.Context != nil && opts.Context.Err() != nil
+}
 
-			// Check limit before adding to tasks
-			if limit > 0 && taskCount >= limit {
-				return filepath.SkipAll
-			}
-			taskCount++
+// contextReader fails reads once its context is canceled, so a stopped scan doesn't finish reading a huge file
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
 
-			relPath, err := filepath.Rel(dir, path)
-			if err != nil {
-				relPath = path
-			}
+// Read implements io.Reader
+func (r contextReader) Read(p []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, errScanStopped
+	}
+	return r.reader.Read(p)
+}
 
-			task := FileTask{
-				Path:    path,
-				Info:    info,
-				RootDir: dir,
-				RelPath: relPath,
-			}
+// resolveAgainstBase joins relative directories onto the base directory, leaving absolute ones untouched
+func resolveAgainstBase(dirs []string, baseDir string) []string {
+	if baseDir == "" {
+		return dirs
+	}
 
-			allTasks = append(allTasks, task)
-			totalSize += info.Size()
-			return nil
-		})
-		if err != nil {
-			return nil, fmt.Errorf("error walking directory %s: %v", dir, err)
+	resolved := make([]string, len(dirs))
+	for i, dir := range dirs {
+		if filepath.IsAbs(dir) {
+			resolved[i] = dir
+		} else {
+			resolved[i] = filepath.Join(baseDir, dir)
 		}
 	}
+	return resolved
+}
 
-	// Determine if we should use parallel processing
-	// Only parallelize if we have enough work to justify the overhead
-	const minFilesForParallelization = 20
-	if len(allTasks) < minFilesForParallelization {
-		// Process sequentially for small workloads
-		return processFilesSequentially(allTasks, totalSize)
-	}
+// WarningReason classifies a ScanWarning
+type WarningReason string
+
+// Reasons a ScanWarning can have
+const (
+	WarningPermissionDenied WarningReason = "permission-denied" // A file or directory couldn't be read for lack of permission
+	WarningNotRegular       WarningReason = "not-regular"       // A named pipe, socket or device was skipped
+	WarningReadError        WarningReason = "read-error"        // Any other failure to list or read a file or directory
+	WarningMissingRoot      WarningReason = "missing-root"      // A root directory doesn't exist
+	WarningSkippedRoot      WarningReason = "skipped-root"      // A root was skipped as a duplicate, as nested in another or as remote
+)
 
-	return processFilesInParallel(allTasks, totalSize)
+// ScanWarning is a problem that didn't stop the scan, such as a file that had to be skipped
+type ScanWarning struct {
+	Reason  WarningReason
+	Path    string // File or directory concerned
+	Err     error  // Underlying error, when there is one
+	Message string // Description as the command line prints it
 }
 
-// processFilesSequentially handles small workloads without goroutine overhead
-func processFilesSequentially(tasks []FileTask, totalSize int64) (*FileSet, error) {
-	fileSet := &FileSet{
-		Files:   make([]*FileInfo, 0, len(tasks)),
-		NameMap: make(map[string][]*FileInfo),
-		HashMap: make(map[string][]*FileInfo),
+// String returns the warning's message
+func (w ScanWarning) String() string {
+	return w.Message
+}
+
+// readWarning builds the warning for a failed read, telling permission problems apart from other errors
+func readWarning(path string, err error, message string) ScanWarning {
+	reason := WarningReadError
+	if errors.Is(err, fs.ErrPermission) {
+		reason = WarningPermissionDenied
 	}
+	return ScanWarning{Reason: reason, Path: path, Err: err, Message: message}
+}
 
-	// For small workloads, don't show progress tracking
-	for _, task := range tasks {
-		hash, err := hashFile(task.Path)
-		if err != nil {
-			fmt.Printf("Warning: Could not hash file %s: %v\n", task.Path, err)
-			continue
-		}
+// hashFailure is the error a hashing worker reports for a file it couldn't hash
+type hashFailure struct {
+	path string
+	err  error
+}
 
-		fileInfo := &FileInfo{
-			RelativePath: task.RelPath,
-			AbsolutePath: task.Path,
-			Name:         task.Info.Name(),
-			Hash:         hash,
-			Size:         task.Info.Size(),
-			RootDir:      task.RootDir,
-		}
+// Error implements error
+func (f *hashFailure) Error() string {
+	return fmt.Sprintf("could not hash file %s: %v", f.path, f.err)
+}
 
-		fileSet.Files = append(fileSet.Files, fileInfo)
-		fileSet.NameMap[fileInfo.Name] = append(fileSet.NameMap[fileInfo.Name], fileInfo)
-		fileSet.HashMap[fileInfo.Hash] = append(fileSet.HashMap[fileInfo.Hash], fileInfo)
-	}
+// Unwrap returns the underlying error
+func (f *hashFailure) Unwrap() error {
+	return f.err
+}
 
-	return fileSet, nil
+// recordWarning appends a warning to the list and reports it
+func recordWarning(warnings *[]ScanWarning, opts ScanOptions, warning ScanWarning) {
+	*warnings = append(*warnings, warning)
+	reportWarning(opts, warning)
 }
 
-// processFilesInParallel handles large workloads with optimal parallelization
-func processFilesInParallel(tasks []FileTask, totalSize int64) (*FileSet, error) {
-	// Use 75% of CPU cores as requested
-	numWorkers := int(float64(runtime.NumCPU()) * 0.75)
-	if numWorkers < 1 {
-		numWorkers = 1
+// reportWarning hands a warning to opts.OnWarning, or prints it unless warnings are suppressed
+func reportWarning(opts ScanOptions, warning ScanWarning) {
+	if opts.OnWarning != nil {
+		opts.OnWarning(warning)
+		return
 	}
-
-	// Calculate optimal batch size based on total work and number of workers
-	// Aim for at least 10 files per batch to justify goroutine overhead
-	const minBatchSize = 10
-	batchSize := len(tasks) / (numWorkers * 2) // Aim for 2 batches per worker
-	if batchSize < minBatchSize {
-		batchSize = minBatchSize
+	if !opts.QuietWarnings {
+		fmt.Printf("Warning: %s\n", warning)
 	}
+}
 
-	// Create work batches
-	var jobs []FileJob
-	for i := 0; i < len(tasks); i += batchSize {
-		end := i + batchSize
-		if end > len(tasks) {
-			end = len(tasks)
-		}
-		jobs = append(jobs, FileJob{Files: tasks[i:end]})
-	}
+// walkDirectories recursively walks through directories and builds a FileSet
+func walkDirectories(dirs []string) (*FileSet, error) {
+	return walkDirectoriesWithLimit(dirs, -1)
+}
 
-	// Create progress tracker
-	progressTracker := NewProgressTracker(int64(len(tasks)), totalSize)
+// walkDirectoriesWithLimit recursively walks through directories and builds a FileSet with optional file limit
+func walkDirectoriesWithLimit(dirs []string, limit int) (*FileSet, error) {
+	return walkDirectoriesWithOptions(dirs, limit, ScanOptions{})
+}
 
-	// Create channels with appropriate buffer sizes
-	jobChannel := make(chan FileJob, len(jobs))
-	resultChannel := make(chan FileResult, len(jobs))
-	progressChannel := make(chan ProgressUpdate, numWorkers*10) // Buffer for progress updates
+// walkDirectoriesWithOptions recursively walks through directories and builds a FileSet using the given scan options
+func walkDirectoriesWithOptions(dirs []string, limit int, opts ScanOptions) (*FileSet, error) {
+	// Remote roots are listed and hashed on the remote host, so only local roots go through the task pipeline
+	localDirs, remoteDirs := splitRemoteRoots(dirs)
 
-	// Start progress display goroutine
-	progressDone := make(chan struct{})
-	go func() {
-		ticker := time.NewTicker(200 * time.Millisecond) // Update 5 times per second
-		defer ticker.Stop()
+	fileSet, err := streamFilesInParallel(localDirs, limit, opts)
+	if err != nil {
+		return nil, err
+	}
 
-		for {
-			select {
-			case update, ok := <-progressChannel:
-				if !ok {
-					return // Channel closed, we're done
-				}
-				progressTracker.UpdateProgress(update.FilesProcessed, update.BytesProcessed)
-			case <-ticker.C:
-				progressTracker.DisplayProgress("🔍 Analyzing files... ")
-			case <-progressDone:
-				return
-			}
+	for _, root := range remoteDirs {
+		if scanStopped(opts) {
+			fileSet.Partial = true
+			break
 		}
-	}()
-
-	// Start workers
-	var wg sync.WaitGroup
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go hashWorker(jobChannel, resultChannel, progressChannel, &wg)
+		scanRemoteRoot(fileSet, root, limit, opts)
 	}
+	return fileSet, nil
+}
 
-	// Send jobs to workers
+// scanSetsInParallel scans both sets at the same time. This is faster when the sets live on different
+// disks or on SSDs, but on a single spinning disk the two scans compete for the head and are usually slower.
+// Neither scan draws a progress line, since two lines would overwrite each other.
+func scanSetsInParallel(set1Dirs, set2Dirs []string, opts1, opts2 ScanOptions) (set1, set2 *FileSet, err1, err2 error) {
+	opts1.HideProgress = true
+	opts2.HideProgress = true
+
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
-		for _, job := range jobs {
-			jobChannel <- job
-		}
-		close(jobChannel)
+		defer wg.Done()
+		set1, err1 = walkDirectoriesWithOptions(set1Dirs, -1, opts1)
 	}()
-
-	// Close channels when all workers are done
 	go func() {
-		wg.Wait()
-		close(resultChannel)
-		close(progressChannel)
+		defer wg.Done()
+		set2, err2 = walkDirectoriesWithOptions(set2Dirs, -1, opts2)
 	}()
+	wg.Wait()
+	return set1, set2, err1, err2
+}
 
-	// Collect results
-	fileSet := &FileSet{
-		Files:   make([]*FileInfo, 0, len(tasks)),
-		NameMap: make(map[string][]*FileInfo),
-		HashMap: make(map[string][]*FileInfo),
+// hashTaskCollection hashes the given tasks from a collection and builds a FileSet carrying the collection's roots and warnings
+func hashTaskCollection(collection *TaskCollection, tasks []FileTask, opts ScanOptions) (*FileSet, error) {
+	var totalSize int64
+	for _, task := range tasks {
+		totalSize += task.Info.Size()
 	}
 
-	resultCount := 0
-	for result := range resultChannel {
-		// Clear progress line before printing warnings
-		if len(result.Errors) > 0 {
-			progressTracker.ClearLine()
-		}
-
-		// Handle errors
-		for _, err := range result.Errors {
-			fmt.Printf("Warning: %v\n", err)
-		}
-
-		// Add successful results
-		for _, fileInfo := range result.FileInfos {
-			fileSet.Files = append(fileSet.Files, fileInfo)
-			fileSet.NameMap[fileInfo.Name] = append(fileSet.NameMap[fileInfo.Name], fileInfo)
-			fileSet.HashMap[fileInfo.Hash] = append(fileSet.HashMap[fileInfo.Hash], fileInfo)
-		}
-
-		resultCount++
+	// Determine if we should use parallel processing
+	// Only parallelize if we have enough work to justify the overhead
+	const minFilesForParallelization = 20
+	var fileSet *FileSet
+	var err error
+	if len(tasks) < minFilesForParallelization {
+		// Process sequentially for small workloads
+		fileSet, err = processFilesSequentially(tasks, totalSize, opts)
+	} else {
+		fileSet, err = processFilesInParallel(tasks, totalSize, opts)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Stop progress display and clear the line
-	close(progressDone)
-	progressTracker.ClearLine()
-
+	fileSet.Warnings = append(append([]ScanWarning(nil), collection.Warnings...), fileSet.Warnings...)
+	fileSet.Roots = collection.Roots
+	fileSet.MissingRoots = collection.MissingRoots
+	fileSet.Partial = scanStopped(opts)
 	return fileSet, nil
 }
 
-// compareFileSets performs the sophisticated comparison between two file sets
-func compareFileSets(set1, set2 *FileSet) *ComparisonResult {
-	result := &ComparisonResult{
-		SameNameDifferentHash: make([]*FileInfo, 0),
-		NameMappings:          make(map[string][]*FileInfo),
-		UniqueToSet2:          make([]*FileInfo, 0),
-		UniqueToSet1:          make([]*FileInfo, 0),
-	}
+// TaskCollection is the result of walking a set's roots before any file is hashed
+type TaskCollection struct {
+	Tasks        []FileTask
+	TotalSize    int64
+	Roots        []string // Roots actually walked, after resolving and removing overlaps
+	MissingRoots []string
+	Warnings     []ScanWarning
+}
 
-	// Process files in set2
-	for _, file2 := range set2.Files {
-		// Check if same hash exists in set1 (ignore these)
-		if _, hashExists := set1.HashMap[file2.Hash]; hashExists {
-			continue // Same content exists, skip
+// specialFileKind describes a file that can't be hashed (named pipe, socket, device or other irregular file),
+// following symlinks to their target. It returns "" for regular files and symlinks to them.
+func specialFileKind(path string, info os.FileInfo) string {
+	mode := info.Mode()
+	if mode&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err != nil {
+			return "" // Broken links surface as a hashing error
 		}
-
-		// Check if same name exists in set1
-		if files1WithSameName, nameExists := set1.NameMap[file2.Name]; nameExists {
-			// Same name exists but different hash
-			result.SameNameDifferentHash = append(result.SameNameDifferentHash, file2)
-			result.NameMappings[file2.Name] = files1WithSameName
-		} else {
-			// No name or hash match
-			result.UniqueToSet2 = append(result.UniqueToSet2, file2)
+		mode = target.Mode()
+		if target.IsDir() {
+			return "" // filepath.Walk doesn't follow directory links; opening one fails with a warning
 		}
 	}
 
-	// Process files in set1 (for the optional third tree)
-	for _, file1 := range set1.Files {
-		// Check if same hash exists in set2
-		if _, hashExists := set2.HashMap[file1.Hash]; hashExists {
-			continue // Same content exists, skip
-		}
-
-		// Check if same name exists in set2
-		if _, nameExists := set2.NameMap[file1.Name]; !nameExists {
-			// No name or hash match
-			result.UniqueToSet1 = append(result.UniqueToSet1, file1)
-		}
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode&os.ModeIrregular != 0:
+		return "irregular file"
 	}
+	return ""
+}
 
-	return result
+// stableSample keeps the files with the lowest sampleKey, so the same paths are picked on every run and
+// machine whatever order the walk finds them in, and sets sharing a layout pick the same relative paths
+type stableSample struct {
+	limit   int
+	entries []sampleEntry
 }
 
-// removeEmptyDirectories removes directories that have no files and no non-empty children
-func removeEmptyDirectories(node *TreeNode) bool {
-	if !node.IsDir {
-		return true // Keep files
-	}
+// sampleEntry is a candidate file of a stableSample
+type sampleEntry struct {
+	key  string
+	task FileTask
+}
 
-	// First, recursively process children and remove empty ones
-	for name, child := range node.Children {
-		if !removeEmptyDirectories(child) {
-			delete(node.Children, name)
-		}
-	}
+// newStableSample creates an empty sample of up to limit files
+func newStableSample(limit int) *stableSample {
+	return &stableSample{limit: limit}
+}
 
-	// A directory should be kept if:
-	// 1. It has files, OR
-	// 2. It has non-empty children
-	return len(node.Files) > 0 || len(node.Children) > 0
+// sampleKey ranks a file for a stable sample by a hash of its relative path with forward slashes,
+// which spreads the sample across the tree and doesn't depend on the root or the OS
+func sampleKey(relPath string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(relPath)))
+	return fmt.Sprintf("%x", sum[:8])
 }
 
-// buildSmartTree creates a tree structure that's smart about showing entire directories
-func buildSmartTree(files []*FileInfo, sourceSet *FileSet, otherSet *FileSet) *TreeNode {
-	root := &TreeNode{
-		Name:     "",
-		IsDir:    true,
-		Children: make(map[string]*TreeNode),
+// add offers a file to the sample, trimming the candidates now and then so memory stays bounded
+func (s *stableSample) add(task FileTask) {
+	s.entries = append(s.entries, sampleEntry{key: sampleKey(task.RelPath), task: task})
+	if len(s.entries) >= 2*s.limit {
+		s.trim()
 	}
+}
 
-	// Build a map of directory paths to check which directories exist in sourceSet
-	directoriesInSourceSet := make(map[string]bool)
-	for _, file := range sourceSet.Files {
-		dir := filepath.Dir(file.RelativePath)
-		for dir != "." && dir != "" {
-			directoriesInSourceSet[dir] = true
-			dir = filepath.Dir(dir)
+// trim sorts the candidates by key, then path for files sharing a relative path, and keeps the first limit
+func (s *stableSample) trim() {
+	sort.Slice(s.entries, func(i, j int) bool {
+		if s.entries[i].key != s.entries[j].key {
+			return s.entries[i].key < s.entries[j].key
 		}
+		return s.entries[i].task.Path < s.entries[j].task.Path
+	})
+	if len(s.entries) > s.limit {
+		s.entries = s.entries[:s.limit]
 	}
+}
 
-	for _, file := range files {
-		parts := strings.Split(file.RelativePath, string(filepath.Separator))
-		current := root
-
-		// Navigate/create the directory structure
-		for i, part := range parts {
-			if i == len(parts)-1 {
-				// This is the file
-				current.Files = append(current.Files, file)
-			} else {
-				// This is a directory
-				if current.Children[part] == nil {
-					current.Children[part] = &TreeNode{
-						Name:     part,
-						IsDir:    true,
-						Children: make(map[string]*TreeNode),
-						Parent:   current,
-					}
-				}
-				current = current.Children[part]
-			}
-		}
+// tasks returns the sampled files in key order
+func (s *stableSample) tasks() []FileTask {
+	s.trim()
+	tasks := make([]FileTask, len(s.entries))
+	for i, entry := range s.entries {
+		tasks[i] = entry.task
 	}
-
-	// Mark directories that are entirely missing
-	markEntireDirectoriesNew(root, sourceSet, otherSet, directoriesInSourceSet)
-
-	// Remove empty directories
-	removeEmptyDirectories(root)
-
-	return root
+	return tasks
 }
 
-// markEntireDirectoriesNew is the new implementation that properly handles partial matches
-func markEntireDirectoriesNew(node *TreeNode, sourceSet *FileSet, otherSet *FileSet, directoriesInSourceSet map[string]bool) {
-	if !node.IsDir {
-		return
+// collectFileTasks walks the roots and gathers the files to hash, stopping after limit files (-1 for unlimited)
+func collectFileTasks(dirs []string, limit int, opts ScanOptions) (*TaskCollection, error) {
+	var allTasks []FileTask
+	collection, err := walkFileTasks(dirs, limit, opts, func(task FileTask) {
+		allTasks = append(allTasks, task)
+	})
+	if err != nil {
+		return nil, err
 	}
+	collection.Tasks = allTasks
+	return collection, nil
+}
 
-	// Recursively process children first
-	for _, child := range node.Children {
-		markEntireDirectoriesNew(child, sourceSet, otherSet, directoriesInSourceSet)
-	}
+// walkFileTasks walks the roots and hands each file to hash to visit as soon as it is found, stopping after
+// limit files (-1 for unlimited). The returned collection carries everything but the tasks themselves.
+func walkFileTasks(dirs []string, limit int, opts ScanOptions, visit func(FileTask)) (*TaskCollection, error) {
+	taskCount := 0
+	var totalSize int64
+	var warnings []ScanWarning
+	var missingRoots []string
 
-	// Skip root node
-	if node.Name == "" {
-		node.IsEntireDir = false
-		return
-	}
+	// Resolve relative roots against --base before anything touches the filesystem
+	dirs = resolveAgainstBase(dirs, opts.BaseDir)
 
-	// Build the full path for this directory
-	var pathParts []string
-	current := node
-	for current != nil && current.Name != "" {
-		pathParts = append([]string{current.Name}, pathParts...)
-		current = current.Parent
+	// Skip roots that overlap with another root so no file is hashed twice
+	dirs, overlapWarnings := removeOverlappingRoots(dirs)
+	for _, warning := range overlapWarnings {
+		recordWarning(&warnings, opts, warning)
 	}
-	dirPath := strings.Join(pathParts, string(filepath.Separator))
 
-	// Check if this exact directory exists in the source set
-	if !directoriesInSourceSet[dirPath] {
-		// This directory doesn't exist in source set at all, so it can't be "entire"
-		node.IsEntireDir = false
-		return
+	now := time.Now()
+
+	// A stable sample considers every file and applies the limit once the walk is done
+	var sample *stableSample
+	if opts.StableSample && limit > 0 {
+		sample = newStableSample(limit)
 	}
 
-	// Count how many files from this directory in sourceSet have no match in otherSet
-	filesInDirCount := 0
-	filesWithoutMatchCount := 0
+	for _, dir := range dirs {
+		if scanStopped(opts) {
+			break
+		}
 
-	for _, sourceFile := range sourceSet.Files {
-		// Check if this file is directly in our directory (not in subdirectories)
-		if filepath.Dir(sourceFile.RelativePath) == dirPath {
-			filesInDirCount++
-			// Check if its content exists in the other set
-			if _, hashExists := otherSet.HashMap[sourceFile.Hash]; !hashExists {
-				filesWithoutMatchCount++
-			}
+		// Remote roots have no local files to collect
+		if isRemoteRoot(dir) {
+			recordWarning(&warnings, opts, ScanWarning{Reason: WarningSkippedRoot, Path: dir,
+				Message: fmt.Sprintf("Remote set %s can only be used in a full comparison, skipping...", dir)})
+			continue
 		}
-	}
 
-	// A directory can be marked as "entire" only if:
-	// 1. ALL files directly in this directory (not subdirs) have no match in otherSet (or there are no direct files)
-	// 2. ALL child directories are marked as entire (or there are no child directories)
-	// 3. There is at least SOME content (files or subdirs) in this directory
-	allDirectFilesUnmatched := filesInDirCount == 0 || (filesInDirCount > 0 && filesInDirCount == filesWithoutMatchCount)
+		// Check if directory exists
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			recordWarning(&warnings, opts, ScanWarning{Reason: WarningMissingRoot, Path: dir,
+				Message: fmt.Sprintf("Directory %s does not exist, skipping...", dir)})
+			missingRoots = append(missingRoots, dir)
+			continue
+		}
 
-	allChildrenAreEntire := true
-	hasChildDirs := false
-	for _, child := range node.Children {
-		if child.IsDir {
-			hasChildDirs = true
-			if !child.IsEntireDir {
-				allChildrenAreEntire = false
-				break
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if scanStopped(opts) {
+				return filepath.SkipAll
+			}
+			if err != nil {
+				recordWarning(&warnings, opts, readWarning(path, err, fmt.Sprintf("Error accessing %s: %v", path, err)))
+				return nil // Continue walking
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			// Reading a FIFO, socket or device would block or never end, so only regular files are hashed
+			if kind := specialFileKind(path, info); kind != "" {
+				recordWarning(&warnings, opts, ScanWarning{Reason: WarningNotRegular, Path: path, Message: fmt.Sprintf("Skipping %s %s", kind, path)})
+				return nil
+			}
+
+			// Apply the filter before hashing so excluded files cost nothing
+			if opts.Filter != nil && !opts.Filter.Match(info, now) {
+				return nil
+			}
+
+			// The tool's own checkpoint changes as the scan runs and isn't part of either set
+			if isCheckpointFile(path, info, opts) {
+				return nil
+			}
+
+			// Check limit before adding to tasks
+			if sample == nil && limit > 0 && taskCount >= limit {
+				return filepath.SkipAll
 			}
+
+			relPath, err := filepath.Rel(dir, path)
+			if err != nil {
+				relPath = path
+			}
+
+			task := FileTask{
+				Path:    path,
+				Info:    info,
+				RootDir: dir,
+				RelPath: relPath,
+			}
+			if sample != nil {
+				sample.add(task)
+				return nil
+			}
+			taskCount++
+			visit(task)
+			totalSize += info.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking directory %s: %v", dir, err)
 		}
 	}
 
-	// Directory must have some content (either files or subdirectories)
-	hasContent := filesInDirCount > 0 || hasChildDirs
-
-	if hasContent && allDirectFilesUnmatched && (!hasChildDirs || allChildrenAreEntire) {
-		node.IsEntireDir = true
-	} else {
-		node.IsEntireDir = false
+	if sample != nil {
+		for _, task := range sample.tasks() {
+			visit(task)
+			totalSize += task.Info.Size()
+		}
 	}
+
+	return &TaskCollection{
+		TotalSize:    totalSize,
+		Roots:        dirs,
+		MissingRoots: missingRoots,
+		Warnings:     warnings,
+	}, nil
 }
 
-// markEntireDirectories marks directories where all contents are missing
-func markEntireDirectories(node *TreeNode, sourceSet *FileSet, otherSet *FileSet) {
-	if !node.IsDir {
-		return
+// allRootsMissing reports whether a set came up empty only because none of its directories exist
+func allRootsMissing(fileSet *FileSet) bool {
+	return len(fileSet.Files) == 0 && len(fileSet.Roots) > 0 && len(fileSet.MissingRoots) == len(fileSet.Roots)
+}
+
+// reportMissingSets warns prominently about sets whose directories are all missing or that contain no files,
+// returning true when a set was missing entirely
+func reportMissingSets(set1, set2 *FileSet) bool {
+	missing := false
+	for i, fileSet := range []*FileSet{set1, set2} {
+		if allRootsMissing(fileSet) {
+			fmt.Println()
+			fmt.Printf("❌ %s has no files because none of its directories exist: %s\n", setLabel(i), strings.Join(fileSet.MissingRoots, ", "))
+			fmt.Println("   Check for typos or unmounted drives; comparing against a missing set would report every file in the other set as unique.")
+			missing = true
+		} else if len(fileSet.Files) == 0 && !fileSet.Partial {
+			fmt.Printf("ℹ️  %s directories exist but contain no files.\n", setLabel(i))
+		}
 	}
+	return missing
+}
 
-	// Recursively process children first
-	for _, child := range node.Children {
-		markEntireDirectories(child, sourceSet, otherSet)
+// FilterNode is a node of a parsed --filter expression
+type FilterNode interface {
+	Match(info os.FileInfo, now time.Time) bool
+}
+
+// filterOr matches when either side matches
+type filterOr struct {
+	left, right FilterNode
+}
+
+// Match implements FilterNode
+func (f *filterOr) Match(info os.FileInfo, now time.Time) bool {
+	return f.left.Match(info, now) || f.right.Match(info, now)
+}
+
+// filterAnd matches when both sides match
+type filterAnd struct {
+	left, right FilterNode
+}
+
+// Match implements FilterNode
+func (f *filterAnd) Match(info os.FileInfo, now time.Time) bool {
+	return f.left.Match(info, now) && f.right.Match(info, now)
+}
+
+// filterComparison compares a single file attribute (size, age, ext or name) against a value
+type filterComparison struct {
+	field string
+	op    string
+	value string        // Used by ext and name
+	size  int64         // Used by size
+	age   time.Duration // Used by age
+}
+
+// Match implements FilterNode
+func (f *filterComparison) Match(info os.FileInfo, now time.Time) bool {
+	switch f.field {
+	case "size":
+		return compareOrdered(info.Size(), f.size, f.op)
+	case "age":
+		return compareOrdered(int64(now.Sub(info.ModTime())), int64(f.age), f.op)
+	case "ext":
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(info.Name())), ".")
+		return (ext == f.value) == (f.op == "==")
+	case "name":
+		matched, err := filepath.Match(f.value, info.Name())
+		return err == nil && matched == (f.op == "==")
 	}
+	return false
+}
 
-	// Skip root node
-	if node.Name == "" {
-		node.IsEntireDir = false
-		return
+// compareOrdered applies a comparison operator to two ordered values
+func compareOrdered(actual, expected int64, op string) bool {
+	switch op {
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
 	}
+	return false
+}
 
-	// A directory can be marked as "entire" only if:
-	// 1. It has no child directories, OR all child directories are marked as "entire"
-	// 2. It has files (either directly or in subdirectories)
-	// 3. This is a directory that's actually being shown in our tree (not just a parent of shown files)
+// filterParser is a recursive descent parser over tokenized filter expressions
+type filterParser struct {
+	tokens []string
+	pos    int
+}
 
-	// Check if all children (if any) are marked as entire
-	allChildrenAreEntire := true
-	hasChildren := len(node.Children) > 0
+// parseFilter parses an expression such as "size>100MB || age<7d" into a FilterNode
+func parseFilter(expr string) (FilterNode, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter expression")
+	}
 
-	for _, child := range node.Children {
-		if child.IsDir && !child.IsEntireDir {
-			allChildrenAreEntire = false
-			break
+	parser := &filterParser{tokens: tokens}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter expression", parser.tokens[parser.pos])
+	}
+	return node, nil
+}
+
+// tokenizeFilter splits a filter expression into operators, parentheses and words
+func tokenizeFilter(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||") ||
+			strings.HasPrefix(expr[i:], "<=") || strings.HasPrefix(expr[i:], ">=") ||
+			strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '(' || c == ')' || c == '<' || c == '>':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '=':
+			tokens = append(tokens, "==")
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in filter expression")
+			}
+			tokens = append(tokens, expr[i+1:i+1+end])
+			i += end + 2
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t()<>=!&|'\"", rune(expr[i])) {
+				i++
+			}
+			if start == i {
+				return nil, fmt.Errorf("unexpected %q in filter expression", string(c))
+			}
+			tokens = append(tokens, expr[start:i])
 		}
 	}
+	return tokens, nil
+}
 
-	// A leaf directory (no subdirectories) with files
-	if !hasChildren && len(node.Files) > 0 {
-		node.IsEntireDir = true
-	} else if hasChildren && allChildrenAreEntire {
-		// A directory where ALL subdirectories are marked as entire
-		node.IsEntireDir = true
-	} else {
-		node.IsEntireDir = false
+// next returns the next token without consuming it, or "" at the end of input
+func (p *filterParser) next() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
 	}
+	return ""
 }
 
-// printTree prints the tree structure with proper formatting
-func printTree(node *TreeNode, prefix string, isLast bool, showDetails bool, nameMappings map[string][]*FileInfo) {
-	if node.Name != "" {
-		connector := "├── "
-		if isLast {
-			connector = "└── "
+// parseOr parses a sequence of && groups joined by ||
+func (p *filterParser) parseOr() (FilterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
 		}
+		left = &filterOr{left: left, right: right}
+	}
+	return left, nil
+}
 
-		if node.IsDir {
-			if node.IsEntireDir {
-				fmt.Printf("%s%s📁 %s/ (entire directory)\n", prefix, connector, node.Name)
-			} else {
-				fmt.Printf("%s%s📁 %s/\n", prefix, connector, node.Name)
-			}
+// parseAnd parses a sequence of primaries joined by &&
+func (p *filterParser) parseAnd() (FilterNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "&&" {
+		p.pos++
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
 		}
+		left = &filterAnd{left: left, right: right}
+	}
+	return left, nil
+}
 
-		if isLast {
-			prefix += "    "
-		} else {
-			prefix += "│   "
+// parsePrimary parses a parenthesized expression or a single comparison
+func (p *filterParser) parsePrimary() (FilterNode, error) {
+	if p.next() == "(" {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
 		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in filter expression")
+		}
+		p.pos++
+		return node, nil
 	}
 
-	// If this directory is marked as "entire", don't print its contents
-	if node.IsEntireDir {
-		return
+	if p.pos+3 > len(p.tokens) {
+		return nil, fmt.Errorf("incomplete comparison in filter expression")
 	}
+	field, op, value := strings.ToLower(p.tokens[p.pos]), p.tokens[p.pos+1], p.tokens[p.pos+2]
+	p.pos += 3
 
-	// Print files in this directory
-	for i, file := range node.Files {
-		isLastFile := i == len(node.Files)-1 && len(node.Children) == 0
-		connector := "├── "
-		if isLastFile {
-			connector = "└── "
-		}
+	switch op {
+	case "<", "<=", ">", ">=", "==", "!=":
+	default:
+		return nil, fmt.Errorf("expected comparison operator after %q, got %q", field, op)
+	}
 
-		fileOutput := fmt.Sprintf("📄 %s", file.Name)
-		if showDetails {
-			fileOutput += fmt.Sprintf(" (%.2f KB)", float64(file.Size)/1024.0)
+	node := &filterComparison{field: field, op: op}
+	switch field {
+	case "size":
+		size, err := parseSize(value)
+		if err != nil {
+			return nil, err
 		}
-
-		// Add mapping information for same-name files
-		if nameMappings != nil {
-			if mappedFiles, exists := nameMappings[file.Name]; exists && len(mappedFiles) > 0 {
-				fileOutput += fmt.Sprintf(" → %s", mappedFiles[0].RelativePath)
-			}
+		node.size = size
+	case "age":
+		age, err := parseAge(value)
+		if err != nil {
+			return nil, err
 		}
+		node.age = age
+	case "ext", "name":
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s only supports == and !=", field)
+		}
+		if field == "ext" {
+			value = strings.TrimPrefix(strings.ToLower(value), ".")
+		} else if _, err := filepath.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %v", value, err)
+		}
+		node.value = value
+	default:
+		return nil, fmt.Errorf("unknown filter field %q (expected size, age, ext or name)", field)
+	}
+	return node, nil
+}
 
-		fmt.Printf("%s%s%s\n", prefix, connector, fileOutput)
+// parseSize parses a size such as "512", "10KB" or "1.5GB" into bytes
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"TB", 1024 * 1024 * 1024 * 1024},
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"B", 1},
 	}
 
-	// Print subdirectories
-	var childNames []string
-	for name := range node.Children {
-		childNames = append(childNames, name)
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
 	}
-	sort.Strings(childNames)
 
-	for i, name := range childNames {
-		isLastChild := i == len(childNames)-1
-		printTree(node.Children[name], prefix, isLastChild, showDetails, nameMappings)
+	number, err := strconv.ParseFloat(upper, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
 	}
+	return int64(number * multiplier), nil
 }
 
-// countTreeItems counts total files and directories in the tree
-func countTreeItems(node *TreeNode) (files int, dirs int) {
-	files += len(node.Files)
+// parseAge parses an age such as "30m", "12h", "7d" or "2w" into a duration
+func parseAge(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
 
-	for _, child := range node.Children {
-		if child.IsDir {
-			dirs++
-			childFiles, childDirs := countTreeItems(child)
-			files += childFiles
-			dirs += childDirs
-		}
+	if len(value) < 2 {
+		return 0, fmt.Errorf("invalid age %q", value)
 	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid age %q (expected a unit of s, m, h, d or w)", value)
+	}
+	number, err := strconv.ParseFloat(value[:len(value)-1], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return time.Duration(number * float64(unit)), nil
+}
 
-	return files, dirs
+// resolveRootPath returns a cleaned absolute path for a root directory, following symlinks where possible
+func resolveRootPath(dir string) string {
+	absPath, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Clean(dir)
+	}
+	if realPath, err := filepath.EvalSymlinks(absPath); err == nil {
+		return realPath
+	}
+	return absPath
 }
 
-// buildTree creates a simple tree structure from the list of files
-func buildTree(files []*FileInfo) *TreeNode {
-	root := &TreeNode{
-		Name:     "",
-		IsDir:    true,
-		Children: make(map[string]*TreeNode),
+// isSubPath reports whether child is located strictly inside parent
+func isSubPath(parent, child string) bool {
+	rel, err := filepath.Rel(parent, child)
+	if err != nil {
+		return false
 	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
 
-	for _, file := range files {
-		parts := strings.Split(file.RelativePath, string(filepath.Separator))
-		current := root
+// removeOverlappingRoots drops roots that duplicate or are nested inside another root of the same set,
+// returning the remaining roots and a warning for each one skipped
+func removeOverlappingRoots(dirs []string) ([]string, []ScanWarning) {
+	resolved := make([]string, len(dirs))
+	for i, dir := range dirs {
+		resolved[i] = resolveRootPath(dir)
+	}
 
-		// Navigate/create the directory structure
-		for i, part := range parts {
-			if i == len(parts)-1 {
-				// This is the file
-				current.Files = append(current.Files, file)
-			} else {
-				// This is a directory
-				if current.Children[part] == nil {
-					current.Children[part] = &TreeNode{
-						Name:     part,
-						IsDir:    true,
-						Children: make(map[string]*TreeNode),
-						Parent:   current,
-					}
+	kept := make([]string, 0, len(dirs))
+	var warnings []ScanWarning
+	for i, dir := range dirs {
+		skipped := false
+		for j, other := range dirs {
+			if i == j {
+				continue
+			}
+
+			// Keep only the first occurrence of a duplicated root
+			if resolved[i] == resolved[j] {
+				if j < i {
+					warnings = append(warnings, ScanWarning{Reason: WarningSkippedRoot, Path: dir,
+						Message: fmt.Sprintf("Directory %s is the same as %s, skipping duplicate...", dir, other)})
+					skipped = true
+					break
 				}
-				current = current.Children[part]
+				continue
+			}
+
+			// The enclosing root already covers every file in a nested root
+			if isSubPath(resolved[j], resolved[i]) {
+				warnings = append(warnings, ScanWarning{Reason: WarningSkippedRoot, Path: dir,
+					Message: fmt.Sprintf("Directory %s is inside %s, skipping to avoid counting files twice...", dir, other)})
+				skipped = true
+				break
 			}
 		}
+
+		if !skipped {
+			kept = append(kept, dir)
+		}
 	}
 
-	return root
+	return kept, warnings
 }
 
-// getOSSpecificExamples returns example paths and descriptions based on the current OS
-func getOSSpecificExamples() (string, string, string, string) {
-	if runtime.GOOS == "windows" {
-		return "C:\\Photos\\2023", "D:\\Backup\\Photos",
+// processFilesSequentially handles small workloads without goroutine overhead
+func processFilesSequentially(tasks []FileTask, totalSize int64, opts ScanOptions) (*FileSet, error) {
+	fileSet := &FileSet{
+		Files:   make([]*FileInfo, 0, len(tasks)),
+		NameMap: make(map[string][]*FileInfo),
+		HashMap: make(map[string][]*FileInfo),
+	}
+
+	// For small workloads, don't show progress tracking
+	buf := newHashBuffer(opts.BufferSize)
+	for _, task := range tasks {
+		hash, err := hashTask(task, opts, buf)
+		if errors.Is(err, errScanStopped) {
+			break
+		}
+		if err != nil {
+			recordWarning(&fileSet.Warnings, opts, readWarning(task.Path, err, fmt.Sprintf("Could not hash file %s: %v", task.Path, err)))
+			continue
+		}
+
+		fileInfo := &FileInfo{
+			RelativePath: task.RelPath,
+			AbsolutePath: task.Path,
+			Name:         task.Info.Name(),
+			Hash:         hash,
+			Size:         task.Info.Size(),
+			RootDir:      task.RootDir,
+			ModTime:      task.Info.ModTime(),
+		}
+
+		fileSet.Files = append(fileSet.Files, fileInfo)
+		fileSet.NameMap[fileInfo.Name] = append(fileSet.NameMap[fileInfo.Name], fileInfo)
+		fileSet.HashMap[fileInfo.Hash] = append(fileSet.HashMap[fileInfo.Hash], fileInfo)
+	}
+
+	return fileSet, nil
+}
+
+// Bounds on files per batch: smaller batches spend more time on channel overhead than hashing
+// tiny files, larger ones leave workers idle while the last few batches finish
+const (
+	minBatchSize = 64
+	maxBatchSize = 4096
+)
+
+// calculateBatchSize picks files per batch, aiming for 2 batches per worker within the batch size bounds
+func calculateBatchSize(taskCount, numWorkers int) int {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	batchSize := taskCount / (numWorkers * 2)
+	if batchSize > maxBatchSize {
+		return maxBatchSize
+	}
+	if batchSize < minBatchSize {
+		// Don't let the minimum starve workers when there are too few files to go around
+		perWorker := (taskCount + numWorkers - 1) / numWorkers
+		batchSize = minBatchSize
+		if perWorker < batchSize {
+			batchSize = perWorker
+		}
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return batchSize
+}
+
+// processFilesInParallel handles large workloads with optimal parallelization
+func processFilesInParallel(tasks []FileTask, totalSize int64, opts ScanOptions) (*FileSet, error) {
+	numWorkers := hashWorkerCount()
+	batchSize := calculateBatchSize(len(tasks), numWorkers)
+
+	// Create work batches
+	var jobs []FileJob
+	for i := 0; i < len(tasks); i += batchSize {
+		end := i + batchSize
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		jobs = append(jobs, FileJob{Files: tasks[i:end]})
+	}
+
+	// Create progress tracker
+	progressTracker := NewProgressTracker(int64(len(tasks)), totalSize)
+
+	// Create channels with appropriate buffer sizes
+	jobChannel := make(chan FileJob, len(jobs))
+	resultChannel := make(chan FileResult, len(jobs))
+	progressChannel := make(chan ProgressUpdate, numWorkers*10) // Buffer for progress updates
+	progressDone := startProgressDisplay(progressTracker, progressChannel, opts)
+
+	// Start workers
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go hashWorker(jobChannel, resultChannel, progressChannel, &wg, opts)
+	}
+
+	// Send jobs to workers
+	go func() {
+		for _, job := range jobs {
+			jobChannel <- job
+		}
+		close(jobChannel)
+	}()
+
+	// Close channels when all workers are done
+	go func() {
+		wg.Wait()
+		close(resultChannel)
+		close(progressChannel)
+	}()
+
+	// Collect results
+	fileSet := &FileSet{
+		Files:   make([]*FileInfo, 0, len(tasks)),
+		NameMap: make(map[string][]*FileInfo),
+		HashMap: make(map[string][]*FileInfo),
+	}
+	for result := range resultChannel {
+		addFileResult(fileSet, result, progressTracker, opts)
+	}
+
+	// Stop progress display and clear the line
+	close(progressDone)
+	progressTracker.ClearLine()
+
+	return fileSet, nil
+}
+
+// streamBatchSize is how many files the walk hands to a hashing worker at a time. A streaming scan doesn't know
+// its total until the walk ends, so calculateBatchSize sizes batches for the files found so far, or for the
+// limit when there is one: they start small so hashing begins at once and grow to maxBatchSize on large trees.
+func streamBatchSize(found, limit, numWorkers int) int {
+	if limit > 0 {
+		found = limit
+	}
+	return calculateBatchSize(found, numWorkers)
+}
+
+// streamFilesInParallel hashes files while the roots are still being walked. Discovered files go to the
+// hashing workers in small batches over a bounded channel, so hashing starts with the first batch and only
+// the files in flight are held as tasks, instead of every file of the set.
+func streamFilesInParallel(dirs []string, limit int, opts ScanOptions) (*FileSet, error) {
+	numWorkers := hashWorkerCount()
+
+	// Totals grow as the walk finds files
+	progressTracker := NewProgressTracker(0, 0)
+	progressTracker.SetDiscovering(true)
+
+	jobChannel := make(chan FileJob, numWorkers*2)
+	resultChannel := make(chan FileResult, numWorkers*2)
+	progressChannel := make(chan ProgressUpdate, numWorkers*10)
+	progressDone := startProgressDisplay(progressTracker, progressChannel, opts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go hashWorker(jobChannel, resultChannel, progressChannel, &wg, opts)
+	}
+
+	// Walk in the background. Its warnings are recorded quietly and printed once the progress line is gone,
+	// since printing them mid-walk would tangle them with the line.
+	walkOpts := opts
+	walkOpts.QuietWarnings = true
+	walkOpts.OnWarning = nil
+	var collection *TaskCollection
+	var walkErr error
+	go func() {
+		defer close(jobChannel)
+
+		var batch []FileTask
+		found := 0
+		collection, walkErr = walkFileTasks(dirs, limit, walkOpts, func(task FileTask) {
+			progressTracker.AddTotals(1, task.Info.Size())
+			found++
+			batch = append(batch, task)
+			if len(batch) >= streamBatchSize(found, limit, numWorkers) {
+				jobChannel <- FileJob{Files: batch}
+				batch = nil
+			}
+		})
+		if len(batch) > 0 {
+			jobChannel <- FileJob{Files: batch}
+		}
+		progressTracker.SetDiscovering(false)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultChannel)
+		close(progressChannel)
+	}()
+
+	fileSet := &FileSet{
+		NameMap: make(map[string][]*FileInfo),
+		HashMap: make(map[string][]*FileInfo),
+	}
+	for result := range resultChannel {
+		addFileResult(fileSet, result, progressTracker, opts)
+	}
+
+	close(progressDone)
+	progressTracker.ClearDrawnLine()
+
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	for _, warning := range collection.Warnings {
+		reportWarning(opts, warning)
+	}
+	fileSet.Warnings = append(append([]ScanWarning(nil), collection.Warnings...), fileSet.Warnings...)
+	fileSet.Roots = collection.Roots
+	fileSet.MissingRoots = collection.MissingRoots
+	fileSet.Partial = scanStopped(opts)
+	return fileSet, nil
+}
+
+// hashWorkerCount is the number of hashing workers: 75% of the CPU cores, at least one
+func hashWorkerCount() int {
+	numWorkers := int(float64(runtime.NumCPU()) * 0.75)
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	return numWorkers
+}
+
+// startProgressDisplay applies worker progress updates to the tracker and redraws the progress line
+// five times per second until the returned channel is closed
+func startProgressDisplay(progressTracker *ProgressTracker, progressChannel <-chan ProgressUpdate, opts ScanOptions) chan struct{} {
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(200 * time.Millisecond) // Update 5 times per second
+		defer ticker.Stop()
+
+		for {
+			select {
+			case update, ok := <-progressChannel:
+				if !ok {
+					return // Channel closed, we're done
+				}
+				progressTracker.UpdateProgress(update.FilesProcessed, update.BytesProcessed)
+			case <-ticker.C:
+				if !opts.HideProgress {
+					progressTracker.DisplayProgress("🔍 Analyzing files... ")
+				}
+			case <-progressDone:
+				return
+			}
+		}
+	}()
+	return progressDone
+}
+
+// addFileResult adds a worker's batch to the file set, recording its errors as warnings
+func addFileResult(fileSet *FileSet, result FileResult, progressTracker *ProgressTracker, opts ScanOptions) {
+	// Clear progress line before printing warnings
+	if len(result.Errors) > 0 && !opts.QuietWarnings {
+		progressTracker.ClearDrawnLine()
+	}
+
+	for _, err := range result.Errors {
+		path := ""
+		var failure *hashFailure
+		if errors.As(err, &failure) {
+			path = failure.path
+		}
+		recordWarning(&fileSet.Warnings, opts, readWarning(path, err, err.Error()))
+	}
+
+	for _, fileInfo := range result.FileInfos {
+		fileSet.Files = append(fileSet.Files, fileInfo)
+		fileSet.NameMap[fileInfo.Name] = append(fileSet.NameMap[fileInfo.Name], fileInfo)
+		fileSet.HashMap[fileInfo.Hash] = append(fileSet.HashMap[fileInfo.Hash], fileInfo)
+	}
+}
+
+// CompareOptions controls how files from the two sets are matched against each other
+type CompareOptions struct {
+	IgnorePaths  bool            // Match purely by content; names and directory structure play no part
+	IgnoreHashes map[string]bool // Content hashes never reported as a difference (--ignore-hashes)
+	LooseNames   bool            // Match names regardless of case and accents (--loose-names)
+}
+
+// looseNameFolds maps lowercase accented Latin letters to their unaccented spelling for --loose-names
+var looseNameFolds = func() map[rune]string {
+	folds := map[rune]string{'æ': "ae", 'œ': "oe", 'ß': "ss"}
+	for base, accented := range map[string]string{
+		"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđ", "e": "èéêëēĕėęě", "g": "ĝğġģ", "h": "ĥħ",
+		"i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ", "l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏő",
+		"r": "ŕŗř", "s": "śŝşš", "t": "ţťŧ", "u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+	} {
+		for _, r := range accented {
+			folds[r] = base
+		}
+	}
+	return folds
+}()
+
+// looseNameKey reduces a file name to the key --loose-names matches on: lowercase, with accents removed
+// whether they are precomposed (é, as on most systems) or combining marks (e + ◌́, as macOS stores names)
+func looseNameKey(name string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if fold, ok := looseNameFolds[r]; ok {
+			builder.WriteString(fold)
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// nameIndex returns the files of a set grouped by name, or by loose name key with --loose-names
+func nameIndex(fileSet *FileSet, opts CompareOptions) map[string][]*FileInfo {
+	if !opts.LooseNames {
+		return fileSet.NameMap
+	}
+	index := make(map[string][]*FileInfo, len(fileSet.NameMap))
+	for name, files := range fileSet.NameMap {
+		key := looseNameKey(name)
+		index[key] = append(index[key], files...)
+	}
+	return index
+}
+
+// nameKey returns the key a file name is looked up by in a nameIndex
+func nameKey(name string, opts CompareOptions) string {
+	if opts.LooseNames {
+		return looseNameKey(name)
+	}
+	return name
+}
+
+// loadHashBlocklist reads one hash per line for --ignore-hashes. Blank lines and lines starting with #
+// are skipped, and only the first field is used so sha256sum/md5sum output can be passed as-is.
+func loadHashBlocklist(path string) (map[string]bool, error) {
+	// #nosec G304 - path is intentionally user-provided
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blocklist := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		blocklist[strings.ToLower(fields[0])] = true
+	}
+	return blocklist, nil
+}
+
+// compareFileSets performs the sophisticated comparison between two file sets
+func compareFileSets(set1, set2 *FileSet) *ComparisonResult {
+	return compareFileSetsWithOptions(set1, set2, CompareOptions{})
+}
+
+// compareFileSetsWithOptions compares two file sets using the given matching rules
+func compareFileSetsWithOptions(set1, set2 *FileSet, opts CompareOptions) *ComparisonResult {
+	result := &ComparisonResult{
+		SameNameDifferentHash: make([]*FileInfo, 0),
+		NameMappings:          make(map[string][]*FileInfo),
+		UniqueToSet2:          make([]*FileInfo, 0),
+		UniqueToSet1:          make([]*FileInfo, 0),
+		TimestampOnlyChanged:  make([]*FileInfo, 0),
+		IgnoredByHash:         make([]*FileInfo, 0),
+		IdenticalInSet1:       make([]*FileInfo, 0),
+	}
+	names1, names2 := nameIndex(set1, opts), nameIndex(set2, opts)
+
+	// Process files in set2
+	for _, file2 := range set2.Files {
+		// Known-noise content is never a difference
+		if opts.IgnoreHashes[file2.Hash] {
+			result.IgnoredByHash = append(result.IgnoredByHash, file2)
+			continue
+		}
+
+		// Check if same hash exists in set1 (ignore these)
+		if files1WithSameHash, hashExists := set1.HashMap[file2.Hash]; hashExists {
+			// Same content, but note files that were re-saved at the same path
+			if isTimestampOnlyChange(file2, files1WithSameHash) {
+				result.TimestampOnlyChanged = append(result.TimestampOnlyChanged, file2)
+			}
+			continue // Same content exists, skip
+		}
+
+		// Check if same name exists in set1
+		if files1WithSameName, nameExists := names1[nameKey(file2.Name, opts)]; nameExists && !opts.IgnorePaths {
+			// Same name exists but different hash
+			result.SameNameDifferentHash = append(result.SameNameDifferentHash, file2)
+			result.NameMappings[file2.Name] = files1WithSameName
+		} else {
+			// No name or hash match
+			result.UniqueToSet2 = append(result.UniqueToSet2, file2)
+		}
+	}
+
+	// Process files in set1 (for the optional third tree)
+	for _, file1 := range set1.Files {
+		if opts.IgnoreHashes[file1.Hash] {
+			result.IgnoredByHash = append(result.IgnoredByHash, file1)
+			continue
+		}
+
+		// Check if same hash exists in set2
+		if _, hashExists := set2.HashMap[file1.Hash]; hashExists {
+			result.IdenticalInSet1 = append(result.IdenticalInSet1, file1)
+			continue // Same content exists, skip
+		}
+
+		// Check if same name exists in set2
+		if _, nameExists := names2[nameKey(file1.Name, opts)]; !nameExists || opts.IgnorePaths {
+			// No name or hash match
+			result.UniqueToSet1 = append(result.UniqueToSet1, file1)
+		}
+	}
+
+	return result
+}
+
+// isTimestampOnlyChange reports whether a file has an identical copy at the same relative path with a different mod time
+func isTimestampOnlyChange(file *FileInfo, sameHashFiles []*FileInfo) bool {
+	for _, other := range sameHashFiles {
+		if other.RelativePath == file.RelativePath {
+			return !other.ModTime.Equal(file.ModTime)
+		}
+	}
+	return false
+}
+
+// printTimestampOnlyChanges lists files that were touched without their content changing
+func printTimestampOnlyChanges(files []*FileInfo) {
+	if len(files) == 0 {
+		fmt.Println("✅ No files with only a timestamp change.")
+		fmt.Println()
+		return
+	}
+
+	sorted := make([]*FileInfo, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].RelativePath < sorted[j].RelativePath
+	})
+
+	fmt.Printf("🕒 Files with only a timestamp change (%d files):\n", len(sorted))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, file := range sorted {
+		fmt.Printf("   📄 %s (timestamp changed, content same)\n", file.RelativePath)
+	}
+	fmt.Println()
+}
+
+// DirectoryMove is a directory of set 1 whose files all turn up, with the same layout, under a new directory of set 2
+type DirectoryMove struct {
+	From  string // Directory in set 1, relative to its root
+	To    string // Directory in set 2 that now holds the same files
+	Files int
+	Size  int64
+}
+
+// filesUnderDirectories maps every directory of a set, relative to its root, to all files beneath it
+func filesUnderDirectories(fileSet *FileSet) map[string][]*FileInfo {
+	under := make(map[string][]*FileInfo)
+	for _, file := range fileSet.Files {
+		for dir := filepath.Dir(file.RelativePath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			under[dir] = append(under[dir], file)
+		}
+	}
+	return under
+}
+
+// findDirectoryMoves finds directories that exist only in set 1 and whose every file has the same content at
+// the same place under a directory that exists only in set 2, e.g. 2023/photos → archive/2023/photos.
+// Only the topmost directory of a move is reported, not each subdirectory that moved along with it.
+func findDirectoryMoves(set1, set2 *FileSet) []DirectoryMove {
+	under1, under2 := filesUnderDirectories(set1), filesUnderDirectories(set2)
+	inSet2 := make(map[string]bool, len(set2.Files))
+	for _, file := range set2.Files {
+		inSet2[file.RelativePath+"\x00"+file.Hash] = true
+	}
+
+	// Parents before children, so a moved directory's subdirectories can be skipped
+	dirs := make([]string, 0, len(under1))
+	for dir := range under1 {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		depthI, depthJ := strings.Count(dirs[i], string(filepath.Separator)), strings.Count(dirs[j], string(filepath.Separator))
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	var moves []DirectoryMove
+	for _, dir := range dirs {
+		if _, stillThere := under2[dir]; stillThere || insideMovedDirectory(dir, moves) {
+			continue
+		}
+		if to, ok := directoryMoveTarget(dir, under1[dir], set2, under1, inSet2); ok {
+			move := DirectoryMove{From: dir, To: to, Files: len(under1[dir])}
+			for _, file := range under1[dir] {
+				move.Size += file.Size
+			}
+			moves = append(moves, move)
+		}
+	}
+
+	sort.Slice(moves, func(i, j int) bool {
+		return moves[i].From < moves[j].From
+	})
+	return moves
+}
+
+// insideMovedDirectory reports whether dir is beneath the source of one of the moves
+func insideMovedDirectory(dir string, moves []DirectoryMove) bool {
+	for _, move := range moves {
+		if strings.HasPrefix(dir, move.From+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// directoryMoveTarget returns the new set 2 directory holding all of files from set 1 directory dir, trying each
+// place the first file's content was found as the candidate
+func directoryMoveTarget(dir string, files []*FileInfo, set2 *FileSet, under1 map[string][]*FileInfo, inSet2 map[string]bool) (string, bool) {
+	sep := string(filepath.Separator)
+	suffix := strings.TrimPrefix(files[0].RelativePath, dir+sep)
+	for _, candidate := range set2.HashMap[files[0].Hash] {
+		if !strings.HasSuffix(candidate.RelativePath, sep+suffix) {
+			continue
+		}
+		to := strings.TrimSuffix(candidate.RelativePath, sep+suffix)
+		if _, existedBefore := under1[to]; existedBefore || to == dir {
+			continue
+		}
+
+		allFound := true
+		for _, file := range files {
+			rest := strings.TrimPrefix(file.RelativePath, dir+sep)
+			if !inSet2[to+sep+rest+"\x00"+file.Hash] {
+				allFound = false
+				break
+			}
+		}
+		if allFound {
+			return to, true
+		}
+	}
+	return "", false
+}
+
+// printDirectoryMoves lists moved directories, one line each instead of one per file
+func printDirectoryMoves(moves []DirectoryMove) {
+	if len(moves) == 0 {
+		fmt.Println("✅ No directories were moved.")
+		fmt.Println()
+		return
+	}
+
+	sep := string(filepath.Separator)
+	fmt.Printf("🚚 Directories moved (%d):\n", len(moves))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, move := range moves {
+		fmt.Printf("   📁 %s%s → %s%s (%d files, %s)\n", move.From, sep, move.To, sep, move.Files, formatSize(move.Size))
+	}
+	fmt.Println()
+}
+
+// ACLDifference is a file with identical content at the same path in both sets but different ACLs
+type ACLDifference struct {
+	Set1File *FileInfo
+	Set2File *FileInfo
+	Set1ACL  string
+	Set2ACL  string
+}
+
+// findACLDifferences compares the ACLs of files whose content matches at the same relative path.
+// Files whose ACLs can't be read are skipped and reported in the returned warnings.
+func findACLDifferences(set1, set2 *FileSet) ([]ACLDifference, []ScanWarning) {
+	var differences []ACLDifference
+	var warnings []ScanWarning
+
+	for _, file2 := range set2.Files {
+		for _, file1 := range set1.HashMap[file2.Hash] {
+			if file1.RelativePath != file2.RelativePath {
+				continue
+			}
+
+			acl1, err := readACL(file1.AbsolutePath)
+			if err != nil {
+				warnings = append(warnings, readWarning(file1.AbsolutePath, err, fmt.Sprintf("Cannot read ACL of %s: %v", file1.AbsolutePath, err)))
+				break
+			}
+			acl2, err := readACL(file2.AbsolutePath)
+			if err != nil {
+				warnings = append(warnings, readWarning(file2.AbsolutePath, err, fmt.Sprintf("Cannot read ACL of %s: %v", file2.AbsolutePath, err)))
+				break
+			}
+			if acl1 != acl2 {
+				differences = append(differences, ACLDifference{Set1File: file1, Set2File: file2, Set1ACL: acl1, Set2ACL: acl2})
+			}
+			break
+		}
+	}
+
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].Set2File.RelativePath < differences[j].Set2File.RelativePath
+	})
+	return differences, warnings
+}
+
+// printACLDifferences lists same-content files whose access controls differ
+func printACLDifferences(differences []ACLDifference) {
+	if len(differences) == 0 {
+		fmt.Println("✅ No files with same content but different ACLs.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("🔐 Files with same content but different ACLs (%d files):\n", len(differences))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, difference := range differences {
+		fmt.Printf("   📄 %s\n", difference.Set2File.RelativePath)
+		fmt.Printf("      %s: %s\n", set1Label, difference.Set1ACL)
+		fmt.Printf("      %s: %s\n", set2Label, difference.Set2ACL)
+	}
+	fmt.Println()
+}
+
+// BOMDifference is a pair of files at the same relative path whose content only differs by a byte-order mark
+type BOMDifference struct {
+	Set1File *FileInfo
+	Set2File *FileInfo
+	Set1BOM  string // "" when the file has none
+	Set2BOM  string
+}
+
+// findBOMDifferences finds files whose --ignore-bom hash matches at the same relative path but whose
+// byte-order marks differ, i.e. the files --ignore-bom kept from being reported as modified.
+// Files that can't be read are skipped and reported in the returned warnings.
+func findBOMDifferences(set1, set2 *FileSet) ([]BOMDifference, []ScanWarning) {
+	var differences []BOMDifference
+	var warnings []ScanWarning
+
+	readBOM := func(file *FileInfo) (string, bool) {
+		// #nosec G304 - the path comes from the user's own directory scan
+		f, err := os.Open(file.AbsolutePath)
+		if err != nil {
+			warnings = append(warnings, readWarning(file.AbsolutePath, err, fmt.Sprintf("Cannot read byte-order mark of %s: %v", file.AbsolutePath, err)))
+			return "", false
+		}
+		defer f.Close()
+		bom, _, err := detectBOM(f)
+		if err != nil {
+			warnings = append(warnings, readWarning(file.AbsolutePath, err, fmt.Sprintf("Cannot read byte-order mark of %s: %v", file.AbsolutePath, err)))
+			return "", false
+		}
+		return bom, true
+	}
+
+	for _, file2 := range set2.Files {
+		if !bomEligible(file2.Name) {
+			continue
+		}
+		for _, file1 := range set1.HashMap[file2.Hash] {
+			if file1.RelativePath != file2.RelativePath {
+				continue
+			}
+			// Only a mark on one side, or marks of different lengths, change the size. Swapping UTF-16LE
+			// for UTF-16BE would keep it, but that also re-encodes the text, so the hashes couldn't match.
+			if file1.Size != file2.Size {
+				bom1, ok1 := readBOM(file1)
+				bom2, ok2 := readBOM(file2)
+				if ok1 && ok2 && bom1 != bom2 {
+					differences = append(differences, BOMDifference{Set1File: file1, Set2File: file2, Set1BOM: bom1, Set2BOM: bom2})
+				}
+			}
+			break
+		}
+	}
+
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].Set2File.RelativePath < differences[j].Set2File.RelativePath
+	})
+	return differences, warnings
+}
+
+// describeBOM labels a byte-order mark for display
+func describeBOM(bom string) string {
+	if bom == "" {
+		return "no BOM"
+	}
+	return bom + " BOM"
+}
+
+// printBOMDifferences lists files that are identical except for a byte-order mark
+func printBOMDifferences(differences []BOMDifference) {
+	if len(differences) == 0 {
+		fmt.Println("✅ No files that differ only by a byte-order mark.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("🧾 Files identical except for a byte-order mark (%d files):\n", len(differences))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, difference := range differences {
+		fmt.Printf("   📄 %s — %s: %s, %s: %s\n", difference.Set2File.RelativePath,
+			set1Label, describeBOM(difference.Set1BOM), set2Label, describeBOM(difference.Set2BOM))
+	}
+	fmt.Println()
+}
+
+// removeEmptyDirectories removes directories that have no files and no non-empty children
+func removeEmptyDirectories(node *TreeNode) bool {
+	if !node.IsDir {
+		return true // Keep files
+	}
+
+	// First, recursively process children and remove empty ones
+	for name, child := range node.Children {
+		if !removeEmptyDirectories(child) {
+			delete(node.Children, name)
+		}
+	}
+
+	// A directory should be kept if:
+	// 1. It has files, OR
+	// 2. It has non-empty children
+	return len(node.Files) > 0 || len(node.Children) > 0
+}
+
+// buildSmartTree creates a tree structure that's smart about showing entire directories
+func buildSmartTree(files []*FileInfo, sourceSet *FileSet, otherSet *FileSet) *TreeNode {
+	root := &TreeNode{
+		Name:     "",
+		IsDir:    true,
+		Children: make(map[string]*TreeNode),
+	}
+
+	// Build a map of directory paths to check which directories exist in sourceSet
+	directoriesInSourceSet := make(map[string]bool)
+	for _, file := range sourceSet.Files {
+		dir := filepath.Dir(file.RelativePath)
+		for dir != "." && dir != "" {
+			directoriesInSourceSet[dir] = true
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	for _, file := range files {
+		parts := strings.Split(file.RelativePath, string(filepath.Separator))
+		current := root
+
+		// Navigate/create the directory structure
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				// This is the file
+				current.Files = append(current.Files, file)
+			} else {
+				// This is a directory
+				if current.Children[part] == nil {
+					current.Children[part] = &TreeNode{
+						Name:     part,
+						IsDir:    true,
+						Children: make(map[string]*TreeNode),
+						Parent:   current,
+					}
+				}
+				current = current.Children[part]
+			}
+		}
+	}
+
+	// Mark directories that are entirely missing
+	markEntireDirectoriesNew(root, sourceSet, otherSet, directoriesInSourceSet)
+
+	// Remove empty directories
+	removeEmptyDirectories(root)
+
+	return root
+}
+
+// RootGroup holds the files that came from one root directory of a set
+type RootGroup struct {
+	Root  string
+	Files []*FileInfo
+}
+
+// groupFilesByRoot splits files by their RootDir, ordered as the roots were given
+func groupFilesByRoot(files []*FileInfo, roots []string) []RootGroup {
+	byRoot := make(map[string][]*FileInfo)
+	for _, file := range files {
+		byRoot[file.RootDir] = append(byRoot[file.RootDir], file)
+	}
+
+	var groups []RootGroup
+	for _, root := range roots {
+		if len(byRoot[root]) > 0 {
+			groups = append(groups, RootGroup{Root: root, Files: byRoot[root]})
+			delete(byRoot, root)
+		}
+	}
+
+	// Any files from roots not in the list keep a stable order at the end
+	var remaining []string
+	for root := range byRoot {
+		remaining = append(remaining, root)
+	}
+	sort.Strings(remaining)
+	for _, root := range remaining {
+		groups = append(groups, RootGroup{Root: root, Files: byRoot[root]})
+	}
+	return groups
+}
+
+// printTreeByRoot prints a separate labeled tree for each root directory the files came from
+func printTreeByRoot(files []*FileInfo, sourceSet *FileSet, otherSet *FileSet, treeOpts TreeDisplayOptions, flatten bool) {
+	for _, group := range groupFilesByRoot(files, sourceSet.Roots) {
+		fmt.Printf("📂 %s (%d files):\n", stripPathPrefix(group.Root, treeOpts.StripPrefix), len(group.Files))
+		tree := buildSmartTree(group.Files, sourceSet, otherSet)
+		if flatten {
+			flattenSingleChildDirectories(tree)
+		}
+		printTreeWithOptions(tree, "", true, nil, treeOpts)
+		fmt.Println()
+	}
+}
+
+// markEntireDirectoriesNew is the new implementation that properly handles partial matches
+func markEntireDirectoriesNew(node *TreeNode, sourceSet *FileSet, otherSet *FileSet, directoriesInSourceSet map[string]bool) {
+	if !node.IsDir {
+		return
+	}
+
+	// Recursively process children first
+	for _, child := range node.Children {
+		markEntireDirectoriesNew(child, sourceSet, otherSet, directoriesInSourceSet)
+	}
+
+	// Skip root node
+	if node.Name == "" {
+		node.IsEntireDir = false
+		return
+	}
+
+	// Build the full path for this directory
+	var pathParts []string
+	current := node
+	for current != nil && current.Name != "" {
+		pathParts = append([]string{current.Name}, pathParts...)
+		current = current.Parent
+	}
+	dirPath := strings.Join(pathParts, string(filepath.Separator))
+
+	// Check if this exact directory exists in the source set
+	if !directoriesInSourceSet[dirPath] {
+		// This directory doesn't exist in source set at all, so it can't be "entire"
+		node.IsEntireDir = false
+		return
+	}
+
+	// Count how many files from this directory in sourceSet have no match in otherSet
+	filesInDirCount := 0
+	filesWithoutMatchCount := 0
+
+	for _, sourceFile := range sourceSet.Files {
+		// Check if this file is directly in our directory (not in subdirectories)
+		if filepath.Dir(sourceFile.RelativePath) == dirPath {
+			filesInDirCount++
+			// Check if its content exists in the other set
+			if _, hashExists := otherSet.HashMap[sourceFile.Hash]; !hashExists {
+				filesWithoutMatchCount++
+			}
+		}
+	}
+
+	// A directory can be marked as "entire" only if:
+	// 1. ALL files directly in this directory (not subdirs) have no match in otherSet (or there are no direct files)
+	// 2. ALL child directories are marked as entire (or there are no child directories)
+	// 3. There is at least SOME content (files or subdirs) in this directory
+	allDirectFilesUnmatched := filesInDirCount == 0 || (filesInDirCount > 0 && filesInDirCount == filesWithoutMatchCount)
+
+	allChildrenAreEntire := true
+	hasChildDirs := false
+	for _, child := range node.Children {
+		if child.IsDir {
+			hasChildDirs = true
+			if !child.IsEntireDir {
+				allChildrenAreEntire = false
+				break
+			}
+		}
+	}
+
+	// Directory must have some content (either files or subdirectories)
+	hasContent := filesInDirCount > 0 || hasChildDirs
+
+	if hasContent && allDirectFilesUnmatched && (!hasChildDirs || allChildrenAreEntire) {
+		node.IsEntireDir = true
+	} else {
+		node.IsEntireDir = false
+	}
+}
+
+// markEntireDirectories marks directories where all contents are missing
+func markEntireDirectories(node *TreeNode, sourceSet *FileSet, otherSet *FileSet) {
+	if !node.IsDir {
+		return
+	}
+
+	// Recursively process children first
+	for _, child := range node.Children {
+		markEntireDirectories(child, sourceSet, otherSet)
+	}
+
+	// Skip root node
+	if node.Name == "" {
+		node.IsEntireDir = false
+		return
+	}
+
+	// A directory can be marked as "entire" only if:
+	// 1. It has no child directories, OR all child directories are marked as "entire"
+	// 2. It has files (either directly or in subdirectories)
+	// 3. This is a directory that's actually being shown in our tree (not just a parent of shown files)
+
+	// Check if all children (if any) are marked as entire
+	allChildrenAreEntire := true
+	hasChildren := len(node.Children) > 0
+
+	for _, child := range node.Children {
+		if child.IsDir && !child.IsEntireDir {
+			allChildrenAreEntire = false
+			break
+		}
+	}
+
+	// A leaf directory (no subdirectories) with files
+	if !hasChildren && len(node.Files) > 0 {
+		node.IsEntireDir = true
+	} else if hasChildren && allChildrenAreEntire {
+		// A directory where ALL subdirectories are marked as entire
+		node.IsEntireDir = true
+	} else {
+		node.IsEntireDir = false
+	}
+}
+
+// flattenSingleChildDirectories collapses chains of directories that hold nothing but one
+// subdirectory into a single node named like "a/b/c", so sparse deep trees print compactly.
+// Run it after removeEmptyDirectories; the root node itself is never merged.
+func flattenSingleChildDirectories(node *TreeNode) {
+	merged := make(map[string]*TreeNode, len(node.Children))
+	for _, child := range node.Children {
+		for child.IsDir && !child.IsEntireDir && len(child.Files) == 0 && len(child.Children) == 1 {
+			var only *TreeNode
+			for _, grandchild := range child.Children {
+				only = grandchild
+			}
+			if !only.IsDir {
+				break
+			}
+			child.Name = child.Name + "/" + only.Name
+			child.Files = only.Files
+			child.Children = only.Children
+			child.IsEntireDir = only.IsEntireDir
+			for _, grandchild := range child.Children {
+				grandchild.Parent = child
+			}
+		}
+		flattenSingleChildDirectories(child)
+		merged[child.Name] = child
+	}
+	node.Children = merged
+}
+
+// matchingNameCandidates narrows the same-name files of the other set to those in the same directory
+// as file. When none share its directory, every candidate is returned, since none is a better match.
+func matchingNameCandidates(file *FileInfo, candidates []*FileInfo) []*FileInfo {
+	dir := filepath.Dir(file.RelativePath)
+	var sameDir []*FileInfo
+	for _, candidate := range candidates {
+		if filepath.Dir(candidate.RelativePath) == dir {
+			sameDir = append(sameDir, candidate)
+		}
+	}
+	if len(sameDir) > 0 {
+		return sameDir
+	}
+	return candidates
+}
+
+// formatNameMapping renders the "→" target of a modified file, listing every candidate when it is ambiguous
+func formatNameMapping(candidates []*FileInfo) string {
+	if len(candidates) == 1 {
+		return candidates[0].RelativePath
+	}
+	paths := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		paths[i] = candidate.RelativePath
+	}
+	sort.Strings(paths)
+	return "one of: " + strings.Join(paths, ", ")
+}
+
+// TreeDisplayOptions controls what printTree shows on each file line
+type TreeDisplayOptions struct {
+	ShowDetails bool                 // Append file sizes
+	ShowHashes  bool                 // Append each file's content hash
+	FullHashes  bool                 // Show the full hash instead of the first shortHashLength characters
+	Color       bool                 // Color sizes by magnitude with ANSI escapes
+	StatusTags  map[*FileInfo]string // Status marker printed before each file (--combined)
+	StripPrefix string               // Directory prefix left off root directories in headers (--strip-common-prefix)
+}
+
+// ANSI escapes used for colored output
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+)
+
+// colorBySize wraps text in green below 1MB, yellow below 100MB and red from 100MB up
+func colorBySize(text string, size int64) string {
+	color := ansiRed
+	if size < 1024*1024 {
+		color = ansiGreen
+	} else if size < 100*1024*1024 {
+		color = ansiYellow
+	}
+	return color + text + ansiReset
+}
+
+// useColor decides whether output is colored: not with --no-color, when NO_COLOR is set, or when stdout isn't a terminal
+func useColor(noColorFlag bool) bool {
+	if noColorFlag || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// shortHashLength is how many hash characters --show-hashes prints unless --full-hashes is given
+const shortHashLength = 12
+
+// formatHashForDisplay shortens a hash for tree output unless the full hash was requested
+func formatHashForDisplay(hash string, full bool) string {
+	if full || len(hash) <= shortHashLength {
+		return hash
+	}
+	return hash[:shortHashLength]
+}
+
+// printTree prints the tree structure with proper formatting
+func printTree(node *TreeNode, prefix string, isLast bool, showDetails bool, nameMappings map[string][]*FileInfo) {
+	printTreeWithOptions(node, prefix, isLast, nameMappings, TreeDisplayOptions{ShowDetails: showDetails})
+}
+
+// treeOutputBufferSize is how much tree output is buffered between writes to stdout
+const treeOutputBufferSize = 64 * 1024
+
+// printTreeWithOptions prints the tree structure with the given file line options.
+// Output is buffered so that trees with millions of lines don't cost a write per line.
+func printTreeWithOptions(node *TreeNode, prefix string, isLast bool, nameMappings map[string][]*FileInfo, opts TreeDisplayOptions) {
+	w := bufio.NewWriterSize(os.Stdout, treeOutputBufferSize)
+	writeTree(w, node, prefix, isLast, nameMappings, opts)
+	w.Flush()
+}
+
+// writeTree writes the tree structure to w
+func writeTree(w io.Writer, node *TreeNode, prefix string, isLast bool, nameMappings map[string][]*FileInfo, opts TreeDisplayOptions) {
+	if node.Name != "" {
+		connector := "├── "
+		if isLast {
+			connector = "└── "
+		}
+
+		if node.IsDir {
+			if node.IsEntireDir {
+				fmt.Fprintf(w, "%s%s📁 %s/ (entire directory)\n", prefix, connector, node.Name)
+			} else {
+				fmt.Fprintf(w, "%s%s📁 %s/\n", prefix, connector, node.Name)
+			}
+		}
+
+		if isLast {
+			prefix += "    "
+		} else {
+			prefix += "│   "
+		}
+	}
+
+	// If this directory is marked as "entire", don't print its contents
+	if node.IsEntireDir {
+		return
+	}
+
+	// Print files in this directory
+	for i, file := range node.Files {
+		isLastFile := i == len(node.Files)-1 && len(node.Children) == 0
+		connector := "├── "
+		if isLastFile {
+			connector = "└── "
+		}
+
+		fileOutput := fmt.Sprintf("📄 %s", file.Name)
+		if tag, ok := opts.StatusTags[file]; ok {
+			fileOutput = tag + " " + fileOutput
+		}
+		if opts.ShowDetails {
+			size := fmt.Sprintf("(%.2f KB)", float64(file.Size)/1024.0)
+			if opts.Color {
+				size = colorBySize(size, file.Size)
+			}
+			fileOutput += " " + size
+		}
+		if opts.ShowHashes {
+			fileOutput += fmt.Sprintf(" [%s]", formatHashForDisplay(file.Hash, opts.FullHashes))
+		}
+
+		// Add mapping information for same-name files
+		if nameMappings != nil {
+			if mappedFiles, exists := nameMappings[file.Name]; exists && len(mappedFiles) > 0 {
+				fileOutput += " → " + formatNameMapping(matchingNameCandidates(file, mappedFiles))
+			}
+		}
+
+		fmt.Fprintf(w, "%s%s%s\n", prefix, connector, fileOutput)
+	}
+
+	// Print subdirectories
+	var childNames []string
+	for name := range node.Children {
+		childNames = append(childNames, name)
+	}
+	sort.Strings(childNames)
+
+	for i, name := range childNames {
+		isLastChild := i == len(childNames)-1
+		writeTree(w, node.Children[name], prefix, isLastChild, nameMappings, opts)
+	}
+}
+
+// Status markers of the --combined tree
+const (
+	combinedTagModified = "●"
+	combinedTagUnique2  = "+"
+	combinedTagUnique1  = "−"
+	combinedTagSame     = "="
+)
+
+// buildCombinedTree merges both sets into one tree: every file of set 2 tagged as modified, unique or
+// unchanged, plus the files unique to set 1. It returns the tree and the status tag of each file in it.
+func buildCombinedTree(set2 *FileSet, result *ComparisonResult) (*TreeNode, map[*FileInfo]string) {
+	tags := make(map[*FileInfo]string, len(set2.Files)+len(result.UniqueToSet1))
+	for _, file := range set2.Files {
+		tags[file] = combinedTagSame
+	}
+	for _, file := range result.IgnoredByHash {
+		delete(tags, file)
+	}
+	for _, file := range result.SameNameDifferentHash {
+		tags[file] = combinedTagModified
+	}
+	for _, file := range result.UniqueToSet2 {
+		tags[file] = combinedTagUnique2
+	}
+	for _, file := range result.UniqueToSet1 {
+		tags[file] = combinedTagUnique1
+	}
+
+	files := make([]*FileInfo, 0, len(tags))
+	for file := range tags {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].RelativePath != files[j].RelativePath {
+			return files[i].RelativePath < files[j].RelativePath
+		}
+		return tags[files[i]] < tags[files[j]]
+	})
+	return buildTree(files), tags
+}
+
+// printCombinedTree prints the --combined view of both sets with a legend of the status tags
+func printCombinedTree(set2 *FileSet, result *ComparisonResult, treeOpts TreeDisplayOptions, flatten bool) {
+	tree, tags := buildCombinedTree(set2, result)
+	if flatten {
+		flattenSingleChildDirectories(tree)
+	}
+	treeOpts.StatusTags = tags
+
+	fmt.Printf("🗂️  Combined view of %s and %s (%d files):\n", set1Label, set2Label, len(tags))
+	fmt.Printf("   %s modified   %s unique to %s   %s unique to %s   %s same\n",
+		combinedTagModified, combinedTagUnique2, set2Label, combinedTagUnique1, set1Label, combinedTagSame)
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	printTreeWithOptions(tree, "", true, nil, treeOpts)
+	fmt.Println()
+}
+
+// PresenceRow is one relative path of the --presence-columns listing
+type PresenceRow struct {
+	Path   string
+	InSet1 bool
+	InSet2 bool
+	Same   bool // Present in both with the same content
+}
+
+// buildPresenceRows merges both sets by relative path into one sorted row per path. A path counts as the
+// same when any file at that path in set 1 has the content of any file at that path in set 2.
+func buildPresenceRows(set1, set2 *FileSet) []PresenceRow {
+	hashes := func(fileSet *FileSet) map[string]map[string]bool {
+		byPath := make(map[string]map[string]bool)
+		for _, file := range fileSet.Files {
+			if byPath[file.RelativePath] == nil {
+				byPath[file.RelativePath] = make(map[string]bool)
+			}
+			byPath[file.RelativePath][file.Hash] = true
+		}
+		return byPath
+	}
+	hashes1, hashes2 := hashes(set1), hashes(set2)
+
+	rows := make([]PresenceRow, 0, len(hashes1)+len(hashes2))
+	for path, pathHashes1 := range hashes1 {
+		row := PresenceRow{Path: path, InSet1: true}
+		if pathHashes2, ok := hashes2[path]; ok {
+			row.InSet2 = true
+			for hash := range pathHashes1 {
+				if pathHashes2[hash] {
+					row.Same = true
+					break
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	for path := range hashes2 {
+		if _, ok := hashes1[path]; !ok {
+			rows = append(rows, PresenceRow{Path: path, InSet2: true})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Path < rows[j].Path })
+	return rows
+}
+
+// Markers of the --presence-columns listing
+const (
+	presenceSame    = "✓"
+	presenceDiffers = "≠"
+	presenceMissing = "✗"
+)
+
+// formatPresenceRow renders a row as "[<set 1>][<set 2>] path"
+func formatPresenceRow(row PresenceRow) string {
+	marker := func(present bool) string {
+		switch {
+		case !present:
+			return presenceMissing
+		case row.InSet1 && row.InSet2 && !row.Same:
+			return presenceDiffers
+		default:
+			return presenceSame
+		}
+	}
+	return fmt.Sprintf("[%s][%s] %s", marker(row.InSet1), marker(row.InSet2), row.Path)
+}
+
+// printPresenceColumns prints every path of both sets once with a presence column per set
+func printPresenceColumns(rows []PresenceRow) {
+	fmt.Printf("🧾 Every file of %s and %s (%d paths):\n", set1Label, set2Label, len(rows))
+	fmt.Printf("   [%s][%s]: %s present, %s present with different content, %s missing\n",
+		set1Label, set2Label, presenceSame, presenceDiffers, presenceMissing)
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+
+	w := bufio.NewWriterSize(os.Stdout, treeOutputBufferSize)
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\n", formatPresenceRow(row))
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// SubtreeDigest summarizes the content of a directory subtree independent of its layout
+type SubtreeDigest struct {
+	Digest    string // SHA256 over the sorted hashes of every file in the subtree
+	FileCount int
+}
+
+// DirectoryEquivalence pairs a Set 1 directory with a Set 2 directory holding the same files
+type DirectoryEquivalence struct {
+	Set1Dir   string
+	Set2Dir   string
+	FileCount int
+}
+
+// computeSubtreeDigests hashes the sorted multiset of file hashes under every directory of a set
+func computeSubtreeDigests(fileSet *FileSet) map[string]SubtreeDigest {
+	hashesByDir := make(map[string][]string)
+	for _, file := range fileSet.Files {
+		dir := filepath.Dir(file.RelativePath)
+		for {
+			hashesByDir[dir] = append(hashesByDir[dir], file.Hash)
+			if dir == "." || dir == string(filepath.Separator) {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	digests := make(map[string]SubtreeDigest, len(hashesByDir))
+	for dir, hashes := range hashesByDir {
+		sort.Strings(hashes)
+		hash := sha256.New()
+		for _, fileHash := range hashes {
+			_, _ = io.WriteString(hash, fileHash+"\n") // Writing to a hash never fails
+		}
+		digests[dir] = SubtreeDigest{
+			Digest:    fmt.Sprintf("%x", hash.Sum(nil)),
+			FileCount: len(hashes),
+		}
+	}
+
+	return digests
+}
+
+// findEquivalentDirectories finds directories in both sets whose subtrees contain the same files,
+// reporting only the topmost pair when nested directories are equivalent as well
+func findEquivalentDirectories(set1, set2 *FileSet) []DirectoryEquivalence {
+	digests1 := computeSubtreeDigests(set1)
+	digests2 := computeSubtreeDigests(set2)
+
+	dirsByDigest2 := make(map[string][]string)
+	for dir, digest := range digests2 {
+		dirsByDigest2[digest.Digest] = append(dirsByDigest2[digest.Digest], dir)
+	}
+
+	// Visit shallow directories first so nested matches can be suppressed
+	dirs1 := make([]string, 0, len(digests1))
+	for dir := range digests1 {
+		dirs1 = append(dirs1, dir)
+	}
+	sort.Slice(dirs1, func(i, j int) bool {
+		depthI, depthJ := dirDepth(dirs1[i]), dirDepth(dirs1[j])
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return dirs1[i] < dirs1[j]
+	})
+
+	var equivalences []DirectoryEquivalence
+	for _, dir1 := range dirs1 {
+		matches := dirsByDigest2[digests1[dir1].Digest]
+		sort.Strings(matches)
+
+		for _, dir2 := range matches {
+			covered := false
+			for _, reported := range equivalences {
+				if isWithinDir(reported.Set1Dir, dir1) && isWithinDir(reported.Set2Dir, dir2) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				equivalences = append(equivalences, DirectoryEquivalence{
+					Set1Dir:   dir1,
+					Set2Dir:   dir2,
+					FileCount: digests1[dir1].FileCount,
+				})
+			}
+		}
+	}
+
+	return equivalences
+}
+
+// dirDepth returns how many path components a relative directory has ("." has none)
+func dirDepth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, string(filepath.Separator)) + 1
+}
+
+// isWithinDir reports whether a relative path is, or is located inside, a relative directory ("." contains everything)
+func isWithinDir(dir, path string) bool {
+	return dir == "." || dir == path || isSubPath(dir, path)
+}
+
+// formatDirForDisplay renders a relative directory path with a trailing separator
+func formatDirForDisplay(dir string) string {
+	if dir == "." {
+		return "(root)"
+	}
+	return dir + string(filepath.Separator)
+}
+
+// commonPathPrefix returns the longest directory prefix, ending in a separator, that all paths share, always
+// leaving each path at least its last element. It returns "" when they share nothing beyond the filesystem root.
+func commonPathPrefix(paths []string) string {
+	separator := string(filepath.Separator)
+	var common []string
+	for i, path := range paths {
+		parts := strings.Split(filepath.Clean(path), separator)
+		parts = parts[:len(parts)-1]
+		if i == 0 {
+			common = parts
+			continue
+		}
+
+		shared := 0
+		for shared < len(common) && shared < len(parts) && common[shared] == parts[shared] {
+			shared++
+		}
+		common = common[:shared]
+	}
+
+	prefix := strings.Join(common, separator)
+	if strings.Trim(prefix, separator) == "" || prefix == filepath.VolumeName(prefix) {
+		return ""
+	}
+	return prefix + separator
+}
+
+// stripPathPrefix shows a path relative to prefix, leaving paths outside it (or an empty prefix) untouched
+func stripPathPrefix(path, prefix string) string {
+	if prefix == "" {
+		return path
+	}
+	if cleaned := filepath.Clean(path); strings.HasPrefix(cleaned, prefix) {
+		return cleaned[len(prefix):]
+	}
+	return path
+}
+
+// stripPathPrefixes applies stripPathPrefix to each path
+func stripPathPrefixes(paths []string, prefix string) []string {
+	stripped := make([]string, len(paths))
+	for i, path := range paths {
+		stripped[i] = stripPathPrefix(path, prefix)
+	}
+	return stripped
+}
+
+// printDirectoryEquivalences prints the pairs of content-equivalent directories
+func printDirectoryEquivalences(equivalences []DirectoryEquivalence) {
+	if len(equivalences) == 0 {
+		fmt.Println("✅ No content-equivalent directories found between the sets.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("🧬 Content-equivalent directories (%d pairs) - %s ≡ %s:\n", len(equivalences), set1Label, set2Label)
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, equivalence := range equivalences {
+		fmt.Printf("   📁 %s ≡ %s (%d files)\n",
+			formatDirForDisplay(equivalence.Set1Dir), formatDirForDisplay(equivalence.Set2Dir), equivalence.FileCount)
+	}
+	fmt.Println()
+}
+
+// findLongPaths returns the files whose relative path is longer than maxLength characters, longest first.
+// Lengths count characters rather than bytes, since that's how path limits like Windows' 260 are measured.
+func findLongPaths(files []*FileInfo, maxLength int) []*FileInfo {
+	var long []*FileInfo
+	for _, file := range files {
+		if utf8.RuneCountInString(file.RelativePath) > maxLength {
+			long = append(long, file)
+		}
+	}
+	sort.Slice(long, func(i, j int) bool {
+		li, lj := utf8.RuneCountInString(long[i].RelativePath), utf8.RuneCountInString(long[j].RelativePath)
+		if li != lj {
+			return li > lj
+		}
+		return long[i].RelativePath < long[j].RelativePath
+	})
+	return long
+}
+
+// printLongPaths lists the files of set 2 that would exceed a destination's path length limit
+func printLongPaths(files []*FileInfo, maxLength int) {
+	if len(files) == 0 {
+		fmt.Printf("✅ No paths in %s longer than %d characters.\n", set2Label, maxLength)
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("📏 Paths in %s longer than %d characters (%d files):\n", set2Label, maxLength, len(files))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, file := range files {
+		fmt.Printf("   %4d  %s\n", utf8.RuneCountInString(file.RelativePath), file.RelativePath)
+	}
+	fmt.Println()
+}
+
+// CountParity is a directory present in both sets that directly holds a different number of files in each
+type CountParity struct {
+	Dir       string
+	Set1Count int
+	Set2Count int
+}
+
+// findCountParityMismatches walks the directory trees of both sets side by side and returns, sorted by path,
+// every directory present in both whose own file count differs. Content plays no part.
+func findCountParityMismatches(set1, set2 *FileSet) []CountParity {
+	var mismatches []CountParity
+	var walk func(node1, node2 *TreeNode, dir string)
+	walk = func(node1, node2 *TreeNode, dir string) {
+		if len(node1.Files) != len(node2.Files) {
+			mismatches = append(mismatches, CountParity{Dir: dir, Set1Count: len(node1.Files), Set2Count: len(node2.Files)})
+		}
+		for name, child1 := range node1.Children {
+			if child2, ok := node2.Children[name]; ok {
+				walk(child1, child2, filepath.Join(dir, name))
+			}
+		}
+	}
+	walk(buildTree(set1.Files), buildTree(set2.Files), ".")
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Dir < mismatches[j].Dir })
+	return mismatches
+}
+
+// printCountParityMismatches lists directories whose file counts differ between the sets
+func printCountParityMismatches(mismatches []CountParity) {
+	if len(mismatches) == 0 {
+		fmt.Println("✅ Every directory present in both sets holds the same number of files.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("🔢 Directories with different file counts (%d directories):\n", len(mismatches))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, mismatch := range mismatches {
+		fmt.Printf("   📁 %s — %d in %s, %d in %s\n", formatDirForDisplay(mismatch.Dir), mismatch.Set1Count, set1Label, mismatch.Set2Count, set2Label)
+	}
+	fmt.Println()
+}
+
+// DirectoryCoverage counts how many of a set 1 directory's files have identical content in set 2
+type DirectoryCoverage struct {
+	Dir       string
+	Identical int
+	Total     int
+}
+
+// identicalCountsByDirectory counts, per directory of set 1, the files whose content exists in set 2.
+// Files ignored through the hash blocklist don't count towards the total.
+func identicalCountsByDirectory(set1 *FileSet, result *ComparisonResult) []DirectoryCoverage {
+	ignored := make(map[*FileInfo]bool, len(result.IgnoredByHash))
+	for _, file := range result.IgnoredByHash {
+		ignored[file] = true
+	}
+
+	byDir := make(map[string]*DirectoryCoverage)
+	coverageFor := func(file *FileInfo) *DirectoryCoverage {
+		dir := filepath.Dir(file.RelativePath)
+		if byDir[dir] == nil {
+			byDir[dir] = &DirectoryCoverage{Dir: dir}
+		}
+		return byDir[dir]
+	}
+	for _, file := range set1.Files {
+		if !ignored[file] {
+			coverageFor(file).Total++
+		}
+	}
+	for _, file := range result.IdenticalInSet1 {
+		coverageFor(file).Identical++
+	}
+
+	coverage := make([]DirectoryCoverage, 0, len(byDir))
+	for _, dirCoverage := range byDir {
+		coverage = append(coverage, *dirCoverage)
+	}
+	sort.Slice(coverage, func(i, j int) bool { return coverage[i].Dir < coverage[j].Dir })
+	return coverage
+}
+
+// printIdenticalCountsByDirectory prints how completely each set 1 directory is present in set 2
+func printIdenticalCountsByDirectory(coverage []DirectoryCoverage) {
+	fmt.Printf("🗃️  Files of %s present and identical in %s, by directory:\n", set1Label, set2Label)
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, dir := range coverage {
+		icon := "✅"
+		if dir.Identical < dir.Total {
+			icon = "⚠️ "
+		}
+		fmt.Printf("   %s %s: %d/%d files present and identical in %s\n", icon, formatDirForDisplay(dir.Dir), dir.Identical, dir.Total, set2Label)
+	}
+	fmt.Println()
+}
+
+// DirectoryStats counts the differing files located directly in one directory
+type DirectoryStats struct {
+	Dir       string
+	FileCount int
+	TotalSize int64
+}
+
+// collectDirectoryStats gathers per-directory file counts from a tree built with buildTree
+func collectDirectoryStats(node *TreeNode, dir string, stats *[]DirectoryStats) {
+	if len(node.Files) > 0 {
+		entry := DirectoryStats{Dir: dir, FileCount: len(node.Files)}
+		for _, file := range node.Files {
+			entry.TotalSize += file.Size
+		}
+		*stats = append(*stats, entry)
+	}
+
+	for name, child := range node.Children {
+		childDir := name
+		if dir != "." {
+			childDir = filepath.Join(dir, name)
+		}
+		collectDirectoryStats(child, childDir, stats)
+	}
+}
+
+// rankDirectoriesByDifferences returns up to limit directories holding the most differing files,
+// breaking ties by total size and then by path
+func rankDirectoriesByDifferences(files []*FileInfo, limit int) []DirectoryStats {
+	var stats []DirectoryStats
+	collectDirectoryStats(buildTree(files), ".", &stats)
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].FileCount != stats[j].FileCount {
+			return stats[i].FileCount > stats[j].FileCount
+		}
+		if stats[i].TotalSize != stats[j].TotalSize {
+			return stats[i].TotalSize > stats[j].TotalSize
+		}
+		return stats[i].Dir < stats[j].Dir
+	})
+
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+// printTopDirectories prints the directories with the most differences
+func printTopDirectories(stats []DirectoryStats) {
+	if len(stats) == 0 {
+		fmt.Println("✅ No differing files to rank by directory.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("🔥 Top %d directories by number of differences:\n", len(stats))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for i, entry := range stats {
+		fmt.Printf("   %2d. 📁 %s — %d files (%s)\n", i+1, formatDirForDisplay(entry.Dir), entry.FileCount, formatSize(entry.TotalSize))
+	}
+	fmt.Println()
+}
+
+// DirectoryChange counts the differences found under one top-level directory
+type DirectoryChange struct {
+	Dir          string // Top-level directory relative to the set roots ("." for files directly in a root)
+	Modified     int
+	UniqueToSet2 int
+	UniqueToSet1 int
+}
+
+// topLevelDir returns the first directory component of a relative path, or "." for files at the root
+func topLevelDir(relativePath string) string {
+	parts := strings.SplitN(filepath.ToSlash(relativePath), "/", 2)
+	if len(parts) < 2 {
+		return "."
+	}
+	return parts[0]
+}
+
+// rollUpToDirectories treats each top-level directory as an opaque unit and counts its differences
+func rollUpToDirectories(modified, uniqueToSet2, uniqueToSet1 []*FileInfo) []DirectoryChange {
+	byDir := make(map[string]*DirectoryChange)
+	get := func(file *FileInfo) *DirectoryChange {
+		dir := topLevelDir(file.RelativePath)
+		if byDir[dir] == nil {
+			byDir[dir] = &DirectoryChange{Dir: dir}
+		}
+		return byDir[dir]
+	}
+
+	for _, file := range modified {
+		get(file).Modified++
+	}
+	for _, file := range uniqueToSet2 {
+		get(file).UniqueToSet2++
+	}
+	for _, file := range uniqueToSet1 {
+		get(file).UniqueToSet1++
+	}
+
+	changes := make([]DirectoryChange, 0, len(byDir))
+	for _, change := range byDir {
+		changes = append(changes, *change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Dir < changes[j].Dir
+	})
+	return changes
+}
+
+// printDirectoryChanges prints one line per changed top-level directory
+func printDirectoryChanges(changes []DirectoryChange) {
+	if len(changes) == 0 {
+		fmt.Println("✅ No directories contain differences.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("📦 Changed directories (%d):\n", len(changes))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for _, change := range changes {
+		var parts []string
+		if change.Modified > 0 {
+			parts = append(parts, fmt.Sprintf("%d modified", change.Modified))
+		}
+		if change.UniqueToSet2 > 0 {
+			parts = append(parts, fmt.Sprintf("%d unique to %s", change.UniqueToSet2, set2Label))
+		}
+		if change.UniqueToSet1 > 0 {
+			parts = append(parts, fmt.Sprintf("%d unique to %s", change.UniqueToSet1, set1Label))
+		}
+		fmt.Printf("   📁 %s — %s\n", formatDirForDisplay(change.Dir), strings.Join(parts, ", "))
+	}
+	fmt.Println()
+}
+
+// countTreeItems counts total files and directories in the tree
+func countTreeItems(node *TreeNode) (files int, dirs int) {
+	files += len(node.Files)
+
+	for _, child := range node.Children {
+		if child.IsDir {
+			dirs++
+			childFiles, childDirs := countTreeItems(child)
+			files += childFiles
+			dirs += childDirs
+		}
+	}
+
+	return files, dirs
+}
+
+// buildTree creates a simple tree structure from the list of files
+func buildTree(files []*FileInfo) *TreeNode {
+	root := &TreeNode{
+		Name:     "",
+		IsDir:    true,
+		Children: make(map[string]*TreeNode),
+	}
+
+	for _, file := range files {
+		parts := strings.Split(file.RelativePath, string(filepath.Separator))
+		current := root
+
+		// Navigate/create the directory structure
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				// This is the file
+				current.Files = append(current.Files, file)
+			} else {
+				// This is a directory
+				if current.Children[part] == nil {
+					current.Children[part] = &TreeNode{
+						Name:     part,
+						IsDir:    true,
+						Children: make(map[string]*TreeNode),
+						Parent:   current,
+					}
+				}
+				current = current.Children[part]
+			}
+		}
+	}
+
+	return root
+}
+
+// getOSSpecificExamples returns example paths and descriptions based on the current OS
+func getOSSpecificExamples() (string, string, string, string) {
+	if runtime.GOOS == "windows" {
+		return "C:\\Photos\\2023", "D:\\Backup\\Photos",
 			"C:\\Photos\\2023,C:\\Photos\\2024", "D:\\Backup\\Photos"
 	}
-	return "/home/user/photos/2023", "/home/user/backup/photos",
-		"/home/user/photos/2023,/home/user/photos/2024", "/home/user/backup/photos"
+	return "/home/user/photos/2023", "/home/user/backup/photos",
+		"/home/user/photos/2023,/home/user/photos/2024", "/home/user/backup/photos"
+}
+
+// readUserInput reads a line of input from the user with a prompt
+func readUserInput(prompt string) string {
+	fmt.Print(prompt)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	return strings.TrimSpace(scanner.Text())
+}
+
+// readYesNo reads a yes/no response from the user
+func readYesNo(prompt string) bool {
+	for {
+		response := strings.ToLower(readUserInput(prompt))
+		if response == "y" || response == "yes" {
+			return true
+		}
+		if response == "n" || response == "no" {
+			return false
+		}
+		fmt.Println("Please enter 'y' or 'n'")
+	}
+}
+
+// runInteractiveMode runs the tool in interactive mode when no arguments are provided
+func runInteractiveMode(execName string) ([]string, []string, bool, bool, bool, bool) {
+	fmt.Println("Directory Comparison Tool - Interactive Mode")
+	fmt.Println("=============================================")
+	fmt.Println()
+	fmt.Println("No arguments provided. Starting interactive mode...")
+	fmt.Println()
+
+	example1, example2, multiExample1, _ := getOSSpecificExamples()
+
+	fmt.Printf("Example: If you want to compare your photos folder with your backup:\n")
+	fmt.Printf("- Set 1 could be: %s\n", example1)
+	fmt.Printf("- Set 2 could be: %s\n", example2)
+	fmt.Println()
+
+	set1Input := readUserInput(fmt.Sprintf("Enter Set 1 directories (comma-separated if multiple):\nExample: %s or %s\n> ", example1, multiExample1))
+	for set1Input == "" {
+		fmt.Println("Set 1 directories cannot be empty.")
+		set1Input = readUserInput("> ")
+	}
+
+	set2Input := readUserInput(fmt.Sprintf("Enter Set 2 directories (comma-separated if multiple):\nExample: %s\n> ", example2))
+	for set2Input == "" {
+		fmt.Println("Set 2 directories cannot be empty.")
+		set2Input = readUserInput("> ")
+	}
+
+	fmt.Println()
+	showModified := readYesNo("Show files that were modified (same name, different content)? (y/n): ")
+	showUniqueToSet2 := readYesNo("Show files unique to Set 2 (files in Set 2 not in Set 1)? (y/n): ")
+	showUniqueToSet1 := readYesNo("Show files unique to Set 1 (files in Set 1 not in Set 2)? (y/n): ")
+	showDetails := readYesNo("Show file size details? (y/n): ")
+
+	set1Dirs := strings.Split(set1Input, ",")
+	set2Dirs := strings.Split(set2Input, ",")
+
+	// Clean up directory paths
+	for i := range set1Dirs {
+		set1Dirs[i] = strings.TrimSpace(set1Dirs[i])
+	}
+	for i := range set2Dirs {
+		set2Dirs[i] = strings.TrimSpace(set2Dirs[i])
+	}
+
+	// Show preview
+	fmt.Println()
+	fmt.Println("📋 Let's show you a quick preview with the first 10 files...")
+	fmt.Println()
+	runPreview(set1Dirs, set2Dirs, 10, showDetails, showModified, showUniqueToSet1, showUniqueToSet2, ScanOptions{}, CompareOptions{})
+
+	fmt.Println()
+	if !readYesNo("Continue with full scan? (y/n): ") {
+		fmt.Println("Exiting...")
+		os.Exit(0)
+	}
+
+	fmt.Println()
+	return set1Dirs, set2Dirs, showModified, showUniqueToSet2, showUniqueToSet1, showDetails
+}
+
+// Review actions recorded by --interactive-review
+const (
+	ReviewKeepSet1 = "keep-set1"
+	ReviewKeepSet2 = "keep-set2"
+	ReviewSkip     = "skip"
+)
+
+// ReviewDecision records what the user chose to do with one modified file
+type ReviewDecision struct {
+	Action   string
+	Set1File *FileInfo // The Set 1 file with the same name (may be nil)
+	Set2File *FileInfo // The modified file from Set 2
+}
+
+// parseReviewChoice maps a review prompt answer to an action; quit is true when the user wants to stop
+func parseReviewChoice(response string) (action string, quit bool, ok bool) {
+	switch strings.ToLower(response) {
+	case "1":
+		return ReviewKeepSet1, false, true
+	case "2":
+		return ReviewKeepSet2, false, true
+	case "s", "skip", "":
+		return ReviewSkip, false, true
+	case "q", "quit":
+		return "", true, true
+	}
+	return "", false, false
+}
+
+// runInteractiveReview walks through each modified file and asks which version to keep
+func runInteractiveReview(result *ComparisonResult) []ReviewDecision {
+	files := make([]*FileInfo, len(result.SameNameDifferentHash))
+	copy(files, result.SameNameDifferentHash)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].RelativePath < files[j].RelativePath
+	})
+
+	fmt.Printf("🔎 Reviewing %d modified files\n", len(files))
+	fmt.Println("=" + strings.Repeat("=", 50))
+
+	decisions := make([]ReviewDecision, 0, len(files))
+	for i, file2 := range files {
+		var file1 *FileInfo
+		if candidates := matchingNameCandidates(file2, result.NameMappings[file2.Name]); len(candidates) > 0 {
+			file1 = candidates[0]
+		}
+
+		fmt.Println()
+		fmt.Printf("[%d/%d] 📄 %s\n", i+1, len(files), file2.RelativePath)
+		if file1 != nil {
+			fmt.Printf("   %s: %s (%s, modified %s)\n", set1Label, file1.AbsolutePath, formatSize(file1.Size), file1.ModTime.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("   %s: %s (%s, modified %s)\n", set2Label, file2.AbsolutePath, formatSize(file2.Size), file2.ModTime.Format("2006-01-02 15:04:05"))
+
+		for {
+			action, quit, ok := parseReviewChoice(readUserInput(fmt.Sprintf("Keep [1] %s, [2] %s, [s]kip, [q]uit: ", set1Label, set2Label)))
+			if !ok {
+				fmt.Println("Please enter 1, 2, s or q")
+				continue
+			}
+			if quit {
+				return decisions
+			}
+			decisions = append(decisions, ReviewDecision{Action: action, Set1File: file1, Set2File: file2})
+			break
+		}
+	}
+
+	return decisions
+}
+
+// formatReviewDecision renders a decision as a tab-separated action line
+func formatReviewDecision(decision ReviewDecision) string {
+	set1Path := "-"
+	if decision.Set1File != nil {
+		set1Path = decision.Set1File.AbsolutePath
+	}
+	return fmt.Sprintf("%s\t%s\t%s", decision.Action, set1Path, decision.Set2File.AbsolutePath)
+}
+
+// printReviewDecisions prints the action list produced by an interactive review
+func printReviewDecisions(decisions []ReviewDecision) {
+	fmt.Println()
+	fmt.Printf("📝 Review decisions (%d files):\n", len(decisions))
+	for _, decision := range decisions {
+		fmt.Printf("   %s\n", formatReviewDecision(decision))
+	}
+	fmt.Println()
+}
+
+// writeReviewDecisions saves the action list to a file, one tab-separated decision per line
+func writeReviewDecisions(path string, decisions []ReviewDecision) error {
+	var builder strings.Builder
+	builder.WriteString("# action\tset1_path\tset2_path\n")
+	for _, decision := range decisions {
+		builder.WriteString(formatReviewDecision(decision))
+		builder.WriteString("\n")
+	}
+	return os.WriteFile(path, []byte(builder.String()), 0o600)
+}
+
+func main() {
+	execName := filepath.Base(os.Args[0])
+
+	var set1Dirs, set2Dirs []string
+	var showDetails, showUniqueToSet1, showModified, showUniqueToSet2 bool
+	var title string
+	var scanOpts ScanOptions
+	var interactiveReview bool
+	var showDirEquivalence bool
+	var verbose bool
+	var showTimestampOnly bool
+	var showMoves bool
+	var snapshotPaths []string
+	var topDirs int
+	var directoryGranularity bool
+	var compareACLs bool
+	var groupByRoot bool
+	var flattenTree bool
+	var stripCommonPrefix bool
+	var combinedTree bool
+	var presenceColumns bool
+	var showHashes, fullHashes bool
+	var noColor bool
+	var hashAll bool
+	var parallelSets bool
+	var reportIdenticalByDir bool
+	var maxPathLength int
+	var countParity bool
+	var preflight bool
+	var anonymize bool
+	var failOn map[string]bool
+	var reportMemory bool
+	var deadline time.Duration
+	var execOpts ExecOptions
+	var anonymizeMapPath string
+	var anonymizer *Anonymizer
+	var isEstimate bool
+	var estimateThroughput float64
+	var compareOpts CompareOptions
+	var checkpointPath string
+	var resume bool
+	var reviewOutPath string
+	var manifestIn *Manifest
+	var manifestInSet *FileSet
+
+	// Built-in sanity check of the binary on this platform
+	if len(os.Args) == 2 && os.Args[1] == "--selftest" {
+		if !runSelfTest() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Manifest modes put a file before the usual positional arguments; shift it out so the
+	// rest of the command line parses like a normal run
+	commandArgs := os.Args[1:]
+	leadingMode := len(os.Args) > 1 && leadingModeFlags[os.Args[1]]
+	var exportManifestPath string
+	var manifestPaths []string
+	var manifestInPath string
+	var coveragePaths []string
+	if len(os.Args) >= 4 && os.Args[1] == "--compare-manifests" {
+		manifestPaths = []string{os.Args[2], os.Args[3]}
+		os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+	} else if len(os.Args) >= 4 && os.Args[1] == "--manifest-in" {
+		// The manifest stands in for the first set; the second set is scanned live
+		manifestInPath = os.Args[2]
+		os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+	} else if len(os.Args) >= 4 && os.Args[1] == "--export-manifest" {
+		// Only one set is scanned when exporting; it fills both positional slots
+		exportManifestPath = os.Args[2]
+		os.Args = append([]string{os.Args[0], os.Args[3]}, os.Args[3:]...)
+	} else if len(os.Args) >= 4 && os.Args[1] == "--coverage" {
+		// Only the live set is scanned; like exporting, it fills both positional slots
+		coveragePaths = strings.Split(os.Args[2], ",")
+		os.Args = append([]string{os.Args[0], os.Args[3]}, os.Args[3:]...)
+	}
+
+	// Default directory pair from the environment when only flags (or nothing) were given
+	if !leadingMode {
+		if args, ok := argsWithEnvironmentSets(os.Args); ok {
+			fmt.Printf("📌 Using directories from %s and %s\n", envSet1, envSet2)
+			os.Args = args
+		}
+	}
+
+	if len(os.Args) < 3 {
+		// Interactive mode or show help
+		if len(os.Args) == 1 {
+			// No arguments - start interactive mode
+			set1Dirs, set2Dirs, showModified, showUniqueToSet2, showUniqueToSet1, showDetails = runInteractiveMode(execName)
+		} else {
+			// Not enough arguments - show help
+			example1, example2, multiExample1, multiExample2 := getOSSpecificExamples()
+
+			fmt.Println("Directory Comparison Tool")
+			fmt.Println("=========================")
+			fmt.Println()
+			fmt.Printf("Usage: %s <set1_dirs> <set2_dirs> [options]\n", execName)
+			fmt.Printf("       %s --selftest    Verify the tool works correctly on this platform\n", execName)
+			fmt.Printf("       %s --export-manifest FILE <dirs> [options]   Hash one set into a JSON manifest\n", execName)
+			fmt.Printf("       %s --compare-manifests A.json B.json [options]   Compare two manifests without rescanning\n", execName)
+			fmt.Printf("       %s --manifest-in A.json <set2_dirs> [options]   Compare a manifest against directories, hashing them to match\n", execName)
+			fmt.Printf("       %s --coverage A.json,B.json <dirs> [options]   List files whose content is in none of the manifests\n", execName)
+			fmt.Println()
+			fmt.Println("Arguments:")
+			fmt.Println("  set1_dirs    Comma-separated list of directories in the first set")
+			fmt.Println("  set2_dirs    Comma-separated list of directories in the second set")
+			fmt.Println("               Entries may be remote: sftp://[user@]host[:port]/path (downloaded and hashed locally)")
+			fmt.Println("               or ssh://[user@]host[:port]/path (hashed there; needs a POSIX shell and coreutils)")
+			fmt.Printf("               Both may be omitted when %s and %s are set\n", envSet1, envSet2)
+			fmt.Println()
+			fmt.Println("Options:")
+			fmt.Println("  --details         Show file sizes and additional details (colored by size on a terminal)")
+			fmt.Println("  --no-color        Disable colored output (also disabled by NO_COLOR or when output isn't a terminal)")
+			fmt.Println("  --show-modified   Show files with same name but different content")
+			fmt.Println("  --show-unique-2   Show files unique to set 2")
+			fmt.Println("  --show-unique-1   Show files unique to set 1")
+			fmt.Println("  --preview         Show preview with first 10 files")
+			fmt.Println("  --preview-count N Set number of files to process in preview mode")
+			fmt.Println("  --stable-sample   Pick preview files by a hash of their path, the same on every run and machine (walks every file)")
+			fmt.Println("  --estimate        Count files and sizes without hashing and estimate the run time")
+			fmt.Println("  --estimate-throughput SIZE  Assume SIZE per second (e.g. 150MB) instead of measuring a sample")
+			fmt.Println("  --title TEXT      Title printed in the report header")
+			fmt.Println("  --label1 NAME     Call the first set NAME instead of \"Set 1\" in the output (e.g. backup)")
+			fmt.Println("  --label2 NAME     Call the second set NAME instead of \"Set 2\" in the output (e.g. live)")
+			fmt.Println("  --filter EXPR     Only compare files matching EXPR, e.g. 'size>100MB || age<7d'")
+			fmt.Println("  --base DIR        Resolve relative set directories against DIR instead of the working directory")
+			fmt.Println("  --hash ALGO       Content hash to use: sha256 (default), git (git blob IDs, as in 'git ls-tree') or md5")
+			fmt.Println("  --ignore-trailing-nulls  Treat files that differ only in trailing null padding as identical")
+			fmt.Println("  --ignore-bom      Treat text files that differ only by a UTF-8/UTF-16 byte-order mark as identical")
+			fmt.Println("  --hash-skip-bytes N   Leave each file's first N bytes out of the hash (e.g. a header with a timestamp)")
+			fmt.Println("  --hash-limit-bytes M  Hash at most M bytes of each file; files matching in that region count as identical")
+			fmt.Println("  --hash-all        Hash every file, even same-name files whose different sizes already prove a change")
+			fmt.Println("  --parallel-sets   Scan both sets at the same time: faster on SSDs or separate disks, slower on one HDD")
+			fmt.Println("  --buffer-size SIZE  Read buffer per hashing worker (default 32KB); larger helps big files on fast disks")
+			fmt.Println("  --checkpoint FILE Record every hashed file in FILE so an interrupted run can be resumed")
+			fmt.Printf("  --resume          Reuse hashes from the checkpoint (default %s) and only hash the rest\n", defaultCheckpointPath)
+			fmt.Println("  --no-warnings     Hide per-file warnings and report only how many occurred")
+			fmt.Println("  --verbose         With --no-warnings, list the hidden warnings at the end")
+			fmt.Println("  --report-memory   Print the peak heap size and other memory statistics of the run")
+			fmt.Printf("  --deadline DURATION  Stop scanning after DURATION (e.g. 30m) and report partial results (exit code %d)\n", exitCodePartial)
+			fmt.Println("  --exec 'CMD'      Run CMD for each differing file, filling in {path}, {relpath}, {hash} and {size}")
+			fmt.Println("  --exec-parallel N Run up to N --exec commands at once (default 1)")
+			fmt.Println("  --exec-continue   Keep running --exec commands after one fails (default: stop)")
+			fmt.Printf("  --fail-on LIST    Exit with code %d if any listed difference exists: %s, %s, %s (e.g. modified,unique1)\n", exitCodeDifferences, failOnModified, failOnUnique1, failOnUnique2)
+			fmt.Println("  --anonymize       Replace every file and directory name in the report with a stable placeholder")
+			fmt.Println("  --anonymize-map FILE  Like --anonymize, and save the placeholder-to-name map to FILE")
+			fmt.Println("  --count-parity    List directories present in both sets whose number of files differs")
+			fmt.Println("  --preflight       Check that every directory exists and is readable before scanning; stop if one isn't")
+			fmt.Println("  --max-path-length N  List files of set 2 whose relative path is longer than N characters (e.g. 260)")
+			fmt.Println("  --top-dirs N      Rank the N directories containing the most differences")
+			fmt.Println("  --directory-granularity  List changed top-level directories instead of individual files")
+			fmt.Println("  --group-by-root       Print unique files as one tree per root directory of their set")
+			fmt.Println("  --flatten-single-child  Collapse chains of single-child directories into one line, e.g. a/b/c/")
+			fmt.Println("  --strip-common-prefix   Print the directory shared by all set directories once and show them relative to it")
+			fmt.Printf("  --combined        Show one tree of both sets, tagging files %s modified, %s unique to set 2, %s unique to set 1, %s same\n", combinedTagModified, combinedTagUnique2, combinedTagUnique1, combinedTagSame)
+			fmt.Printf("  --presence-columns  List every path once as [set 1][set 2] %s/%s/%s, e.g. [%s][%s] photos/img1.jpg\n", presenceSame, presenceDiffers, presenceMissing, presenceSame, presenceMissing)
+			fmt.Printf("  --show-hashes     Append each file's hash (first %d characters) to tree lines\n", shortHashLength)
+			fmt.Println("  --full-hashes     Like --show-hashes, but print the full hash")
+			fmt.Println("  --compare-acls        (Linux) Report same-content files whose POSIX ACLs or permissions differ")
+			fmt.Println("  --ignore-paths    Match purely by content: a file is unique if its content exists nowhere in the other set")
+			fmt.Println("  --loose-names     Treat names differing only in case or accents (Résumé.PDF, resume.pdf) as the same name")
+			fmt.Println("  --ignore-hashes FILE  Never report files whose hash is listed in FILE (one per line, sha256sum output works)")
+			fmt.Println("  --only-modified-content  Flag only content changes; list timestamp-only changes separately")
+			fmt.Println("  --show-moves      List directories moved between the sets as one 'old/ → new/' line each")
+			fmt.Println("  --snapshot-out F1 F2  Write sorted '<path>\\t<hash>' listings of each set to F1 and F2")
+			fmt.Println("  --dir-equivalence     Show directories holding the same files in both sets, ignoring layout")
+			fmt.Println("  --report-identical-count-by-dir  Per set 1 directory, count files present and identical in set 2")
+			fmt.Println("  --interactive-review  Decide file by file which version of each modified file to keep")
+			fmt.Println("  --review-out FILE     Save review decisions to FILE")
+			fmt.Println()
+			fmt.Println("Example:")
+			fmt.Printf("  %s %s %s\n", execName, multiExample1, multiExample2)
+			fmt.Printf("  %s %s %s --details --show-unique-1\n", execName, example1, example2)
+			fmt.Println()
+			fmt.Println("Or run without arguments for interactive mode:")
+			fmt.Printf("  %s\n", execName)
+			os.Exit(1)
+		}
+	} else {
+		// Command line mode
+		set1Dirs = strings.Split(os.Args[1], ",")
+		set2Dirs = strings.Split(os.Args[2], ",")
+
+		// Parse flags
+		var isPreview bool
+		var previewCount int = 10 // default preview count
+		for i := 3; i < len(os.Args); i++ {
+			switch os.Args[i] {
+			case "--details":
+				showDetails = true
+			case "--show-unique-1":
+				showUniqueToSet1 = true
+			case "--show-unique-2":
+				showUniqueToSet2 = true
+			case "--show-modified":
+				showModified = true
+			case "--preview":
+				isPreview = true
+			case "--estimate":
+				isEstimate = true
+			case "--estimate-throughput":
+				if i+1 < len(os.Args) {
+					bytesPerSecond, err := parseSize(strings.TrimSuffix(os.Args[i+1], "/s"))
+					if err != nil || bytesPerSecond <= 0 {
+						fmt.Printf("❌ Invalid throughput %q: expected a size per second such as 150MB\n", os.Args[i+1])
+						os.Exit(1)
+					}
+					estimateThroughput = float64(bytesPerSecond)
+					i++ // skip next argument
+				}
+			case "--preview-count":
+				if i+1 < len(os.Args) {
+					if count, err := strconv.Atoi(os.Args[i+1]); err != nil || count < 1 {
+						fmt.Printf("Invalid preview count: %s. Using default of 10.\n", os.Args[i+1])
+						previewCount = 10
+					} else {
+						previewCount = count
+					}
+					i++ // skip next argument
+				}
+				isPreview = true
+			case "--stable-sample":
+				scanOpts.StableSample = true
+			case "--title":
+				if i+1 < len(os.Args) {
+					title = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--filter":
+				if i+1 < len(os.Args) {
+					filter, err := parseFilter(os.Args[i+1])
+					if err != nil {
+						fmt.Printf("❌ Invalid filter %q: %v\n", os.Args[i+1], err)
+						os.Exit(1)
+					}
+					scanOpts.Filter = filter
+					i++ // skip next argument
+				}
+			case "--base":
+				if i+1 < len(os.Args) {
+					scanOpts.BaseDir = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--no-warnings":
+				scanOpts.QuietWarnings = true
+			case "--verbose":
+				verbose = true
+			case "--snapshot-out":
+				if i+2 < len(os.Args) {
+					snapshotPaths = []string{os.Args[i+1], os.Args[i+2]}
+					i += 2 // skip both file arguments
+				}
+			case "--group-by-root":
+				groupByRoot = true
+			case "--flatten-single-child":
+				flattenTree = true
+			case "--strip-common-prefix":
+				stripCommonPrefix = true
+			case "--combined":
+				combinedTree = true
+			case "--presence-columns":
+				presenceColumns = true
+			case "--label1":
+				if i+1 < len(os.Args) {
+					set1Label = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--label2":
+				if i+1 < len(os.Args) {
+					set2Label = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--ignore-trailing-nulls":
+				scanOpts.IgnoreTrailingNulls = true
+			case "--ignore-bom":
+				scanOpts.IgnoreBOM = true
+			case "--hash-skip-bytes", "--hash-limit-bytes":
+				if i+1 < len(os.Args) {
+					size, err := parseSize(os.Args[i+1])
+					if err != nil || size <= 0 {
+						fmt.Printf("❌ Invalid %s %q: expected a positive size such as 512 or 4KB\n", os.Args[i], os.Args[i+1])
+						os.Exit(1)
+					}
+					if os.Args[i] == "--hash-skip-bytes" {
+						scanOpts.HashSkipBytes = size
+					} else {
+						scanOpts.HashLimitBytes = size
+					}
+					i++ // skip next argument
+				}
+			case "--hash-all":
+				hashAll = true
+			case "--parallel-sets":
+				parallelSets = true
+			case "--no-color":
+				noColor = true
+			case "--show-hashes":
+				showHashes = true
+			case "--full-hashes":
+				showHashes = true
+				fullHashes = true
+			case "--compare-acls":
+				if !aclSupported {
+					fmt.Println("❌ --compare-acls is only supported on Linux")
+					os.Exit(1)
+				}
+				compareACLs = true
+			case "--directory-granularity":
+				directoryGranularity = true
+			case "--exec":
+				if i+1 < len(os.Args) {
+					execOpts.Command = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--exec-parallel":
+				if i+1 < len(os.Args) {
+					count, err := strconv.Atoi(os.Args[i+1])
+					if err != nil || count < 1 {
+						fmt.Printf("❌ Invalid --exec-parallel count: %s\n", os.Args[i+1])
+						os.Exit(1)
+					}
+					execOpts.Parallel = count
+					i++ // skip next argument
+				}
+			case "--exec-continue":
+				execOpts.ContinueOnError = true
+			case "--report-memory":
+				reportMemory = true
+			case "--deadline":
+				if i+1 < len(os.Args) {
+					duration, err := time.ParseDuration(os.Args[i+1])
+					if err != nil || duration <= 0 {
+						fmt.Printf("❌ Invalid --deadline %q: use a positive duration such as 30m or 2h\n", os.Args[i+1])
+						os.Exit(1)
+					}
+					deadline = duration
+					i++ // skip next argument
+				}
+			case "--fail-on":
+				if i+1 < len(os.Args) {
+					categories, err := parseFailOn(os.Args[i+1])
+					if err != nil {
+						fmt.Printf("❌ Invalid --fail-on: %v\n", err)
+						os.Exit(1)
+					}
+					failOn = categories
+					i++ // skip next argument
+				}
+			case "--anonymize":
+				anonymize = true
+			case "--anonymize-map":
+				if i+1 < len(os.Args) {
+					anonymize = true
+					anonymizeMapPath = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--count-parity":
+				countParity = true
+			case "--preflight":
+				preflight = true
+			case "--max-path-length":
+				if i+1 < len(os.Args) {
+					length, err := strconv.Atoi(os.Args[i+1])
+					if err != nil || length < 1 {
+						fmt.Printf("❌ Invalid max path length: %s\n", os.Args[i+1])
+						os.Exit(1)
+					}
+					maxPathLength = length
+					i++ // skip next argument
+				}
+			case "--top-dirs":
+				if i+1 < len(os.Args) {
+					if count, err := strconv.Atoi(os.Args[i+1]); err != nil || count < 1 {
+						fmt.Printf("Invalid top-dirs count: %s. Using default of 10.\n", os.Args[i+1])
+						topDirs = 10
+					} else {
+						topDirs = count
+					}
+					i++ // skip next argument
+				}
+			case "--hash":
+				if i+1 < len(os.Args) {
+					if !isSupportedHashAlgorithm(os.Args[i+1]) {
+						fmt.Printf("❌ Unsupported hash algorithm %q (expected %s, %s or %s)\n", os.Args[i+1], HashSHA256, HashGit, HashMD5)
+						os.Exit(1)
+					}
+					scanOpts.HashAlgorithm = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--buffer-size":
+				if i+1 < len(os.Args) {
+					size, err := parseSize(os.Args[i+1])
+					if err != nil || size <= 0 || size > maxHashBufferSize {
+						fmt.Printf("❌ Invalid buffer size %q: expected a size up to %s such as 1MB\n", os.Args[i+1], formatSize(maxHashBufferSize))
+						os.Exit(1)
+					}
+					scanOpts.BufferSize = int(size)
+					i++ // skip next argument
+				}
+			case "--checkpoint":
+				if i+1 < len(os.Args) {
+					checkpointPath = os.Args[i+1]
+					i++ // skip next argument
+				}
+			case "--resume":
+				resume = true
+			case "--ignore-paths":
+				compareOpts.IgnorePaths = true
+			case "--loose-names":
+				compareOpts.LooseNames = true
+			case "--ignore-hashes":
+				if i+1 < len(os.Args) {
+					blocklist, err := loadHashBlocklist(os.Args[i+1])
+					if err != nil {
+						fmt.Printf("❌ Error reading hash blocklist: %v\n", err)
+						os.Exit(1)
+					}
+					compareOpts.IgnoreHashes = blocklist
+					i++ // skip next argument
+				}
+			case "--only-modified-content":
+				showTimestampOnly = true
+			case "--show-moves":
+				showMoves = true
+			case "--dir-equivalence":
+				showDirEquivalence = true
+			case "--report-identical-count-by-dir":
+				reportIdenticalByDir = true
+			case "--interactive-review":
+				interactiveReview = true
+			case "--review-out":
+				if i+1 < len(os.Args) {
+					reviewOutPath = os.Args[i+1]
+					i++ // skip next argument
+				}
+			}
+		}
+
+		// Reports meant for sharing print placeholders instead of names
+		if anonymize {
+			if isPreview || isEstimate || interactiveReview || exportManifestPath != "" || coveragePaths != nil || execOpts.Command != "" {
+				fmt.Println("❌ --anonymize can't be combined with --preview, --estimate, --interactive-review, --export-manifest, --coverage or --exec")
+				os.Exit(1)
+			}
+			// Inline warnings would print real paths; only their count is reported
+			scanOpts.QuietWarnings = true
+			verbose = false
+			anonymizer = newAnonymizer()
+			// The title and set labels often name the very things being hidden
+			title = anonymizer.Label("title", title)
+			if set1Label != "Set 1" {
+				set1Label = anonymizer.Label("label", set1Label)
+			}
+			if set2Label != "Set 2" {
+				set2Label = anonymizer.Label("label", set2Label)
+			}
+		}
+
+		// Scan a single set into a manifest and exit
+		if exportManifestPath != "" {
+			runExportManifest(exportManifestPath, set1Dirs, scanOpts)
+			return
+		}
+		if (manifestPaths != nil || manifestInPath != "" || coveragePaths != nil) && (isPreview || isEstimate) {
+			fmt.Println("❌ --preview and --estimate need directories, not manifests")
+			os.Exit(1)
+		}
+
+		// Check one live set against several backup manifests and exit
+		if coveragePaths != nil {
+			treeOpts := TreeDisplayOptions{ShowDetails: showDetails, Color: useColor(noColor)}
+			if !runCoverage(coveragePaths, set1Dirs, scanOpts, treeOpts, flattenTree) {
+				os.Exit(exitCodeDifferences)
+			}
+			return
+		}
+
+		// Hash the live set the way the manifest was hashed
+		if manifestInPath != "" {
+			var err error
+			manifestInSet, manifestIn, err = loadManifest(manifestInPath)
+			if err != nil {
+				fmt.Printf("❌ Error loading manifest: %v\n", err)
+				os.Exit(1)
+			}
+			if _, err := useManifestHashMode(&scanOpts, manifestIn); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		// If estimate mode, count files without hashing and exit
+		if isEstimate {
+			runEstimate(set1Dirs, set2Dirs, scanOpts, estimateThroughput)
+			return
+		}
+
+		// Record hashed files so an interrupted run can be resumed
+		if checkpointPath != "" || resume {
+			if checkpointPath == "" {
+				checkpointPath = defaultCheckpointPath
+			}
+			checkpoint, err := openCheckpoint(checkpointPath, resume, hashMode(scanOpts))
+			if err != nil {
+				fmt.Printf("❌ Error opening checkpoint %s: %v\n", checkpointPath, err)
+				os.Exit(1)
+			}
+			defer checkpoint.Close()
+			if resume {
+				fmt.Printf("♻️  Resuming from checkpoint %s (%d files already hashed)\n", checkpointPath, checkpoint.Len())
+			}
+			scanOpts.Checkpoint = checkpoint
+		}
+
+		// If preview mode, run preview and exit
+		if isPreview {
+			runPreview(set1Dirs, set2Dirs, previewCount, showDetails, showModified, showUniqueToSet1, showUniqueToSet2, scanOpts, compareOpts)
+			return
+		}
+
+		// Clean up directory paths
+		for i := range set1Dirs {
+			set1Dirs[i] = strings.TrimSpace(set1Dirs[i])
+		}
+		for i := range set2Dirs {
+			set2Dirs[i] = strings.TrimSpace(set2Dirs[i])
+		}
+	}
+
+	fmt.Println("Directory Comparison Tool")
+	fmt.Println("=========================")
+	fmt.Println()
+
+	printRunMetadata(collectRunMetadata(title, anonymizer.Args(commandArgs), anonymizer.Paths(set1Dirs), anonymizer.Paths(set2Dirs)))
+
+	// Catch typo'd or unmounted directories before a long scan (optional). Manifests stand in for
+	// their sets, so only directories that will actually be scanned are checked.
+	if preflight {
+		checkDirs1, checkDirs2 := set1Dirs, set2Dirs
+		if manifestPaths != nil {
+			checkDirs1, checkDirs2 = nil, nil
+		} else if manifestInPath != "" {
+			checkDirs1 = nil
+		}
+		statuses := preflightRoots(checkDirs1, checkDirs2, scanOpts.BaseDir)
+		if !printPreflight(statuses, anonymizer) {
+			os.Exit(exitCodeMissingSet)
+		}
+	}
+
+	// Region hashing changes what "identical" means, so say so before any result is shown
+	if scanOpts.HashSkipBytes > 0 || scanOpts.HashLimitBytes > 0 {
+		fmt.Printf("✂️  Hashing only part of each file (%s): differences outside that region are not detected\n", hashMode(scanOpts))
+		fmt.Println()
+	}
+
+	// Sample the heap from before the scans start so the peak covers them (optional)
+	var memoryMonitor *MemoryMonitor
+	if reportMemory {
+		memoryMonitor = startMemoryMonitor(memorySampleInterval)
+	}
+
+	// Stop scanning when the deadline passes or on Ctrl+C and compare whatever was hashed by then.
+	// Once the scan has stopped or finished, Ctrl+C exits immediately again.
+	scanCtx, stopOnInterrupt := signal.NotifyContext(context.Background(), os.Interrupt)
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		scanCtx, cancel = context.WithTimeout(scanCtx, deadline)
+		defer cancel()
+	}
+	go func() {
+		<-scanCtx.Done()
+		stopOnInterrupt()
+	}()
+	scanOpts.Context = scanCtx
+
+	var set1, set2 *FileSet
+	var err error
+	if manifestPaths != nil {
+		// Compare two previously exported sets without touching the filesystem they describe
+		var manifest1, manifest2 *Manifest
+		fmt.Printf("📥 Loading %s manifest %s...\n", set1Label, anonymizer.FilePath(manifestPaths[0]))
+		set1, manifest1, err = loadManifest(manifestPaths[0])
+		if err != nil {
+			fmt.Printf("❌ Error loading first manifest: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("   Found %d files (hashed on %s at %s)\n", len(set1.Files), manifest1.Hostname, manifest1.Created.Local().Format("2006-01-02 15:04:05"))
+
+		fmt.Printf("📥 Loading %s manifest %s...\n", set2Label, anonymizer.FilePath(manifestPaths[1]))
+		set2, manifest2, err = loadManifest(manifestPaths[1])
+		if err != nil {
+			fmt.Printf("❌ Error loading second manifest: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("   Found %d files (hashed on %s at %s)\n", len(set2.Files), manifest2.Hostname, manifest2.Created.Local().Format("2006-01-02 15:04:05"))
+
+		if manifestAlgorithm(manifest1) != manifestAlgorithm(manifest2) {
+			fmt.Printf("❌ Manifests use different hash algorithms (%s vs %s) and can't be compared\n", manifestAlgorithm(manifest1), manifestAlgorithm(manifest2))
+			os.Exit(1)
+		}
+	} else if manifestInSet != nil {
+		// Compare a previously exported set against directories scanned now
+		fmt.Printf("📥 Loading %s manifest %s...\n", set1Label, anonymizer.FilePath(manifestInPath))
+		set1 = manifestInSet
+		fmt.Printf("   Found %d files (hashed on %s at %s)\n", len(set1.Files), manifestIn.Hostname, manifestIn.Created.Local().Format("2006-01-02 15:04:05"))
+
+		fmt.Printf("🔍 Analyzing second set of directories with %s to match the manifest...\n", hashMode(scanOpts))
+		set2, err = walkDirectoriesWithOptions(set2Dirs, -1, scanOpts)
+		if err != nil {
+			fmt.Printf("❌ Error analyzing second set: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("   Found %d files\n", len(set2.Files))
+	} else {
+		// Set 2's same-name files of different sizes can skip hashing, using the names and sizes of set 1 once it
+		// has been scanned. Every file keeps a real hash when the output or --exec uses hashes or either set has
+		// remote roots, and nothing is skipped when only part of each file is hashed (--ignore-trailing-nulls,
+		// --ignore-bom, --hash-skip-bytes, --hash-limit-bytes), since files of different sizes can then still match.
+		// With --parallel-sets, set 1 isn't known while set 2 is hashed, so every file is hashed.
+		var skippedHashes int64
+		_, remote1 := splitRemoteRoots(set1Dirs)
+		_, remote2 := splitRemoteRoots(set2Dirs)
+		sizeFastPath := !scanOpts.IgnoreTrailingNulls && !scanOpts.IgnoreBOM && scanOpts.HashSkipBytes == 0 && scanOpts.HashLimitBytes == 0 && !hashAll && !showHashes && !strings.Contains(execOpts.Command, "{hash}") && !showDirEquivalence && len(snapshotPaths) == 0 && compareOpts.IgnoreHashes == nil && len(remote1) == 0 && len(remote2) == 0
+
+		if parallelSets {
+			fmt.Println("🔍 Analyzing both sets of directories in parallel...")
+			var err1, err2 error
+			set1, set2, err1, err2 = scanSetsInParallel(set1Dirs, set2Dirs, scanOpts, scanOpts)
+			if err1 != nil {
+				fmt.Printf("❌ Error analyzing first set: %v\n", err1)
+				os.Exit(1)
+			}
+			if err2 != nil {
+				fmt.Printf("❌ Error analyzing second set: %v\n", err2)
+				os.Exit(1)
+			}
+			fmt.Printf("   Found %d files in %s and %d files in %s\n", len(set1.Files), set1Label, len(set2.Files), set2Label)
+		} else {
+			fmt.Println("🔍 Analyzing first set of directories...")
+			set1, err = walkDirectoriesWithOptions(set1Dirs, -1, scanOpts)
+			if err != nil {
+				fmt.Printf("❌ Error analyzing first set: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("   Found %d files\n", len(set1.Files))
+
+			// A set 1 cut short by the deadline could rule out files whose match it never reached
+			scanOpts2 := scanOpts
+			if sizeFastPath && !set1.Partial {
+				scanOpts2.SkipHash = skipSizeMismatches(indexSetSizes(set1), &skippedHashes)
+			}
+
+			fmt.Println("🔍 Analyzing second set of directories...")
+			set2, err = walkDirectoriesWithOptions(set2Dirs, -1, scanOpts2)
+			if err != nil {
+				fmt.Printf("❌ Error analyzing second set: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("   Found %d files\n", len(set2.Files))
+		}
+		if skippedHashes > 0 {
+			fmt.Printf("   ⚡ Skipped hashing %d same-name files whose sizes differ\n", skippedHashes)
+			if !scanStopped(scanOpts) {
+				hashSkippedDuplicates(set2, scanOpts)
+			}
+		}
+	}
+
+	// Every hash is in; write out the checkpoint now, since the exits below skip deferred calls
+	if scanOpts.Checkpoint != nil {
+		if err := scanOpts.Checkpoint.Close(); err != nil {
+			fmt.Printf("Warning: Could not write checkpoint %s: %v; the results are complete, but a resumed run will hash some files again\n", checkpointPath, err)
+		}
+	}
+
+	// Read why the scan stopped before stopOnInterrupt cancels the context itself
+	partial := set1.Partial || set2.Partial
+	stopReason := fmt.Sprintf("the %v deadline passed", deadline)
+	if !errors.Is(scanCtx.Err(), context.DeadlineExceeded) {
+		stopReason = "it was interrupted"
+	}
+	stopOnInterrupt()
+	if partial {
+		printPartialResultsNotice(stopReason)
+	}
+
+	// Compare on the real names; --anonymize only replaces them in what is printed or written below.
+	// Path lengths are measured on the real paths for the same reason.
+	fmt.Println("🔍 Comparing file sets...")
+	result := compareFileSetsWithOptions(set1, set2, compareOpts)
+	var longPaths []*FileInfo
+	if maxPathLength > 0 {
+		longPaths = findLongPaths(set2.Files, maxPathLength)
+	}
+
+	// From here on, everything printed or written uses placeholders (optional)
+	if anonymizer != nil {
+		anonymizer.FileSet(set1)
+		anonymizer.FileSet(set2)
+		set1Dirs = anonymizer.Paths(set1Dirs)
+		set2Dirs = anonymizer.Paths(set2Dirs)
+		if anonymizeMapPath != "" {
+			if err := anonymizer.WriteMap(anonymizeMapPath); err != nil {
+				fmt.Printf("❌ Error writing anonymization map: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("🔐 Placeholder map saved for your reference (keep it private)")
+		}
+	}
+
+	if reportMissingSets(set1, set2) {
+		os.Exit(exitCodeMissingSet)
+	}
+
+	if len(snapshotPaths) == 2 {
+		for i, fileSet := range []*FileSet{set1, set2} {
+			if err := writeSnapshot(snapshotPaths[i], fileSet); err != nil {
+				fmt.Printf("❌ Error writing snapshot for %s: %v\n", setLabel(i), err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("💾 Snapshots written to %s and %s\n", snapshotPaths[0], snapshotPaths[1])
+	}
+
+	treeOpts := TreeDisplayOptions{ShowDetails: showDetails, ShowHashes: showHashes, FullHashes: fullHashes, Color: useColor(noColor)}
+
+	// Show the prefix every set directory shares once instead of in every header (optional)
+	if stripCommonPrefix {
+		if prefix := commonPathPrefix(append(append([]string(nil), set1Dirs...), set2Dirs...)); prefix != "" {
+			fmt.Printf("📍 All paths relative to %s\n", prefix)
+			set1Dirs = stripPathPrefixes(set1Dirs, prefix)
+			set2Dirs = stripPathPrefixes(set2Dirs, prefix)
+			treeOpts.StripPrefix = prefix
+		}
+	}
+
+	fmt.Println()
+
+	// Coarse change map instead of per-file trees (optional)
+	if directoryGranularity {
+		showAll := !showModified && !showUniqueToSet2 && !showUniqueToSet1
+		var modified, uniqueToSet2, uniqueToSet1 []*FileInfo
+		if showModified || showAll {
+			modified = result.SameNameDifferentHash
+		}
+		if showUniqueToSet2 || showAll {
+			uniqueToSet2 = result.UniqueToSet2
+		}
+		if showUniqueToSet1 || showAll {
+			uniqueToSet1 = result.UniqueToSet1
+		}
+		printDirectoryChanges(rollUpToDirectories(modified, uniqueToSet2, uniqueToSet1))
+	}
+
+	// One merged tree instead of the separate per-category trees (optional)
+	separateTrees := !directoryGranularity && !combinedTree && !presenceColumns
+	if combinedTree && !directoryGranularity {
+		printCombinedTree(set2, result, treeOpts, flattenTree)
+	}
+
+	// Flat two-column listing of every path instead of the per-category trees (optional)
+	if presenceColumns && !directoryGranularity {
+		printPresenceColumns(buildPresenceRows(set1, set2))
+	}
+
+	// First tree: Files with same name but different content (optional)
+	if showModified && separateTrees {
+		if len(result.SameNameDifferentHash) > 0 {
+			fmt.Printf("⚠️  Files with same name but different content (%d files) - %s (%s) → %s (%s):\n", len(result.SameNameDifferentHash), set2Label, strings.Join(set2Dirs, ", "), set1Label, strings.Join(set1Dirs, ", "))
+			fmt.Println("=" + strings.Repeat("=", 50))
+			fmt.Println()
+
+			tree1 := buildTree(result.SameNameDifferentHash)
+			if flattenTree {
+				flattenSingleChildDirectories(tree1)
+			}
+			printTreeWithOptions(tree1, "", true, result.NameMappings, treeOpts)
+			fmt.Println()
+		} else {
+			fmt.Println("✅ No files found with same name but different content.")
+			fmt.Println()
+		}
+	}
+
+	// Files that were re-saved without content changes (optional)
+	if showTimestampOnly {
+		printTimestampOnlyChanges(result.TimestampOnlyChanged)
+	}
+
+	// Whole directories that were moved, which the content match otherwise hides (optional)
+	var directoryMoves []DirectoryMove
+	if showMoves {
+		directoryMoves = findDirectoryMoves(set1, set2)
+		printDirectoryMoves(directoryMoves)
+	}
+
+	// Second tree: Files unique to set 2 (optional)
+	if showUniqueToSet2 && separateTrees {
+		if len(result.UniqueToSet2) > 0 {
+			fmt.Printf("📋 Files unique to %s (%s) - not found in %s (%s) (%d files):\n", set2Label, strings.Join(set2Dirs, ", "), set1Label, strings.Join(set1Dirs, ", "), len(result.UniqueToSet2))
+			fmt.Println("=" + strings.Repeat("=", 50))
+			fmt.Println()
+
+			if groupByRoot {
+				printTreeByRoot(result.UniqueToSet2, set2, set1, treeOpts, flattenTree)
+			} else {
+				tree2 := buildSmartTree(result.UniqueToSet2, set2, set1)
+				if flattenTree {
+					flattenSingleChildDirectories(tree2)
+				}
+				printTreeWithOptions(tree2, "", true, nil, treeOpts)
+				fmt.Println()
+			}
+		} else {
+			fmt.Printf("✅ No unique files found in %s.\n", set2Label)
+			fmt.Println()
+		}
+	}
+
+	// Third tree: Files unique to set 1 (optional)
+	if showUniqueToSet1 && separateTrees {
+		if len(result.UniqueToSet1) > 0 {
+			fmt.Printf("📋 Files unique to %s (%s) - not found in %s (%s) (%d files):\n", set1Label, strings.Join(set1Dirs, ", "), set2Label, strings.Join(set2Dirs, ", "), len(result.UniqueToSet1))
+			fmt.Println("=" + strings.Repeat("=", 50))
+			fmt.Println()
+
+			if groupByRoot {
+				printTreeByRoot(result.UniqueToSet1, set1, set2, treeOpts, flattenTree)
+			} else {
+				tree3 := buildSmartTree(result.UniqueToSet1, set1, set2)
+				if flattenTree {
+					flattenSingleChildDirectories(tree3)
+				}
+				printTreeWithOptions(tree3, "", true, nil, treeOpts)
+				fmt.Println()
+			}
+		} else {
+			fmt.Printf("✅ No unique files found in %s.\n", set1Label)
+			fmt.Println()
+		}
+	}
+
+	// Directories with the most differences across the selected categories (optional)
+	if topDirs > 0 {
+		differing := selectedDifferences(result, showModified, showUniqueToSet2, showUniqueToSet1)
+		printTopDirectories(rankDirectoriesByDifferences(differing, topDirs))
+	}
+
+	// Content-equivalent directories regardless of layout (optional)
+	if showDirEquivalence {
+		printDirectoryEquivalences(findEquivalentDirectories(set1, set2))
+	}
+
+	// Structural check of file counts per directory (optional)
+	if countParity {
+		printCountParityMismatches(findCountParityMismatches(set1, set2))
+	}
+
+	// Files that won't fit a destination's path length limit (optional)
+	if maxPathLength > 0 {
+		printLongPaths(longPaths, maxPathLength)
+	}
+
+	// Positive confirmation of what set 2 already holds (optional)
+	if reportIdenticalByDir {
+		printIdenticalCountsByDirectory(identicalCountsByDirectory(set1, result))
+	}
+
+	// Same-content files whose access controls differ (optional)
+	var aclDifferences []ACLDifference
+	if compareACLs {
+		var aclWarnings []ScanWarning
+		aclDifferences, aclWarnings = findACLDifferences(set1, set2)
+		for _, warning := range aclWarnings {
+			recordWarning(&set2.Warnings, scanOpts, warning)
+		}
+		printACLDifferences(aclDifferences)
+	}
+
+	// Files --ignore-bom matched although their byte-order marks differ
+	var bomDifferences []BOMDifference
+	if scanOpts.IgnoreBOM {
+		var bomWarnings []ScanWarning
+		bomDifferences, bomWarnings = findBOMDifferences(set1, set2)
+		for _, warning := range bomWarnings {
+			recordWarning(&set2.Warnings, scanOpts, warning)
+		}
+		printBOMDifferences(bomDifferences)
+	}
+	// Interactive triage of modified files (optional)
+	if interactiveReview && len(result.SameNameDifferentHash) > 0 {
+		decisions := runInteractiveReview(result)
+		printReviewDecisions(decisions)
+		if reviewOutPath != "" {
+			if err := writeReviewDecisions(reviewOutPath, decisions); err != nil {
+				fmt.Printf("❌ Error writing review decisions: %v\n", err)
+			} else {
+				fmt.Printf("💾 Review decisions saved to %s\n", reviewOutPath)
+				fmt.Println()
+			}
+		}
+	}
+
+	// User command for every differing file (optional)
+	var execFailures []string
+	if execOpts.Command != "" && partial {
+		// Files the scan never reached look unique, so the command would act on the wrong files
+		fmt.Printf("⏭️  Not running %q: the results are partial, so files the scan didn't reach would be treated as differences\n", execOpts.Command)
+		fmt.Println()
+	} else if execOpts.Command != "" {
+		differing := selectedDifferences(result, showModified, showUniqueToSet2, showUniqueToSet1)
+		fmt.Printf("⚙️  Running %q for %d differing files...\n", execOpts.Command, len(differing))
+		var ran int
+		ran, execFailures = runExecOnFiles(differing, execOpts)
+		printExecResults(len(differing), ran, execFailures)
+	}
+
+	// Warnings held back by --no-warnings
+	if scanOpts.QuietWarnings {
+		printSuppressedWarnings(append(set1.Warnings, set2.Warnings...), verbose)
+	}
+
+	// Summary
+	if partial {
+		fmt.Println("📊 Summary (PARTIAL):")
+	} else {
+		fmt.Println("📊 Summary:")
+	}
+	fmt.Printf("   • Files in %s: %d\n", set1Label, len(set1.Files))
+	fmt.Printf("   • Files in %s: %d\n", set2Label, len(set2.Files))
+	fmt.Printf("   • Data to transfer: %s\n", formatSize(calculateTransferSize(result)))
+	contentAdded, contentRemoved := netContentChange(set1, set2, compareOpts.IgnoreHashes)
+	fmt.Printf("   • Content added: %s, removed: %s (distinct content only)\n", formatSize(contentAdded), formatSize(contentRemoved))
+	if showModified {
+		fmt.Printf("   • Same name, different content: %d\n", len(result.SameNameDifferentHash))
+	}
+	if showUniqueToSet2 {
+		fmt.Printf("   • Unique to %s: %d\n", set2Label, len(result.UniqueToSet2))
+	}
+	if showUniqueToSet1 {
+		fmt.Printf("   • Unique to %s: %d\n", set1Label, len(result.UniqueToSet1))
+	}
+	if showTimestampOnly {
+		fmt.Printf("   • Timestamp changed, content same: %d\n", len(result.TimestampOnlyChanged))
+	}
+	if showMoves {
+		fmt.Printf("   • Directories moved: %d\n", len(directoryMoves))
+	}
+	if compareOpts.IgnoreHashes != nil {
+		fmt.Printf("   • Ignored by hash blocklist: %d\n", len(result.IgnoredByHash))
+	}
+	if compareACLs {
+		fmt.Printf("   • Same content, different ACLs: %d\n", len(aclDifferences))
+	}
+	if scanOpts.IgnoreBOM {
+		fmt.Printf("   • Identical except for a byte-order mark: %d\n", len(bomDifferences))
+	}
+
+	// Calculate sizes for different categories
+	var sameNameSize, uniqueSet2Size, uniqueSet1Size int64
+
+	if showModified {
+		for _, file := range result.SameNameDifferentHash {
+			sameNameSize += file.Size
+		}
+	}
+	if showUniqueToSet2 {
+		for _, file := range result.UniqueToSet2 {
+			uniqueSet2Size += file.Size
+		}
+	}
+	if showUniqueToSet1 {
+		for _, file := range result.UniqueToSet1 {
+			uniqueSet1Size += file.Size
+		}
+	}
+
+	if (showModified && sameNameSize > 0) || (showUniqueToSet2 && uniqueSet2Size > 0) || (showUniqueToSet1 && uniqueSet1Size > 0) {
+		fmt.Println("   • Total sizes:")
+		if showModified && sameNameSize > 0 {
+			fmt.Printf("     - Same name, different content: %s\n", formatSize(sameNameSize))
+		}
+		if showUniqueToSet2 && uniqueSet2Size > 0 {
+			fmt.Printf("     - Unique to %s: %s\n", set2Label, formatSize(uniqueSet2Size))
+		}
+		if showUniqueToSet1 && uniqueSet1Size > 0 {
+			fmt.Printf("     - Unique to %s: %s\n", set1Label, formatSize(uniqueSet1Size))
+		}
+	}
+
+	if memoryMonitor != nil {
+		printMemoryReport(memoryMonitor.Stop())
+	}
+
+	// Differences selected with --fail-on make the run fail, e.g. as a CI gate
+	var failing []string
+	if failOn != nil {
+		failing = failingCategories(result, failOn)
+		if len(failing) > 0 {
+			fmt.Println()
+			fmt.Printf("❌ Failing because of: %s\n", strings.Join(failing, ", "))
+		}
+	}
+
+	// On Windows, wait for user input before closing
+	if runtime.GOOS == "windows" {
+		fmt.Println()
+		fmt.Print("Press Enter to exit...")
+		bufio.NewScanner(os.Stdin).Scan()
+	}
+
+	// Incomplete results come first, so a gate can tell "failed" from "didn't finish"
+	if partial {
+		os.Exit(exitCodePartial)
+	}
+	if len(failing) > 0 {
+		os.Exit(exitCodeDifferences)
+	}
+	if len(execFailures) > 0 {
+		os.Exit(1)
+	}
+}
+
+// selectedDifferences returns the differing files of the categories chosen with --show-*, or of all
+// categories when none was chosen: set 2's modified files, then files unique to set 2, then to set 1
+func selectedDifferences(result *ComparisonResult, showModified, showUniqueToSet2, showUniqueToSet1 bool) []*FileInfo {
+	showAll := !showModified && !showUniqueToSet2 && !showUniqueToSet1
+	var differing []*FileInfo
+	if showModified || showAll {
+		differing = append(differing, result.SameNameDifferentHash...)
+	}
+	if showUniqueToSet2 || showAll {
+		differing = append(differing, result.UniqueToSet2...)
+	}
+	if showUniqueToSet1 || showAll {
+		differing = append(differing, result.UniqueToSet1...)
+	}
+	return differing
+}
+
+// Environment variables naming the default directory pair
+const (
+	envSet1 = "DATACOMPARER_SET1"
+	envSet2 = "DATACOMPARER_SET2"
+)
+
+// usageFlags only ask for the usage text, so they never pick up the directories from the environment
+var usageFlags = map[string]bool{"--help": true, "-help": true, "-h": true}
+
+// leadingModeFlags switch to a mode that takes its own file or directory arguments and must come first on the
+// command line, so they never pick up the directories from the environment either
+var leadingModeFlags = map[string]bool{"--compare-manifests": true, "--manifest-in": true, "--export-manifest": true, "--coverage": true}
+
+// argsWithEnvironmentSets inserts the DATACOMPARER_SET1/DATACOMPARER_SET2 directories as the positional
+// arguments when the command line has none. It reports false, leaving args alone, unless both variables are set.
+func argsWithEnvironmentSets(args []string) ([]string, bool) {
+	if len(args) > 1 && (!strings.HasPrefix(args[1], "--") || leadingModeFlags[args[1]]) {
+		return args, false
+	}
+	for _, arg := range args[1:] {
+		if usageFlags[arg] {
+			return args, false
+		}
+	}
+	set1, set2 := os.Getenv(envSet1), os.Getenv(envSet2)
+	if set1 == "" || set2 == "" {
+		return args, false
+	}
+	return append([]string{args[0], set1, set2}, args[1:]...), true
+}
+
+// collectRunMetadata captures the timestamp, host, version and arguments of the current run
+func collectRunMetadata(title string, args []string, set1Dirs, set2Dirs []string) *RunMetadata {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &RunMetadata{
+		Title:     title,
+		Timestamp: time.Now(),
+		Hostname:  hostname,
+		Version:   version,
+		Arguments: args,
+		Set1Dirs:  set1Dirs,
+		Set2Dirs:  set2Dirs,
+	}
+}
+
+// printRunMetadata prints the report header describing the run
+func printRunMetadata(meta *RunMetadata) {
+	if meta.Title != "" {
+		fmt.Printf("📝 %s\n", meta.Title)
+	}
+	fmt.Printf("🕒 Generated: %s\n", meta.Timestamp.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("💻 Host: %s\n", meta.Hostname)
+	fmt.Printf("🏷️  Version: %s\n", meta.Version)
+	if len(meta.Arguments) > 0 {
+		fmt.Printf("⌨️  Arguments: %s\n", strings.Join(meta.Arguments, " "))
+	}
+	fmt.Println()
+
+	fmt.Printf("📂 %s directories: %s\n", set1Label, strings.Join(meta.Set1Dirs, ", "))
+	fmt.Printf("📂 %s directories: %s\n", set2Label, strings.Join(meta.Set2Dirs, ", "))
+	fmt.Println()
+}
+
+// writeSnapshot writes one "<relpath>\t<hash>" line per file, sorted by path, so snapshots can be diffed with external tools
+func writeSnapshot(path string, fileSet *FileSet) error {
+	lines := make([]string, 0, len(fileSet.Files))
+	for _, file := range fileSet.Files {
+		lines = append(lines, fmt.Sprintf("%s\t%s", filepath.ToSlash(file.RelativePath), file.Hash))
+	}
+	sort.Strings(lines)
+
+	var builder strings.Builder
+	for _, line := range lines {
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	return os.WriteFile(path, []byte(builder.String()), 0o600)
+}
+
+// printSuppressedWarnings reports warnings that were recorded but not printed during the scan. Only read and
+// permission failures count as errors; special files and skipped or missing roots are reported on their own.
+func printSuppressedWarnings(warnings []ScanWarning, verbose bool) {
+	if len(warnings) == 0 {
+		return
+	}
+
+	groups := []struct {
+		count   string // fmt format for the count-only summary
+		heading string
+	}{
+		{"%d files or directories skipped due to errors", "Skipped due to errors"},
+		{"%d special files (pipes, sockets, devices) skipped", "Special files skipped"},
+		{"%d directories missing", "Missing directories"},
+		{"%d directories skipped as duplicate, nested or remote roots", "Directories skipped"},
+	}
+	grouped := make([][]ScanWarning, len(groups))
+	for _, warning := range warnings {
+		group := 0 // WarningReadError and WarningPermissionDenied
+		switch warning.Reason {
+		case WarningNotRegular:
+			group = 1
+		case WarningMissingRoot:
+			group = 2
+		case WarningSkippedRoot:
+			group = 3
+		}
+		grouped[group] = append(grouped[group], warning)
+	}
+
+	if !verbose {
+		var counts []string
+		for i, group := range groups {
+			if len(grouped[i]) > 0 {
+				counts = append(counts, fmt.Sprintf(group.count, len(grouped[i])))
+			}
+		}
+		fmt.Printf("⚠️  %s; use --verbose to list them\n", strings.Join(counts, ", "))
+		fmt.Println()
+		return
+	}
+
+	for i, group := range groups {
+		if len(grouped[i]) == 0 {
+			continue
+		}
+		fmt.Printf("⚠️  %s (%d):\n", group.heading, len(grouped[i]))
+		for _, warning := range grouped[i] {
+			fmt.Printf("   • %s\n", warning)
+		}
+		fmt.Println()
+	}
+}
+
+// formatSize formats file sizes in human-readable format
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d bytes", size)
+	} else if size < 1024*1024 {
+		return fmt.Sprintf("%.2f KB", float64(size)/1024.0)
+	} else if size < 1024*1024*1024 {
+		return fmt.Sprintf("%.2f MB", float64(size)/(1024.0*1024.0))
+	} else {
+		return fmt.Sprintf("%.2f GB", float64(size)/(1024.0*1024.0*1024.0))
+	}
+}
+
+// calculateTransferSize returns the bytes needed to bring Set 1 up to date with Set 2:
+// everything unique to Set 2 plus every file whose content changed
+func calculateTransferSize(result *ComparisonResult) int64 {
+	var total int64
+	for _, file := range result.UniqueToSet2 {
+		total += file.Size
+	}
+	for _, file := range result.SameNameDifferentHash {
+		total += file.Size
+	}
+	return total
+}
+
+// netContentChange returns the bytes of content only in Set 2 (added) and only in Set 1 (removed), counting
+// each distinct hash once so duplicated content isn't counted twice. Blocklisted hashes are left out. Files
+// still carrying a size placeholder count as distinct content, which holds once hashSkippedDuplicates has run:
+// no other file of their set has their size.
+func netContentChange(set1, set2 *FileSet, ignoreHashes map[string]bool) (added, removed int64) {
+	onlyIn := func(set, other *FileSet) int64 {
+		var total int64
+		for hash, files := range set.HashMap {
+			if _, shared := other.HashMap[hash]; shared || ignoreHashes[hash] || len(files) == 0 {
+				continue
+			}
+			total += files[0].Size
+		}
+		return total
+	}
+	return onlyIn(set2, set1), onlyIn(set1, set2)
+}
+
+// runPreview runs the tool in preview mode with limited file processing
+func runPreview(set1Dirs, set2Dirs []string, previewCount int, showDetails, showModified, showUniqueToSet1, showUniqueToSet2 bool, scanOpts ScanOptions, compareOpts CompareOptions) {
+	fmt.Println("⚡ Directory Comparison Tool - PREVIEW MODE")
+	fmt.Println("=" + strings.Repeat("=", 45))
+	if scanOpts.StableSample {
+		fmt.Printf("📋 Processing a stable sample of %d files, chosen by path\n", previewCount)
+	} else {
+		fmt.Printf("📋 Processing first %d files as sample\n", previewCount)
+	}
+	fmt.Println()
+
+	fmt.Printf("📂 %s directories: %s\n", set1Label, strings.Join(set1Dirs, ", "))
+	fmt.Printf("📂 %s directories: %s\n", set2Label, strings.Join(set2Dirs, ", "))
+	fmt.Println()
+
+	// Look further than previewCount so files can be paired by path even when the trees walk in different orders
+	window := previewCount * previewSampleWindow
+	collection1, err := collectFileTasks(set1Dirs, window, scanOpts)
+	if err != nil {
+		fmt.Printf("❌ Error analyzing first set: %v\n", err)
+		os.Exit(1)
+	}
+	collection2, err := collectFileTasks(set2Dirs, window, scanOpts)
+	if err != nil {
+		fmt.Printf("❌ Error analyzing second set: %v\n", err)
+		os.Exit(1)
+	}
+	tasks1, tasks2, matched := selectPreviewTasks(collection1.Tasks, collection2.Tasks, previewCount)
+
+	fmt.Printf("🔍 Analyzing first files in %s...\n", set1Label)
+	set1, err := hashTaskCollection(collection1, tasks1, scanOpts)
+	if err != nil {
+		fmt.Printf("❌ Error analyzing first set: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("   Processed %d files\n", len(set1.Files))
+
+	fmt.Printf("🔍 Analyzing first files in %s...\n", set2Label)
+	set2, err := hashTaskCollection(collection2, tasks2, scanOpts)
+	if err != nil {
+		fmt.Printf("❌ Error analyzing second set: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("   Processed %d files\n", len(set2.Files))
+	fmt.Printf("   Sampled %d paths present in both sets\n", matched)
+
+	if reportMissingSets(set1, set2) {
+		os.Exit(exitCodeMissingSet)
+	}
+
+	fmt.Println("🔍 Comparing file sets...")
+	result := compareFileSetsWithOptions(set1, set2, compareOpts)
+
+	fmt.Println()
+	fmt.Println("━━━ PREVIEW RESULTS ━━━")
+
+	// Show results for enabled categories
+	if showModified {
+		if len(result.SameNameDifferentHash) > 0 {
+			fmt.Printf("⚠️  Modified files found (%d in sample):\n", len(result.SameNameDifferentHash))
+			fmt.Println("─" + strings.Repeat("─", 30))
+			tree1 := buildTree(result.SameNameDifferentHash)
+			printTree(tree1, "", true, showDetails, result.NameMappings)
+			fmt.Println()
+		} else {
+			fmt.Println("✅ No modified files found in this sample.")
+			fmt.Println()
+		}
+	}
+
+	if showUniqueToSet2 {
+		if len(result.UniqueToSet2) > 0 {
+			fmt.Printf("📋 Files unique to %s (%d in sample):\n", set2Label, len(result.UniqueToSet2))
+			fmt.Println("─" + strings.Repeat("─", 30))
+			tree2 := buildTree(result.UniqueToSet2)
+			printTree(tree2, "", true, showDetails, nil)
+			fmt.Println()
+		} else {
+			fmt.Printf("✅ No files unique to %s found in this sample.\n", set2Label)
+			fmt.Println()
+		}
+	}
+
+	if showUniqueToSet1 {
+		if len(result.UniqueToSet1) > 0 {
+			fmt.Printf("📋 Files unique to %s (%d in sample):\n", set1Label, len(result.UniqueToSet1))
+			fmt.Println("─" + strings.Repeat("─", 30))
+			tree3 := buildTree(result.UniqueToSet1)
+			printTree(tree3, "", true, showDetails, nil)
+			fmt.Println()
+		} else {
+			fmt.Printf("✅ No files unique to %s found in this sample.\n", set1Label)
+			fmt.Println()
+		}
+	}
+
+	// Summary and next steps
+	fmt.Println("📊 Preview Summary:")
+	fmt.Printf("   • Sample size: %d files from each directory set\n", previewCount)
+	fmt.Printf("   • Files processed from %s: %d\n", set1Label, len(set1.Files))
+	fmt.Printf("   • Files processed from %s: %d\n", set2Label, len(set2.Files))
+	if showModified {
+		fmt.Printf("   • Modified files in sample: %d\n", len(result.SameNameDifferentHash))
+	}
+	if showUniqueToSet2 {
+		fmt.Printf("   • Unique to %s in sample: %d\n", set2Label, len(result.UniqueToSet2))
+	}
+	if showUniqueToSet1 {
+		fmt.Printf("   • Unique to %s in sample: %d\n", set1Label, len(result.UniqueToSet1))
+	}
+	fmt.Println()
+	fmt.Println("💡 To see complete results, run the same command without --preview")
+}
+
+// Limits on how much data --estimate hashes when measuring throughput
+const (
+	estimateSampleBytes = 64 * 1024 * 1024
+	estimateSampleTime  = 2 * time.Second
+)
+
+// measureHashThroughput hashes files from the start of tasks with the same number of workers as a real scan
+// until the sample limits are reached, and returns the observed bytes per second and how many files were hashed
+func measureHashThroughput(tasks []FileTask, opts ScanOptions) (float64, int) {
+	var hashedBytes, sampled int64
+	start := time.Now()
+	limitReached := func() bool {
+		return atomic.LoadInt64(&hashedBytes) >= estimateSampleBytes || time.Since(start) >= estimateSampleTime
+	}
+
+	taskChannel := make(chan FileTask)
+	var wg sync.WaitGroup
+	for i := 0; i < hashWorkerCount(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Hash exactly as the scan will, content options and --buffer-size included, with one buffer per worker
+			buf := newHashBuffer(opts.BufferSize)
+			for task := range taskChannel {
+				if _, err := hashFileContent(task.Path, opts, buf); err != nil {
+					continue
+				}
+				atomic.AddInt64(&hashedBytes, task.Info.Size())
+				atomic.AddInt64(&sampled, 1)
+			}
+		}()
+	}
+	for _, task := range tasks {
+		if limitReached() {
+			break
+		}
+		taskChannel <- task
+	}
+	close(taskChannel)
+	wg.Wait()
+
+	elapsed := time.Since(start).Seconds()
+	if hashedBytes == 0 || elapsed <= 0 {
+		return 0, int(sampled)
+	}
+	return float64(hashedBytes) / elapsed, int(sampled)
+}
+
+// estimateDuration returns how long hashing totalSize bytes takes at the given throughput
+func estimateDuration(totalSize int64, bytesPerSecond float64) time.Duration {
+	if bytesPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(totalSize) / bytesPerSecond * float64(time.Second))
+}
+
+// runEstimate walks both sets without hashing and predicts how long a full comparison would take.
+// A throughput of 0 means measure it by hashing a small sample of the files.
+func runEstimate(set1Dirs, set2Dirs []string, scanOpts ScanOptions, throughput float64) {
+	fmt.Println("📏 Directory Comparison Tool - ESTIMATE MODE")
+	fmt.Println("=" + strings.Repeat("=", 45))
+	fmt.Println()
+
+	fmt.Printf("📂 %s directories: %s\n", set1Label, strings.Join(set1Dirs, ", "))
+	fmt.Printf("📂 %s directories: %s\n", set2Label, strings.Join(set2Dirs, ", "))
+	fmt.Println()
+
+	fmt.Printf("🔍 Counting files in %s...\n", set1Label)
+	set1, err := collectFileTasks(set1Dirs, -1, scanOpts)
+	if err != nil {
+		fmt.Printf("❌ Error scanning first set: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔍 Counting files in %s...\n", set2Label)
+	set2, err := collectFileTasks(set2Dirs, -1, scanOpts)
+	if err != nil {
+		fmt.Printf("❌ Error scanning second set: %v\n", err)
+		os.Exit(1)
+	}
+
+	totalFiles := len(set1.Tasks) + len(set2.Tasks)
+	totalSize := set1.TotalSize + set2.TotalSize
+
+	fmt.Println()
+	fmt.Println("📊 Estimate:")
+	fmt.Printf("   • %s: %d files, %s\n", set1Label, len(set1.Tasks), formatSize(set1.TotalSize))
+	fmt.Printf("   • %s: %d files, %s\n", set2Label, len(set2.Tasks), formatSize(set2.TotalSize))
+	fmt.Printf("   • Total to hash: %d files, %s\n", totalFiles, formatSize(totalSize))
+
+	if throughput > 0 {
+		fmt.Printf("   • Throughput: %s/s (assumed)\n", formatSize(int64(throughput)))
+	} else {
+		var sampled int
+		throughput, sampled = measureHashThroughput(append(set1.Tasks, set2.Tasks...), scanOpts)
+		if throughput <= 0 {
+			fmt.Println("   • Throughput: unknown (no data could be sampled)")
+			fmt.Println()
+			return
+		}
+		fmt.Printf("   • Throughput: %s/s (measured on %d sample files with %d workers)\n", formatSize(int64(throughput)), sampled, hashWorkerCount())
+	}
+	fmt.Printf("   • Estimated hashing time: %s\n", estimateDuration(totalSize, throughput).Round(time.Second))
+	fmt.Println()
+	fmt.Println("💡 Narrow the comparison with --filter, or run without --estimate to start it")
+}
+
+// previewSampleWindow is how many times the preview count each set is walked when pairing sample paths
+const previewSampleWindow = 10
+
+// selectPreviewTasks picks up to count tasks from each set, preferring relative paths present in both
+// so the preview compares like with like, then filling the rest with each set's first remaining files.
+// It also returns how many paths were matched across the sets.
+func selectPreviewTasks(tasks1, tasks2 []FileTask, count int) ([]FileTask, []FileTask, int) {
+	index2 := make(map[string]int, len(tasks2))
+	for i, task := range tasks2 {
+		if _, exists := index2[task.RelPath]; !exists {
+			index2[task.RelPath] = i
+		}
+	}
+
+	var selected1, selected2 []FileTask
+	used1 := make(map[int]bool)
+	used2 := make(map[int]bool)
+	for i, task := range tasks1 {
+		if len(selected1) >= count {
+			break
+		}
+		if j, ok := index2[task.RelPath]; ok && !used2[j] {
+			selected1 = append(selected1, task)
+			selected2 = append(selected2, tasks2[j])
+			used1[i] = true
+			used2[j] = true
+		}
+	}
+	matched := len(selected1)
+
+	fill := func(selected []FileTask, tasks []FileTask, used map[int]bool) []FileTask {
+		for i, task := range tasks {
+			if len(selected) >= count {
+				break
+			}
+			if !used[i] {
+				selected = append(selected, task)
+			}
+		}
+		return selected
+	}
+	selected1 = fill(selected1, tasks1, used1)
+	selected2 = fill(selected2, tasks2, used2)
+
+	return selected1, selected2, matched
+}
+
+// selfTestCheck is one assertion run by --selftest
+type selfTestCheck struct {
+	name string
+	run  func() error
+}
+
+// expectRelPaths checks that files have exactly the expected relative paths (given with forward slashes)
+func expectRelPaths(files []*FileInfo, expected ...string) error {
+	var got []string
+	for _, file := range files {
+		got = append(got, filepath.ToSlash(file.RelativePath))
+	}
+	sort.Strings(got)
+	sort.Strings(expected)
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		return fmt.Errorf("expected %v, got %v", expected, got)
+	}
+	return nil
+}
+
+// runSelfTest builds a known pair of directory trees in a temporary directory, compares them,
+// and prints PASS/FAIL for each expectation. It returns true when every check passes.
+func runSelfTest() bool {
+	fmt.Println("🧪 Directory Comparison Tool - SELF TEST")
+	fmt.Println("=" + strings.Repeat("=", 45))
+	fmt.Printf("📋 Version %s on %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
+	fmt.Println()
+
+	tmpDir, err := os.MkdirTemp("", "dir-compare-selftest-")
+	if err != nil {
+		fmt.Printf("❌ FAIL: cannot create temporary directory: %v\n", err)
+		return false
+	}
+	defer os.RemoveAll(tmpDir)
+
+	set1Files := map[string]string{
+		"common/same.txt":  "same content",
+		"docs/report.txt":  "version 1",
+		"old/removed.txt":  "only in set 1",
+		"moved/a.txt":      "moved content",
+		"Ünïcödé/ñame.txt": "unicode in both",
+	}
+	set2Files := map[string]string{
+		"common/same.txt":  "same content",
+		"docs/report.txt":  "version 2",
+		"café/naïve.txt":   "only in set 2",
+		"new/日本語.txt":      "also only in set 2",
+		"relocated/a.txt":  "moved content",
+		"Ünïcödé/ñame.txt": "unicode in both",
+	}
+
+	set1Dir := filepath.Join(tmpDir, "set1")
+	set2Dir := filepath.Join(tmpDir, "set2")
+	for dir, files := range map[string]map[string]string{set1Dir: set1Files, set2Dir: set2Files} {
+		for relPath, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(relPath))
+			if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+				fmt.Printf("❌ FAIL: cannot create test data: %v\n", err)
+				return false
+			}
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				fmt.Printf("❌ FAIL: cannot create test data: %v\n", err)
+				return false
+			}
+		}
+	}
+
+	opts := ScanOptions{QuietWarnings: true}
+	set1, err1 := walkDirectoriesWithOptions([]string{set1Dir}, -1, opts)
+	set2, err2 := walkDirectoriesWithOptions([]string{set2Dir}, -1, opts)
+	if err1 != nil || err2 != nil {
+		fmt.Printf("❌ FAIL: scanning test data: %v %v\n", err1, err2)
+		return false
+	}
+	result := compareFileSets(set1, set2)
+
+	checks := []selfTestCheck{
+		{"SHA256 of known content", func() error {
+			hash, err := hashFile(filepath.Join(set1Dir, "common", "same.txt"))
+			if err != nil {
+				return err
+			}
+			if expected := fmt.Sprintf("%x", sha256.Sum256([]byte("same content"))); hash != expected {
+				return fmt.Errorf("expected %s, got %s", expected, hash)
+			}
+			return nil
+		}},
+		{"git blob hash of known content", func() error {
+			hash, err := hashFileWithAlgorithm(filepath.Join(set1Dir, "docs", "report.txt"), HashGit)
+			if err != nil {
+				return err
+			}
+			if expected := "e32092a83f837140c08e85a60ef16a6b2a208986"; hash != expected {
+				return fmt.Errorf("expected %s, got %s", expected, hash)
+			}
+			return nil
+		}},
+		{"all files found", func() error {
+			if len(set1.Files) != len(set1Files) || len(set2.Files) != len(set2Files) {
+				return fmt.Errorf("expected %d and %d files, got %d and %d", len(set1Files), len(set2Files), len(set1.Files), len(set2.Files))
+			}
+			return nil
+		}},
+		{"modified files detected", func() error {
+			return expectRelPaths(result.SameNameDifferentHash, "docs/report.txt")
+		}},
+		{"files unique to Set 2 (Unicode names)", func() error {
+			return expectRelPaths(result.UniqueToSet2, "café/naïve.txt", "new/日本語.txt")
+		}},
+		{"files unique to Set 1", func() error {
+			return expectRelPaths(result.UniqueToSet1, "old/removed.txt")
+		}},
+		{"path separators in tree output", func() error {
+			tree := buildSmartTree(result.UniqueToSet2, set2, set1)
+			if tree.Children["new"] == nil || tree.Children["café"] == nil {
+				return fmt.Errorf("expected top-level directories new and café in the tree")
+			}
+			return nil
+		}},
+	}
+
+	passed := 0
+	for _, check := range checks {
+		if err := check.run(); err != nil {
+			fmt.Printf("   ❌ FAIL %s: %v\n", check.name, err)
+		} else {
+			fmt.Printf("   ✅ PASS %s\n", check.name)
+			passed++
+		}
+	}
+
+	fmt.Println()
+	if passed != len(checks) {
+		fmt.Printf("❌ FAIL (%d of %d checks passed)\n", passed, len(checks))
+		return false
+	}
+	fmt.Printf("✅ PASS (%d checks)\n", len(checks))
+	return true
+}
+
+// remoteRootPrefix marks a set entry scanned with a remote shell, e.g. ssh://user@host:22/backup
+const remoteRootPrefix = "ssh://"
+
+// sftpRootPrefix marks a set entry read over SFTP, e.g. sftp://user@host:22/backup
+const sftpRootPrefix = "sftp://"
+
+// isRemoteRoot reports whether a set entry refers to a remote directory
+func isRemoteRoot(dir string) bool {
+	return strings.HasPrefix(dir, remoteRootPrefix) || strings.HasPrefix(dir, sftpRootPrefix)
+}
+
+// splitRemoteRoots separates local directories from remote ones, keeping their order
+func splitRemoteRoots(dirs []string) ([]string, []string) {
+	var local, remote []string
+	for _, dir := range dirs {
+		if isRemoteRoot(dir) {
+			remote = append(remote, dir)
+		} else {
+			local = append(local, dir)
+		}
+	}
+	return local, remote
+}
+
+// RemoteRoot is a parsed ssh:// or sftp:// set entry
+type RemoteRoot struct {
+	Target string // user@host passed to ssh or sftp
+	Port   string // Empty for the client's default
+	Path   string // Directory on the remote host
+	SFTP   bool   // Read over SFTP instead of running commands in a remote shell
+}
+
+// parseRemoteRoot parses ssh://[user@]host[:port]/path and sftp://[user@]host[:port]/path
+func parseRemoteRoot(root string) (*RemoteRoot, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "ssh" && u.Scheme != "sftp") || u.Hostname() == "" {
+		return nil, fmt.Errorf("expected ssh://[user@]host[:port]/path or sftp://[user@]host[:port]/path")
+	}
+	if u.Path == "" {
+		return nil, fmt.Errorf("missing remote directory path")
+	}
+
+	target := u.Hostname()
+	if u.User != nil && u.User.Username() != "" {
+		target = u.User.Username() + "@" + target
+	}
+	return &RemoteRoot{Target: target, Port: u.Port(), Path: u.Path, SFTP: u.Scheme == "sftp"}, nil
+}
+
+// shellQuote quotes a string for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteNoDirectoryStatus is the exit status of the remote scripts when the root directory can't be entered.
+// It tells a missing or unreadable root apart from find's status 1 after a single unreadable subdirectory.
+const remoteNoDirectoryStatus = 97
+
+// remoteListingScript builds the shell script that lists the remote root. For every regular file it prints
+// "<size>\t<mtime>\t<relative path>" terminated by a NUL byte, so any file name can be parsed. Files that
+// can't be read are left out, with the shell's message on stderr.
+func remoteListingScript(path string) string {
+	perFile := `for f; do s=$(wc -c < "$f" | tr -d " ") && [ -n "$s" ] && printf "%s\t%s\t%s\000" ` +
+		`"$s" ` +
+		`"$(stat -c %Y "$f" 2>/dev/null || stat -f %m "$f")" ` +
+		`"${f#./}"; done`
+	return "cd -- " + shellQuote(path) + " || exit " + strconv.Itoa(remoteNoDirectoryStatus) + "; " +
+		"find . -type f -exec sh -c " + shellQuote(perFile) + " sh {} +"
+}
+
+// remoteHashScript builds the shell script that hashes the NUL-separated relative paths it reads on stdin,
+// printing "<sha256>\t<relative path>" terminated by a NUL byte for each file it could read
+func remoteHashScript(path string) string {
+	perFile := `for f; do h=$( { sha256sum 2>/dev/null || shasum -a 256; } < "$f" | cut -d" " -f1) && ` +
+		`[ -n "$h" ] && printf "%s\t%s\000" "$h" "$f"; done`
+	return "cd -- " + shellQuote(path) + " || exit " + strconv.Itoa(remoteNoDirectoryStatus) + "; " +
+		"xargs -0 sh -c " + shellQuote(perFile) + " sh"
+}
+
+// runRemoteCommand runs a script on a remote host with the system ssh client, so existing keys,
+// agents and ~/.ssh/config apply. The script reads stdin. Output is returned even when the script
+// exits non-zero, along with whatever it printed on stderr. It is a variable so tests can run the
+// script locally.
+var runRemoteCommand = func(remote *RemoteRoot, script string, stdin []byte) ([]byte, string, error) {
+	args := []string{"-o", "BatchMode=yes"}
+	if remote.Port != "" {
+		args = append(args, "-p", remote.Port)
+	}
+	args = append(args, remote.Target, script)
+
+	// #nosec G204 - the user chooses the remote host to compare against
+	cmd := exec.Command("ssh", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	return output, stderr.String(), err
+}
+
+// remoteCommandFailed reports whether a remote script failed as a whole: ssh couldn't run it (status 255
+// or no status at all) or the root couldn't be entered. Any other status, such as find's 1 after meeting
+// an unreadable subdirectory, still leaves usable output.
+func remoteCommandFailed(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err != nil
+	}
+	status := exitErr.ExitCode()
+	return status == 255 || status == remoteNoDirectoryStatus
+}
+
+// remoteErrorWarnings turns each line a remote script printed on stderr into a warning for root
+func remoteErrorWarnings(stderr string, root string) []ScanWarning {
+	var warnings []ScanWarning
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		reason := WarningReadError
+		if strings.Contains(strings.ToLower(line), "permission denied") {
+			reason = WarningPermissionDenied
+		}
+		warnings = append(warnings, ScanWarning{Reason: reason, Path: root, Message: fmt.Sprintf("Remote set %s: %s", root, line)})
+	}
+	return warnings
+}
+
+// remoteFileInfo adapts a remote listing entry to os.FileInfo so filters apply to remote files too
+type remoteFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (r remoteFileInfo) Name() string       { return r.name }
+func (r remoteFileInfo) Size() int64        { return r.size }
+func (r remoteFileInfo) Mode() os.FileMode  { return 0o644 }
+func (r remoteFileInfo) ModTime() time.Time { return r.modTime }
+func (r remoteFileInfo) IsDir() bool        { return false }
+func (r remoteFileInfo) Sys() interface{}   { return nil }
+
+// parseRemoteListing turns the output of remoteListingScript into FileInfos rooted at root, still without hashes
+func parseRemoteListing(output []byte, root string) ([]*FileInfo, []ScanWarning) {
+	var files []*FileInfo
+	var warnings []ScanWarning
+	for _, record := range strings.Split(string(output), "\x00") {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		fields := strings.SplitN(record, "\t", 3)
+		if len(fields) != 3 {
+			warnings = append(warnings, ScanWarning{Reason: WarningReadError, Path: root,
+				Message: fmt.Sprintf("Could not parse remote listing entry %q from %s", record, root)})
+			continue
+		}
+		size, sizeErr := strconv.ParseInt(fields[0], 10, 64)
+		modTime, modErr := strconv.ParseInt(fields[1], 10, 64)
+		if sizeErr != nil || modErr != nil {
+			warnings = append(warnings, ScanWarning{Reason: WarningReadError, Path: root,
+				Message: fmt.Sprintf("Could not parse remote listing entry %q from %s", record, root)})
+			continue
+		}
+
+		relPath := filepath.FromSlash(fields[2])
+		files = append(files, &FileInfo{
+			RelativePath: relPath,
+			AbsolutePath: strings.TrimSuffix(root, "/") + "/" + fields[2],
+			Name:         filepath.Base(relPath),
+			Size:         size,
+			RootDir:      root,
+			ModTime:      time.Unix(modTime, 0),
+		})
+	}
+	return files, warnings
+}
+
+// parseRemoteHashes turns the output of remoteHashScript into a map from relative path (with forward slashes) to hash
+func parseRemoteHashes(output []byte) map[string]string {
+	hashes := make(map[string]string)
+	for _, record := range strings.Split(string(output), "\x00") {
+		if hash, path, ok := strings.Cut(record, "\t"); ok && hash != "" {
+			hashes[path] = hash
+		}
+	}
+	return hashes
+}
+
+// runSFTPBatch runs sftp batch commands against a remote host with the system sftp client, so existing keys,
+// agents and ~/.ssh/config apply and SFTP-only or chrooted accounts work. Commands prefixed with "-" keep
+// the batch going after they fail, with the client's message on stderr. Output is returned even on failure.
+// It is a variable so tests can stand in for the server.
+var runSFTPBatch = func(remote *RemoteRoot, batch string) ([]byte, string, error) {
+	args := []string{"-q", "-b", "-"}
+	if remote.Port != "" {
+		args = append(args, "-P", remote.Port)
+	}
+	args = append(args, remote.Target)
+
+	// #nosec G204 - the user chooses the remote host to compare against
+	cmd := exec.Command("sftp", args...)
+	cmd.Stdin = strings.NewReader(batch)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	return output, stderr.String(), err
+}
+
+// sftpQuote quotes a path for an sftp batch command. Quoting also keeps sftp from expanding glob characters.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// sftpEchoPrefix starts the line sftp echoes to stdout for every batch command it runs
+const sftpEchoPrefix = "sftp> "
+
+// sftpEntry is one line of sftp's "ls -lan" output
+type sftpEntry struct {
+	name    string
+	kind    byte // First character of the mode: '-' for regular files, 'd' for directories
+	size    int64
+	modTime time.Time // To the minute at best; replaced by the exact time once the file is downloaded
 }
 
-// readUserInput reads a line of input from the user with a prompt
-func readUserInput(prompt string) string {
-	fmt.Print(prompt)
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	return strings.TrimSpace(scanner.Text())
+// parseSFTPListLine parses a line of "ls -lan" output, e.g.
+// "-rw-r--r--    1 1000     1000         5 Oct 17 05:34 /backup/a.txt". Recent files show a time,
+// older ones a year. The name may carry the listed directory, so only its last element is kept.
+func parseSFTPListLine(line string, now time.Time) (sftpEntry, bool) {
+	rest := line
+	var fields []string
+	for len(fields) < 8 {
+		rest = strings.TrimLeft(rest, " ")
+		end := strings.IndexByte(rest, ' ')
+		if end < 0 {
+			return sftpEntry{}, false
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	// Exactly one space separates the date from the name, which may itself start with spaces
+	name := strings.TrimPrefix(rest, " ")
+	size, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil || len(fields[0]) == 0 || name == "" {
+		return sftpEntry{}, false
+	}
+
+	date := fields[5] + " " + fields[6] + " " + fields[7]
+	modTime, err := time.ParseInLocation("Jan 2 2006", date, time.Local)
+	if err != nil {
+		if modTime, err = time.ParseInLocation("Jan 2 15:04", date, time.Local); err != nil {
+			return sftpEntry{}, false
+		}
+		// Times are only shown for the last six months, so a date after today is from last year
+		modTime = modTime.AddDate(now.Year(), 0, 0)
+		if modTime.After(now) {
+			modTime = modTime.AddDate(-1, 0, 0)
+		}
+	}
+	return sftpEntry{name: path.Base(name), kind: fields[0][0], size: size, modTime: modTime}, true
 }
 
-// readYesNo reads a yes/no response from the user
-func readYesNo(prompt string) bool {
-	for {
-		response := strings.ToLower(readUserInput(prompt))
-		if response == "y" || response == "yes" {
-			return true
+// listSFTPRoot walks a remote directory over sftp, one session per directory level, and returns its regular
+// files with sizes and approximate times but no hashes. Subdirectories that can't be listed become warnings;
+// a root that can't be listed, or a client that can't connect, is an error.
+func listSFTPRoot(remote *RemoteRoot, root string) ([]*FileInfo, []ScanWarning, error) {
+	var files []*FileInfo
+	var warnings []ScanWarning
+	now := time.Now()
+	pending := []string{"."}
+	for level := 0; len(pending) > 0; level++ {
+		var batch strings.Builder
+		for _, dir := range pending {
+			batch.WriteString("-ls -lan " + sftpQuote(path.Join(remote.Path, dir)) + "\n")
 		}
-		if response == "n" || response == "no" {
-			return false
+		output, stderr, err := runSFTPBatch(remote, batch.String())
+		if err != nil {
+			if detail := strings.TrimSpace(stderr); detail != "" {
+				err = fmt.Errorf("%v: %s", err, detail)
+			}
+			return nil, nil, err
 		}
-		fmt.Println("Please enter 'y' or 'n'")
+
+		var next []string
+		section, entries := -1, 0
+		for _, line := range strings.Split(string(output), "\n") {
+			if strings.HasPrefix(line, sftpEchoPrefix) {
+				section++
+				continue
+			}
+			entry, ok := parseSFTPListLine(line, now)
+			if !ok || section < 0 || section >= len(pending) || entry.name == "." || entry.name == ".." {
+				continue
+			}
+			entries++
+			relPath := path.Join(pending[section], entry.name)
+			switch entry.kind {
+			case 'd':
+				next = append(next, relPath)
+			case '-':
+				files = append(files, &FileInfo{
+					RelativePath: filepath.FromSlash(relPath),
+					AbsolutePath: strings.TrimSuffix(root, "/") + "/" + relPath,
+					Name:         entry.name,
+					Size:         entry.size,
+					RootDir:      root,
+					ModTime:      entry.modTime,
+				})
+			default:
+				// sftp reports links as links without following them; only what is certainly a file is compared
+				warnings = append(warnings, ScanWarning{Reason: WarningNotRegular, Path: root + "/" + relPath,
+					Message: fmt.Sprintf("Skipping remote non-regular file %s/%s", strings.TrimSuffix(root, "/"), relPath)})
+			}
+		}
+
+		if level == 0 && entries == 0 && strings.TrimSpace(stderr) != "" {
+			return nil, nil, errors.New(strings.TrimSpace(stderr))
+		}
+		warnings = append(warnings, remoteErrorWarnings(stderr, root)...)
+		pending = next
 	}
+	return files, warnings, nil
 }
 
-// runInteractiveMode runs the tool in interactive mode when no arguments are provided
-func runInteractiveMode(execName string) ([]string, []string, bool, bool, bool, bool) {
-	fmt.Println("Directory Comparison Tool - Interactive Mode")
-	fmt.Println("=============================================")
-	fmt.Println()
-	fmt.Println("No arguments provided. Starting interactive mode...")
-	fmt.Println()
+// Limits on how much data one sftp session downloads before its files are hashed and deleted
+const (
+	sftpBatchFiles = 256
+	sftpBatchBytes = 256 * 1024 * 1024
+)
 
-	example1, example2, multiExample1, _ := getOSSpecificExamples()
+// hashSFTPFiles downloads files over sftp into a temporary directory a batch at a time and hashes them
+// locally the way the scan hashes local files, so every hash mode and --buffer-size apply. Files that
+// couldn't be downloaded keep an empty hash; the client's messages are returned as warnings.
+func hashSFTPFiles(fileSet *FileSet, remote *RemoteRoot, root string, files []*FileInfo, opts ScanOptions) ([]ScanWarning, error) {
+	tempDir, err := os.MkdirTemp("", "dir-compare-sftp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
 
-	fmt.Printf("Example: If you want to compare your photos folder with your backup:\n")
-	fmt.Printf("- Set 1 could be: %s\n", example1)
-	fmt.Printf("- Set 2 could be: %s\n", example2)
-	fmt.Println()
+	var warnings []ScanWarning
+	buf := newHashBuffer(opts.BufferSize)
+	for start := 0; start < len(files); {
+		if scanStopped(opts) {
+			fileSet.Partial = true
+			break
+		}
+		end, batchBytes := start, int64(0)
+		var batch strings.Builder
+		for end < len(files) && end-start < sftpBatchFiles && (end == start || batchBytes+files[end].Size <= sftpBatchBytes) {
+			remotePath := path.Join(remote.Path, filepath.ToSlash(files[end].RelativePath))
+			localPath := filepath.Join(tempDir, strconv.Itoa(end))
+			batch.WriteString("-get -p " + sftpQuote(remotePath) + " " + sftpQuote(localPath) + "\n")
+			batchBytes += files[end].Size
+			end++
+		}
 
-	set1Input := readUserInput(fmt.Sprintf("Enter Set 1 directories (comma-separated if multiple):\nExample: %s or %s\n> ", example1, multiExample1))
-	for set1Input == "" {
-		fmt.Println("Set 1 directories cannot be empty.")
-		set1Input = readUserInput("> ")
+		_, stderr, err := runSFTPBatch(remote, batch.String())
+		if err != nil {
+			return warnings, err
+		}
+		batchErrors := remoteErrorWarnings(stderr, root)
+		warnings = append(warnings, batchErrors...)
+
+		for i := start; i < end; i++ {
+			file, localPath := files[i], filepath.Join(tempDir, strconv.Itoa(i))
+			info, err := os.Stat(localPath)
+			if err != nil {
+				// The client normally says why; only files it said nothing about get a warning of their own
+				if len(batchErrors) == 0 {
+					warnings = append(warnings, ScanWarning{Reason: WarningReadError, Path: file.AbsolutePath,
+						Message: fmt.Sprintf("Could not download remote file %s", file.AbsolutePath)})
+				}
+				continue
+			}
+			hash, err := hashFileContent(localPath, opts, buf)
+			os.Remove(localPath)
+			if err != nil {
+				warnings = append(warnings, readWarning(file.AbsolutePath, err, fmt.Sprintf("Could not hash remote file %s: %v", file.AbsolutePath, err)))
+				continue
+			}
+			// get -p keeps the remote modification time, which is exact unlike the listing's
+			file.Hash, file.Size, file.ModTime = hash, info.Size(), info.ModTime()
+		}
+		start = end
 	}
+	return warnings, nil
+}
 
-	set2Input := readUserInput(fmt.Sprintf("Enter Set 2 directories (comma-separated if multiple):\nExample: %s\n> ", example2))
-	for set2Input == "" {
-		fmt.Println("Set 2 directories cannot be empty.")
-		set2Input = readUserInput("> ")
+// scanRemoteRoot lists a remote directory, applies the filter and limit, then hashes only the selected
+// files and adds them to fileSet. ssh:// roots are listed and hashed by a remote shell, so only hashes cross
+// the network; sftp:// roots are listed and downloaded over SFTP and hashed locally.
+func scanRemoteRoot(fileSet *FileSet, root string, limit int, opts ScanOptions) {
+	fileSet.Roots = append(fileSet.Roots, root)
+	skipRoot := func(err error, stderr string) {
+		if detail := strings.TrimSpace(stderr); detail != "" {
+			err = fmt.Errorf("%v: %s", err, detail)
+		}
+		recordWarning(&fileSet.Warnings, opts, readWarning(root, err, fmt.Sprintf("Cannot read remote set %s: %v, skipping...", root, err)))
+		fileSet.MissingRoots = append(fileSet.MissingRoots, root)
 	}
 
-	fmt.Println()
-	showModified := readYesNo("Show files that were modified (same name, different content)? (y/n): ")
-	showUniqueToSet2 := readYesNo("Show files unique to Set 2 (files in Set 2 not in Set 1)? (y/n): ")
-	showUniqueToSet1 := readYesNo("Show files unique to Set 1 (files in Set 1 not in Set 2)? (y/n): ")
-	showDetails := readYesNo("Show file size details? (y/n): ")
+	remote, err := parseRemoteRoot(root)
+	if err == nil && !remote.SFTP && hashMode(opts) != HashSHA256 {
+		// The remote host hashes whole files with sha256sum; any other mode would never match local hashes
+		err = fmt.Errorf("ssh:// sets can only be hashed with plain sha256, not %s; use sftp:// to hash locally", hashMode(opts))
+	}
+	if err != nil {
+		skipRoot(err, "")
+		return
+	}
 
-	set1Dirs := strings.Split(set1Input, ",")
-	set2Dirs := strings.Split(set2Input, ",")
+	var files []*FileInfo
+	if remote.SFTP {
+		var warnings []ScanWarning
+		if files, warnings, err = listSFTPRoot(remote, root); err != nil {
+			skipRoot(err, "")
+			return
+		}
+		for _, warning := range warnings {
+			recordWarning(&fileSet.Warnings, opts, warning)
+		}
+	} else {
+		listing, stderr, err := runRemoteCommand(remote, remoteListingScript(remote.Path), nil)
+		if remoteCommandFailed(err) {
+			skipRoot(err, stderr)
+			return
+		}
+		var warnings []ScanWarning
+		files, warnings = parseRemoteListing(listing, root)
+		for _, warning := range append(remoteErrorWarnings(stderr, root), warnings...) {
+			recordWarning(&fileSet.Warnings, opts, warning)
+		}
+	}
 
-	// Clean up directory paths
-	for i := range set1Dirs {
-		set1Dirs[i] = strings.TrimSpace(set1Dirs[i])
+	// Filter and limit on the listing, so only the files that will be compared are read and hashed
+	var selected []*FileInfo
+	now := time.Now()
+	for _, file := range files {
+		if limit > 0 && len(fileSet.Files)+len(selected) >= limit {
+			break
+		}
+		if opts.Filter != nil && !opts.Filter.Match(remoteFileInfo{name: file.Name, size: file.Size, modTime: file.ModTime}, now) {
+			continue
+		}
+		selected = append(selected, file)
 	}
-	for i := range set2Dirs {
-		set2Dirs[i] = strings.TrimSpace(set2Dirs[i])
+	if len(selected) == 0 {
+		return
 	}
 
-	// Show preview
-	fmt.Println()
-	fmt.Println("📋 Let's show you a quick preview with the first 10 files...")
-	fmt.Println()
-	runPreview(set1Dirs, set2Dirs, 10, showDetails, showModified, showUniqueToSet1, showUniqueToSet2)
+	if remote.SFTP {
+		warnings, err := hashSFTPFiles(fileSet, remote, root, selected, opts)
+		for _, warning := range warnings {
+			recordWarning(&fileSet.Warnings, opts, warning)
+		}
+		if err != nil {
+			skipRoot(err, "")
+			return
+		}
+	} else {
+		var paths bytes.Buffer
+		for _, file := range selected {
+			paths.WriteString(filepath.ToSlash(file.RelativePath))
+			paths.WriteByte(0)
+		}
+		output, stderr, err := runRemoteCommand(remote, remoteHashScript(remote.Path), paths.Bytes())
+		if remoteCommandFailed(err) {
+			skipRoot(err, stderr)
+			return
+		}
+		hashErrors := remoteErrorWarnings(stderr, root)
+		for _, warning := range hashErrors {
+			recordWarning(&fileSet.Warnings, opts, warning)
+		}
 
-	fmt.Println()
-	if !readYesNo("Continue with full scan? (y/n): ") {
-		fmt.Println("Exiting...")
-		os.Exit(0)
+		hashes := parseRemoteHashes(output)
+		for _, file := range selected {
+			file.Hash = hashes[filepath.ToSlash(file.RelativePath)]
+			// The remote shell normally says why; only files it said nothing about get a warning of their own
+			if file.Hash == "" && len(hashErrors) == 0 {
+				recordWarning(&fileSet.Warnings, opts, ScanWarning{Reason: WarningReadError, Path: file.AbsolutePath,
+					Message: fmt.Sprintf("Could not hash remote file %s", file.AbsolutePath)})
+			}
+		}
 	}
 
-	fmt.Println()
-	return set1Dirs, set2Dirs, showModified, showUniqueToSet2, showUniqueToSet1, showDetails
+	for _, file := range selected {
+		if file.Hash == "" {
+			continue
+		}
+		fileSet.Files = append(fileSet.Files, file)
+		fileSet.NameMap[file.Name] = append(fileSet.NameMap[file.Name], file)
+		fileSet.HashMap[file.Hash] = append(fileSet.HashMap[file.Hash], file)
+	}
 }
 
-func main() {
-	execName := filepath.Base(os.Args[0])
+// manifestVersion is the format version written to manifest files
+const manifestVersion = 1
+
+// Manifest is a FileSet serialized to JSON so sets can be hashed on one machine and compared on another
+type Manifest struct {
+	Version       int            `json:"version"`
+	Created       time.Time      `json:"created"`
+	Hostname      string         `json:"hostname,omitempty"`
+	HashAlgorithm string         `json:"hashAlgorithm,omitempty"`
+	Roots         []string       `json:"roots"`
+	Files         []ManifestFile `json:"files"`
+}
 
-	var set1Dirs, set2Dirs []string
-	var showDetails, showUniqueToSet1, showModified, showUniqueToSet2 bool
+// ManifestFile is one file entry of a Manifest
+type ManifestFile struct {
+	Path    string    `json:"path"` // Relative to Root, always with forward slashes
+	Root    string    `json:"root"`
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
 
-	if len(os.Args) < 3 {
-		// Interactive mode or show help
-		if len(os.Args) == 1 {
-			// No arguments - start interactive mode
-			set1Dirs, set2Dirs, showModified, showUniqueToSet2, showUniqueToSet1, showDetails = runInteractiveMode(execName)
-		} else {
-			// Not enough arguments - show help
-			example1, example2, multiExample1, multiExample2 := getOSSpecificExamples()
+// buildManifest converts a scanned FileSet into a Manifest with files sorted by root and path
+func buildManifest(fileSet *FileSet, algorithm string) *Manifest {
+	if algorithm == "" {
+		algorithm = HashSHA256
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
 
-			fmt.Println("Directory Comparison Tool")
-			fmt.Println("=========================")
-			fmt.Println()
-			fmt.Printf("Usage: %s <set1_dirs> <set2_dirs> [options]\n", execName)
-			fmt.Println()
-			fmt.Println("Arguments:")
-			fmt.Println("  set1_dirs    Comma-separated list of directories in the first set")
-			fmt.Println("  set2_dirs    Comma-separated list of directories in the second set")
-			fmt.Println()
-			fmt.Println("Options:")
-			fmt.Println("  --details         Show file sizes and additional details")
-			fmt.Println("  --show-modified   Show files with same name but different content")
-			fmt.Println("  --show-unique-2   Show files unique to set 2")
-			fmt.Println("  --show-unique-1   Show files unique to set 1")
-			fmt.Println("  --preview         Show preview with first 10 files")
-			fmt.Println("  --preview-count N Set number of files to process in preview mode")
-			fmt.Println()
-			fmt.Println("Example:")
-			fmt.Printf("  %s %s %s\n", execName, multiExample1, multiExample2)
-			fmt.Printf("  %s %s %s --details --show-unique-1\n", execName, example1, example2)
-			fmt.Println()
-			fmt.Println("Or run without arguments for interactive mode:")
-			fmt.Printf("  %s\n", execName)
-			os.Exit(1)
+	manifest := &Manifest{
+		Version:       manifestVersion,
+		Created:       time.Now().UTC(),
+		Hostname:      hostname,
+		HashAlgorithm: algorithm,
+		Roots:         fileSet.Roots,
+		Files:         make([]ManifestFile, 0, len(fileSet.Files)),
+	}
+	for _, file := range fileSet.Files {
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Path:    filepath.ToSlash(file.RelativePath),
+			Root:    file.RootDir,
+			Hash:    file.Hash,
+			Size:    file.Size,
+			ModTime: file.ModTime.UTC(),
+		})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		if manifest.Files[i].Root != manifest.Files[j].Root {
+			return manifest.Files[i].Root < manifest.Files[j].Root
 		}
-	} else {
-		// Command line mode
-		set1Dirs = strings.Split(os.Args[1], ",")
-		set2Dirs = strings.Split(os.Args[2], ",")
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	return manifest
+}
 
-		// Parse flags
-		var isPreview bool
-		var previewCount int = 10 // default preview count
-		for i := 3; i < len(os.Args); i++ {
-			switch os.Args[i] {
-			case "--details":
-				showDetails = true
-			case "--show-unique-1":
-				showUniqueToSet1 = true
-			case "--show-unique-2":
-				showUniqueToSet2 = true
-			case "--show-modified":
-				showModified = true
-			case "--preview":
-				isPreview = true
-			case "--preview-count":
-				if i+1 < len(os.Args) {
-					if count, err := strconv.Atoi(os.Args[i+1]); err != nil || count < 1 {
-						fmt.Printf("Invalid preview count: %s. Using default of 10.\n", os.Args[i+1])
-						previewCount = 10
-					} else {
-						previewCount = count
-					}
-					i++ // skip next argument
-				}
-				isPreview = true
+// writeManifest writes a FileSet to path as an indented JSON manifest
+func writeManifest(path string, fileSet *FileSet, algorithm string) error {
+	data, err := json.MarshalIndent(buildManifest(fileSet, algorithm), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// loadManifest reads a JSON manifest back into a FileSet without touching the files it describes
+func loadManifest(path string) (*FileSet, *Manifest, error) {
+	// #nosec G304 - path is intentionally user-provided
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest %s: %v", path, err)
+	}
+	if manifest.Version > manifestVersion {
+		return nil, nil, fmt.Errorf("manifest %s has version %d, newer than supported version %d", path, manifest.Version, manifestVersion)
+	}
+
+	fileSet := &FileSet{
+		Files:   make([]*FileInfo, 0, len(manifest.Files)),
+		NameMap: make(map[string][]*FileInfo),
+		HashMap: make(map[string][]*FileInfo),
+		Roots:   manifest.Roots,
+	}
+	for _, entry := range manifest.Files {
+		if entry.Path == "" || entry.Hash == "" {
+			return nil, nil, fmt.Errorf("invalid manifest %s: file entry without path or hash", path)
+		}
+		relPath := filepath.FromSlash(entry.Path)
+		fileInfo := &FileInfo{
+			RelativePath: relPath,
+			AbsolutePath: filepath.Join(entry.Root, relPath),
+			Name:         filepath.Base(relPath),
+			Hash:         entry.Hash,
+			Size:         entry.Size,
+			RootDir:      entry.Root,
+			ModTime:      entry.ModTime,
+		}
+		fileSet.Files = append(fileSet.Files, fileInfo)
+		fileSet.NameMap[fileInfo.Name] = append(fileSet.NameMap[fileInfo.Name], fileInfo)
+		fileSet.HashMap[fileInfo.Hash] = append(fileSet.HashMap[fileInfo.Hash], fileInfo)
+	}
+	return fileSet, &manifest, nil
+}
+
+// manifestAlgorithm returns the hash mode a manifest was written with. Manifests that don't record it
+// (e.g. converted from another tool's checksum list) are recognized by the length of their hashes:
+// 32 hex characters for MD5, 40 for git blob IDs and 64 for SHA256, which is also the fallback.
+func manifestAlgorithm(manifest *Manifest) string {
+	if manifest.HashAlgorithm != "" {
+		return manifest.HashAlgorithm
+	}
+	if len(manifest.Files) == 0 {
+		return HashSHA256
+	}
+
+	length := len(manifest.Files[0].Hash)
+	for _, file := range manifest.Files {
+		if len(file.Hash) != length {
+			return HashSHA256
+		}
+	}
+	switch length {
+	case 32:
+		return HashMD5
+	case 40:
+		return HashGit
+	default:
+		return HashSHA256
+	}
+}
+
+// useManifestHashMode makes a live scan hash files the way a manifest was hashed, so matching content
+// gets matching hashes. Hashing options given explicitly must agree with the manifest.
+func useManifestHashMode(opts *ScanOptions, manifest *Manifest) (string, error) {
+	mode := manifestAlgorithm(manifest)
+	explicit := opts.HashAlgorithm != "" || opts.IgnoreTrailingNulls || opts.IgnoreBOM || opts.HashSkipBytes > 0 || opts.HashLimitBytes > 0
+	if explicit && hashMode(*opts) != mode {
+		return "", fmt.Errorf("manifest was hashed with %s but this scan would use %s; drop --hash or match the manifest", mode, hashMode(*opts))
+	}
+	if err := applyHashMode(opts, mode); err != nil {
+		return "", fmt.Errorf("manifest uses %s: %v", mode, err)
+	}
+	return mode, nil
+}
+
+// runExportManifest scans one set of directories and writes it as a manifest for a later --compare-manifests
+func runExportManifest(outPath string, dirs []string, scanOpts ScanOptions) {
+	fmt.Printf("🔍 Analyzing %s...\n", strings.Join(dirs, ", "))
+	fileSet, err := walkDirectoriesWithOptions(dirs, -1, scanOpts)
+	if err != nil {
+		fmt.Printf("❌ Error analyzing directories: %v\n", err)
+		os.Exit(1)
+	}
+	if allRootsMissing(fileSet) {
+		fmt.Printf("❌ None of the directories exist: %s\n", strings.Join(fileSet.MissingRoots, ", "))
+		os.Exit(exitCodeMissingSet)
+	}
+
+	if err := writeManifest(outPath, fileSet, hashMode(scanOpts)); err != nil {
+		fmt.Printf("❌ Error writing manifest: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("💾 Manifest of %d files written to %s\n", len(fileSet.Files), outPath)
+}
+
+// CoverageReport is the result of checking a live set against several backup manifests with --coverage
+type CoverageReport struct {
+	NotBackedUp []*FileInfo // Live files whose content is in none of the manifests
+	Covered     int         // Live files whose content is in at least one manifest
+	ByManifest  []int       // Live files whose content is in each manifest, in the order given
+}
+
+// checkCoverage looks up every live file's content in each backup set. Only content counts: a file
+// that was renamed or moved since the backup is still backed up.
+func checkCoverage(live *FileSet, backups []*FileSet) CoverageReport {
+	report := CoverageReport{ByManifest: make([]int, len(backups))}
+	for _, file := range live.Files {
+		found := false
+		for i, backup := range backups {
+			if _, ok := backup.HashMap[file.Hash]; ok {
+				report.ByManifest[i]++
+				found = true
 			}
 		}
+		if found {
+			report.Covered++
+		} else {
+			report.NotBackedUp = append(report.NotBackedUp, file)
+		}
+	}
+	return report
+}
 
-		// If preview mode, run preview and exit
-		if isPreview {
-			runPreview(set1Dirs, set2Dirs, previewCount, showDetails, showModified, showUniqueToSet1, showUniqueToSet2)
-			return
+// mergeBackupHashes returns a FileSet holding the content of every backup, so the tree of files that
+// aren't backed up can mark whole directories of which nothing is backed up anywhere
+func mergeBackupHashes(backups []*FileSet) *FileSet {
+	merged := &FileSet{HashMap: make(map[string][]*FileInfo)}
+	for _, backup := range backups {
+		for hash, files := range backup.HashMap {
+			merged.HashMap[hash] = append(merged.HashMap[hash], files...)
 		}
+	}
+	return merged
+}
 
-		// Clean up directory paths
-		for i := range set1Dirs {
-			set1Dirs[i] = strings.TrimSpace(set1Dirs[i])
+// runCoverage hashes one live set the way the manifests were hashed and reports every file whose
+// content is in none of them. It returns false when some file isn't backed up anywhere.
+func runCoverage(manifestPaths []string, dirs []string, scanOpts ScanOptions, treeOpts TreeDisplayOptions, flatten bool) bool {
+	var backups []*FileSet
+	var manifests []*Manifest
+	for _, path := range manifestPaths {
+		fmt.Printf("📥 Loading manifest %s...\n", path)
+		backup, manifest, err := loadManifest(path)
+		if err != nil {
+			fmt.Printf("❌ Error loading manifest: %v\n", err)
+			os.Exit(1)
 		}
-		for i := range set2Dirs {
-			set2Dirs[i] = strings.TrimSpace(set2Dirs[i])
+		fmt.Printf("   Found %d files (hashed on %s at %s)\n", len(backup.Files), manifest.Hostname, manifest.Created.Local().Format("2006-01-02 15:04:05"))
+		if len(manifests) > 0 && manifestAlgorithm(manifest) != manifestAlgorithm(manifests[0]) {
+			fmt.Printf("❌ Manifests use different hash algorithms (%s vs %s) and can't be checked together\n", manifestAlgorithm(manifests[0]), manifestAlgorithm(manifest))
+			os.Exit(1)
 		}
+		backups = append(backups, backup)
+		manifests = append(manifests, manifest)
 	}
-
-	fmt.Println("Directory Comparison Tool")
-	fmt.Println("=========================")
 	fmt.Println()
 
-	fmt.Printf("📂 Set 1 directories: %s\n", strings.Join(set1Dirs, ", "))
-	fmt.Printf("📂 Set 2 directories: %s\n", strings.Join(set2Dirs, ", "))
-	fmt.Println()
-
-	fmt.Println("🔍 Analyzing first set of directories...")
-	set1, err := walkDirectories(set1Dirs)
-	if err != nil {
-		fmt.Printf("❌ Error analyzing first set: %v\n", err)
+	if _, err := useManifestHashMode(&scanOpts, manifests[0]); err != nil {
+		fmt.Printf("❌ %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("   Found %d files\n", len(set1.Files))
-
-	fmt.Println("🔍 Analyzing second set of directories...")
-	set2, err := walkDirectories(set2Dirs)
+	fmt.Printf("🔍 Analyzing %s with %s to match the manifests...\n", strings.Join(dirs, ", "), hashMode(scanOpts))
+	live, err := walkDirectoriesWithOptions(dirs, -1, scanOpts)
 	if err != nil {
-		fmt.Printf("❌ Error analyzing second set: %v\n", err)
+		fmt.Printf("❌ Error analyzing directories: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("   Found %d files\n", len(set2.Files))
+	if allRootsMissing(live) {
+		fmt.Printf("❌ None of the directories exist: %s\n", strings.Join(live.MissingRoots, ", "))
+		os.Exit(exitCodeMissingSet)
+	}
+	fmt.Printf("   Found %d files\n", len(live.Files))
+	fmt.Println()
+
+	report := checkCoverage(live, backups)
+	fmt.Println("🗄️  Backup Coverage:")
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+	for i, path := range manifestPaths {
+		fmt.Printf("   • %s: %d of %d files\n", path, report.ByManifest[i], len(live.Files))
+	}
+	fmt.Printf("   • Backed up somewhere: %d of %d files\n", report.Covered, len(live.Files))
+	fmt.Println()
 
-	fmt.Println("🔍 Comparing file sets...")
-	result := compareFileSets(set1, set2)
+	if len(report.NotBackedUp) == 0 {
+		fmt.Println("✅ Every file is backed up in at least one manifest")
+		fmt.Println()
+		return true
+	}
 
+	var size int64
+	for _, file := range report.NotBackedUp {
+		size += file.Size
+	}
+	fmt.Printf("❌ Not backed up anywhere (%d files, %s):\n", len(report.NotBackedUp), formatSize(size))
 	fmt.Println()
+	printTreeByRoot(report.NotBackedUp, live, mergeBackupHashes(backups), treeOpts, flatten)
+	return false
+}
 
-	// First tree: Files with same name but different content (optional)
-	if showModified {
-		if len(result.SameNameDifferentHash) > 0 {
-			fmt.Printf("⚠️  Files with same name but different content (%d files) - Set 2 (%s) → Set 1 (%s):\n", len(result.SameNameDifferentHash), strings.Join(set2Dirs, ", "), strings.Join(set1Dirs, ", "))
-			fmt.Println("=" + strings.Repeat("=", 50))
-			fmt.Println()
+// Anonymizer replaces path components with stable placeholders for --anonymize, so reports can be shared
+// without revealing names. The same name always gets the same placeholder within a run, which keeps the
+// structure of the report (and which files share a name) intact. Placeholders are keyed with a random
+// per-run secret, so guessing a name and hashing it can't confirm it; the --anonymize-map file is the only
+// way back to the names.
+type Anonymizer struct {
+	key          []byte            // Random per-run secret mixed into every placeholder
+	placeholders map[string]string // kind + original name -> placeholder
+	originals    map[string]string // placeholder -> original name
+}
 
-			tree1 := buildTree(result.SameNameDifferentHash)
-			printTree(tree1, "", true, showDetails, result.NameMappings)
-			fmt.Println()
-		} else {
-			fmt.Println("✅ No files found with same name but different content.")
-			fmt.Println()
-		}
+// anonymizedHashLength is the number of hash characters in a placeholder, grown only to resolve collisions
+const anonymizedHashLength = 4
+
+// newAnonymizer creates an empty Anonymizer with a fresh random key
+func newAnonymizer() *Anonymizer {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key) // Never returns an error; the runtime aborts if no randomness is available
+	return &Anonymizer{key: key, placeholders: make(map[string]string), originals: make(map[string]string)}
+}
+
+// component returns the placeholder for one path component: dir_<hash> for directories and
+// file_<hash><ext> for files, keeping the extension. "." and ".." are left alone.
+func (a *Anonymizer) component(name string, isFile bool) string {
+	if name == "" || name == "." || name == ".." {
+		return name
+	}
+	if !isFile {
+		return a.placeholder("dir_", name, "")
+	}
+	ext := filepath.Ext(name)
+	if ext == name {
+		ext = "" // Dotfiles like .bashrc are all name, no extension
 	}
+	return a.placeholder("file_", name, ext)
+}
 
-	// Second tree: Files unique to set 2 (optional)
-	if showUniqueToSet2 {
-		if len(result.UniqueToSet2) > 0 {
-			fmt.Printf("📋 Files unique to Set 2 (%s) - not found in Set 1 (%s) (%d files):\n", strings.Join(set2Dirs, ", "), strings.Join(set1Dirs, ", "), len(result.UniqueToSet2))
-			fmt.Println("=" + strings.Repeat("=", 50))
-			fmt.Println()
+// placeholder returns prefix + keyed hash of name + ext, remembering it for the map. The hash is
+// lengthened only as far as needed to keep two names from sharing a placeholder.
+func (a *Anonymizer) placeholder(prefix, name, ext string) string {
+	key := prefix + name
+	if placeholder, ok := a.placeholders[key]; ok {
+		return placeholder
+	}
 
-			tree2 := buildSmartTree(result.UniqueToSet2, set2, set1)
-			printTree(tree2, "", true, showDetails, nil)
-			fmt.Println()
-		} else {
-			fmt.Println("✅ No unique files found in Set 2.")
-			fmt.Println()
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(name))
+	digest := fmt.Sprintf("%x", mac.Sum(nil))
+	for length := anonymizedHashLength; ; length++ {
+		placeholder := prefix + digest[:length] + ext
+		if _, taken := a.originals[placeholder]; !taken || length == len(digest) {
+			a.placeholders[key] = placeholder
+			a.originals[placeholder] = name
+			return placeholder
 		}
 	}
+}
 
-	// Third tree: Files unique to set 1 (optional)
-	if showUniqueToSet1 {
-		if len(result.UniqueToSet1) > 0 {
-			fmt.Printf("📋 Files unique to Set 1 (%s) - not found in Set 2 (%s) (%d files):\n", strings.Join(set1Dirs, ", "), strings.Join(set2Dirs, ", "), len(result.UniqueToSet1))
-			fmt.Println("=" + strings.Repeat("=", 50))
-			fmt.Println()
+// anonymizePath replaces every component of path, keeping separators, a volume name and an ssh:// or sftp:// prefix
+func (a *Anonymizer) anonymizePath(path string, lastIsFile bool) string {
+	prefix := ""
+	if isRemoteRoot(path) {
+		scheme, rest, _ := strings.Cut(path, "://")
+		prefix, path = scheme+"://", rest
+	} else {
+		prefix = filepath.VolumeName(path)
+		path = path[len(prefix):]
+	}
 
-			tree3 := buildSmartTree(result.UniqueToSet1, set1, set2)
-			printTree(tree3, "", true, showDetails, nil)
-			fmt.Println()
-		} else {
-			fmt.Println("✅ No unique files found in Set 1.")
-			fmt.Println()
+	isSeparator := func(c byte) bool { return c == '/' || c == filepath.Separator }
+	var builder strings.Builder
+	builder.WriteString(prefix)
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && !isSeparator(path[i]) {
+			continue
 		}
+		builder.WriteString(a.component(path[start:i], lastIsFile && i == len(path)))
+		if i < len(path) {
+			builder.WriteByte(path[i])
+		}
+		start = i + 1
 	}
+	return builder.String()
+}
 
-	// Summary
-	fmt.Println("📊 Summary:")
-	fmt.Printf("   • Files in Set 1: %d\n", len(set1.Files))
-	fmt.Printf("   • Files in Set 2: %d\n", len(set2.Files))
-	if showModified {
-		fmt.Printf("   • Same name, different content: %d\n", len(result.SameNameDifferentHash))
+// Path anonymizes a directory path. A nil Anonymizer returns path unchanged, so output code can call it unconditionally.
+func (a *Anonymizer) Path(path string) string {
+	if a == nil {
+		return path
 	}
-	if showUniqueToSet2 {
-		fmt.Printf("   • Unique to Set 2: %d\n", len(result.UniqueToSet2))
+	return a.anonymizePath(path, false)
+}
+
+// FilePath anonymizes a path whose last component is a file
+func (a *Anonymizer) FilePath(path string) string {
+	if a == nil {
+		return path
 	}
-	if showUniqueToSet1 {
-		fmt.Printf("   • Unique to Set 1: %d\n", len(result.UniqueToSet1))
+	return a.anonymizePath(path, true)
+}
+
+// Label anonymizes free text that names something, like --title or a --label1/--label2 value, as
+// <kind>_<hash>. A nil Anonymizer returns text unchanged.
+func (a *Anonymizer) Label(kind, text string) string {
+	if a == nil || text == "" {
+		return text
 	}
+	return a.placeholder(kind+"_", text, "")
+}
 
-	// Calculate sizes for different categories
-	var sameNameSize, uniqueSet2Size, uniqueSet1Size int64
+// Paths anonymizes a list of directory paths
+func (a *Anonymizer) Paths(paths []string) []string {
+	anonymized := make([]string, len(paths))
+	for i, path := range paths {
+		anonymized[i] = a.Path(path)
+	}
+	return anonymized
+}
 
-	if showModified {
-		for _, file := range result.SameNameDifferentHash {
-			sameNameSize += file.Size
-		}
+// Args anonymizes command line arguments for the report header: the two positional set lists, the
+// --title, --label1 and --label2 values, and any other argument that looks like a path
+func (a *Anonymizer) Args(args []string) []string {
+	if a == nil {
+		return args
 	}
-	if showUniqueToSet2 {
-		for _, file := range result.UniqueToSet2 {
-			uniqueSet2Size += file.Size
+	anonymized := make([]string, len(args))
+	for i, arg := range args {
+		previous := ""
+		if i > 0 {
+			previous = args[i-1]
 		}
-	}
-	if showUniqueToSet1 {
-		for _, file := range result.UniqueToSet1 {
-			uniqueSet1Size += file.Size
+		switch {
+		case previous == "--title":
+			anonymized[i] = a.Label("title", arg)
+		case previous == "--label1" || previous == "--label2":
+			anonymized[i] = a.Label("label", arg)
+		case i < 2 && !strings.HasPrefix(arg, "--"):
+			anonymized[i] = strings.Join(a.Paths(strings.Split(arg, ",")), ",")
+		case strings.ContainsAny(arg, "/"+string(filepath.Separator)):
+			anonymized[i] = a.FilePath(arg)
+		default:
+			anonymized[i] = arg
 		}
 	}
+	return anonymized
+}
+
+// FileSet rewrites the names and paths of a scanned set in place. Absolute paths are kept so features that
+// read the files again still work; they aren't part of the printed report.
+func (a *Anonymizer) FileSet(fileSet *FileSet) {
+	fileSet.NameMap = make(map[string][]*FileInfo, len(fileSet.NameMap))
+	for _, file := range fileSet.Files {
+		file.RelativePath = a.FilePath(file.RelativePath)
+		file.Name = filepath.Base(file.RelativePath)
+		file.RootDir = a.Path(file.RootDir)
+		fileSet.NameMap[file.Name] = append(fileSet.NameMap[file.Name], file)
+	}
+	fileSet.Roots = a.Paths(fileSet.Roots)
+	fileSet.MissingRoots = a.Paths(fileSet.MissingRoots)
+}
 
-	if (showModified && sameNameSize > 0) || (showUniqueToSet2 && uniqueSet2Size > 0) || (showUniqueToSet1 && uniqueSet1Size > 0) {
-		fmt.Println("   • Total sizes:")
-		if showModified && sameNameSize > 0 {
-			fmt.Printf("     - Same name, different content: %s\n", formatSize(sameNameSize))
+// WriteMap writes "<placeholder>\t<original>" lines, sorted by placeholder, for --anonymize-map
+func (a *Anonymizer) WriteMap(path string) error {
+	lines := make([]string, 0, len(a.originals))
+	for placeholder, original := range a.originals {
+		lines = append(lines, placeholder+"\t"+original)
+	}
+	sort.Strings(lines)
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// ExecOptions controls --exec, which runs a command for every differing file
+type ExecOptions struct {
+	Command         string // Template with {path}, {relpath}, {hash} and {size} placeholders
+	Parallel        int    // Number of commands run at once; 1 or less runs them one after another
+	ContinueOnError bool   // Keep going after a command fails instead of stopping
+}
+
+// quoteForShell quotes a substituted value so file names can't break out of the command
+func quoteForShell(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return shellQuote(s)
+}
+
+// expandExecCommand fills in a command template for one file
+func expandExecCommand(template string, file *FileInfo) string {
+	return strings.NewReplacer(
+		"{path}", quoteForShell(file.AbsolutePath),
+		"{relpath}", quoteForShell(file.RelativePath),
+		"{hash}", file.Hash,
+		"{size}", strconv.FormatInt(file.Size, 10),
+	).Replace(template)
+}
+
+// runShellCommand runs a command line through the platform shell, so redirection and pipes work
+var runShellCommand = func(command string) error {
+	// #nosec G204 - running the user's own command is the point of --exec
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		// #nosec G204 - running the user's own command is the point of --exec
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// runExecOnFiles runs the --exec command for each file and returns how many commands ran and the failures.
+// Unless ContinueOnError is set, no new command starts after one fails; with Parallel above 1, commands
+// already running when the failure happens still finish.
+func runExecOnFiles(files []*FileInfo, opts ExecOptions) (int, []string) {
+	var mu sync.Mutex
+	var failures []string
+	ran := 0
+	run := func(file *FileInfo) {
+		command := expandExecCommand(opts.Command, file)
+		err := runShellCommand(command)
+
+		mu.Lock()
+		defer mu.Unlock()
+		ran++
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", command, err))
 		}
-		if showUniqueToSet2 && uniqueSet2Size > 0 {
-			fmt.Printf("     - Unique to Set 2: %s\n", formatSize(uniqueSet2Size))
+	}
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failures) > 0 && !opts.ContinueOnError
+	}
+
+	if opts.Parallel <= 1 {
+		for _, file := range files {
+			if stopped() {
+				break
+			}
+			run(file)
 		}
-		if showUniqueToSet1 && uniqueSet1Size > 0 {
-			fmt.Printf("     - Unique to Set 1: %s\n", formatSize(uniqueSet1Size))
+		return ran, failures
+	}
+
+	jobs := make(chan *FileInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				run(file)
+			}
+		}()
+	}
+	for _, file := range files {
+		if stopped() {
+			break
 		}
+		jobs <- file
 	}
+	close(jobs)
+	wg.Wait()
+	return ran, failures
+}
 
-	// On Windows, wait for user input before closing
-	if runtime.GOOS == "windows" {
+// printExecResults reports how the --exec commands went
+func printExecResults(total, ran int, failures []string) {
+	if len(failures) == 0 {
+		fmt.Printf("   ✅ Command succeeded for all %d files\n", ran)
 		fmt.Println()
-		fmt.Print("Press Enter to exit...")
-		bufio.NewScanner(os.Stdin).Scan()
+		return
 	}
+	for _, failure := range failures {
+		fmt.Printf("   ❌ %s\n", failure)
+	}
+	if ran < total {
+		fmt.Printf("   ⏹️  Stopped after the first failure; %d of %d files not processed (use --exec-continue to keep going)\n", total-ran, total)
+	}
+	fmt.Println()
 }
 
-// formatSize formats file sizes in human-readable format
-func formatSize(size int64) string {
-	if size < 1024 {
-		return fmt.Sprintf("%d bytes", size)
-	} else if size < 1024*1024 {
-		return fmt.Sprintf("%.2f KB", float64(size)/1024.0)
-	} else if size < 1024*1024*1024 {
-		return fmt.Sprintf("%.2f MB", float64(size)/(1024.0*1024.0))
-	} else {
-		return fmt.Sprintf("%.2f GB", float64(size)/(1024.0*1024.0*1024.0))
-	}
+// memorySampleInterval is how often --report-memory samples the heap while the run is going
+const memorySampleInterval = 100 * time.Millisecond
+
+// MemoryReport is the memory usage of a run, as reported by --report-memory
+type MemoryReport struct {
+	PeakHeapAlloc uint64 // Largest live heap of any sample
+	TotalAlloc    uint64 // Bytes allocated over the whole run, including memory since freed
+	Sys           uint64 // Memory obtained from the OS, which bounds the process's peak footprint
+	NumGC         uint32
 }
 
-// runPreview runs the tool in preview mode with limited file processing
-func runPreview(set1Dirs, set2Dirs []string, previewCount int, showDetails, showModified, showUniqueToSet1, showUniqueToSet2 bool) {
-	fmt.Println("⚡ Directory Comparison Tool - PREVIEW MODE")
-	fmt.Println("=" + strings.Repeat("=", 45))
-	fmt.Printf("📋 Processing first %d files as sample\n", previewCount)
-	fmt.Println()
+// MemoryMonitor samples runtime.MemStats in the background, since the runtime only reports the current
+// heap size and not its peak
+type MemoryMonitor struct {
+	peakHeapAlloc uint64
+	stop          chan struct{}
+	done          chan struct{}
+}
 
-	fmt.Printf("📂 Set 1 directories: %s\n", strings.Join(set1Dirs, ", "))
-	fmt.Printf("📂 Set 2 directories: %s\n", strings.Join(set2Dirs, ", "))
-	fmt.Println()
+// startMemoryMonitor takes a first sample and keeps sampling every interval until Stop is called
+func startMemoryMonitor(interval time.Duration) *MemoryMonitor {
+	m := &MemoryMonitor{stop: make(chan struct{}), done: make(chan struct{})}
+	m.sample()
 
-	fmt.Println("🔍 Analyzing first files in set 1...")
-	set1, err := walkDirectoriesWithLimit(set1Dirs, previewCount)
-	if err != nil {
-		fmt.Printf("❌ Error analyzing first set: %v\n", err)
-		os.Exit(1)
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sample()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// sample reads the memory statistics and raises the peak if the heap has grown, returning the statistics
+func (m *MemoryMonitor) sample() runtime.MemStats {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > m.peakHeapAlloc {
+		m.peakHeapAlloc = stats.HeapAlloc
 	}
-	fmt.Printf("   Processed %d files\n", len(set1.Files))
+	return stats
+}
 
-	fmt.Println("🔍 Analyzing first files in set 2...")
-	set2, err := walkDirectoriesWithLimit(set2Dirs, previewCount)
-	if err != nil {
-		fmt.Printf("❌ Error analyzing second set: %v\n", err)
-		os.Exit(1)
+// Stop ends sampling and returns the report, including a final sample
+func (m *MemoryMonitor) Stop() MemoryReport {
+	close(m.stop)
+	<-m.done
+
+	stats := m.sample()
+	return MemoryReport{
+		PeakHeapAlloc: m.peakHeapAlloc,
+		TotalAlloc:    stats.TotalAlloc,
+		Sys:           stats.Sys,
+		NumGC:         stats.NumGC,
 	}
-	fmt.Printf("   Processed %d files\n", len(set2.Files))
+}
 
-	fmt.Println("🔍 Comparing file sets...")
-	result := compareFileSets(set1, set2)
+// printMemoryReport prints the --report-memory statistics
+func printMemoryReport(report MemoryReport) {
+	fmt.Println()
+	fmt.Println("🧠 Memory:")
+	fmt.Printf("   • Peak heap in use: %s (sampled every %v)\n", formatSize(int64(report.PeakHeapAlloc)), memorySampleInterval)
+	fmt.Printf("   • Total allocated: %s\n", formatSize(int64(report.TotalAlloc)))
+	fmt.Printf("   • Obtained from the OS: %s\n", formatSize(int64(report.Sys)))
+	fmt.Printf("   • Garbage collections: %d\n", report.NumGC)
+}
 
+// printPartialResultsNotice warns that the scan stopped early, so everything that follows covers only the
+// files hashed before it stopped
+func printPartialResultsNotice(reason string) {
 	fmt.Println()
-	fmt.Println("━━━ PREVIEW RESULTS ━━━")
+	fmt.Printf("⚠️  PARTIAL RESULTS: the scan stopped because %s\n", reason)
+	fmt.Println("   Only files hashed before then are compared. Files the scan didn't reach may show up as unique")
+	fmt.Println("   to the other set, and differences among them aren't listed. Use --checkpoint to resume later.")
+}
 
-	// Show results for enabled categories
-	if showModified {
-		if len(result.SameNameDifferentHash) > 0 {
-			fmt.Printf("⚠️  Modified files found (%d in sample):\n", len(result.SameNameDifferentHash))
-			fmt.Println("─" + strings.Repeat("─", 30))
-			tree1 := buildTree(result.SameNameDifferentHash)
-			printTree(tree1, "", true, showDetails, result.NameMappings)
-			fmt.Println()
-		} else {
-			fmt.Println("✅ No modified files found in this sample.")
-			fmt.Println()
+// preflightCountLimit caps how many files and directories --preflight visits under a root before calling it large
+const preflightCountLimit = 10000
+
+// RootStatus is what --preflight found out about one root directory
+type RootStatus struct {
+	Set     int // 0 or 1, as for setLabel
+	Root    string
+	Remote  bool   // Remote roots aren't checked
+	Problem string // Why the root is missing or unreadable, "" when it is fine
+	Files   int    // Files counted, at most preflightCountLimit
+	Large   bool   // Counting stopped after preflightCountLimit files and directories
+}
+
+// preflightRoots checks every root of both sets, resolving relative ones against baseDir like the scan will
+func preflightRoots(set1Dirs, set2Dirs []string, baseDir string) []RootStatus {
+	var statuses []RootStatus
+	for set, dirs := range [][]string{set1Dirs, set2Dirs} {
+		for _, root := range dirs {
+			status := RootStatus{Set: set, Root: root}
+			if isRemoteRoot(root) {
+				status.Remote = true
+			} else {
+				status.Root = resolveAgainstBase([]string{root}, baseDir)[0]
+				status.Files, status.Large, status.Problem = checkRoot(status.Root, preflightCountLimit)
+			}
+			statuses = append(statuses, status)
 		}
 	}
+	return statuses
+}
 
-	if showUniqueToSet2 {
-		if len(result.UniqueToSet2) > 0 {
-			fmt.Printf("📋 Files unique to Set 2 (%d in sample):\n", len(result.UniqueToSet2))
-			fmt.Println("─" + strings.Repeat("─", 30))
-			tree2 := buildTree(result.UniqueToSet2)
-			printTree(tree2, "", true, showDetails, nil)
-			fmt.Println()
-		} else {
-			fmt.Println("✅ No files unique to Set 2 found in this sample.")
-			fmt.Println()
+// checkRoot reports whether a root exists and can be read, and counts the files under it with shallow
+// os.ReadDir calls, giving up once limit files and directories have been seen, so a tree of mostly
+// directories can't queue up without bound. Unreadable subdirectories are left for the scan to warn about.
+func checkRoot(root string, limit int) (files int, large bool, problem string) {
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return 0, false, "missing"
+	}
+	if err != nil {
+		return 0, false, pathErrorReason(err)
+	}
+	if !info.IsDir() {
+		// A single file is a valid root; make sure it can be opened
+		// #nosec G304 - the root is intentionally user-provided
+		file, err := os.Open(root)
+		if err != nil {
+			return 0, false, "not readable: " + pathErrorReason(err)
 		}
+		file.Close()
+		return 1, false, ""
 	}
 
-	if showUniqueToSet1 {
-		if len(result.UniqueToSet1) > 0 {
-			fmt.Printf("📋 Files unique to Set 1 (%d in sample):\n", len(result.UniqueToSet1))
-			fmt.Println("─" + strings.Repeat("─", 30))
-			tree3 := buildTree(result.UniqueToSet1)
-			printTree(tree3, "", true, showDetails, nil)
-			fmt.Println()
-		} else {
-			fmt.Println("✅ No files unique to Set 1 found in this sample.")
-			fmt.Println()
+	pending := []string{root}
+	dirs := 0
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if dir == root {
+				return 0, false, "not readable: " + pathErrorReason(err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				pending = append(pending, filepath.Join(dir, entry.Name()))
+				dirs++
+			} else {
+				files++
+			}
+			if files+dirs >= limit {
+				return files, true, ""
+			}
 		}
 	}
+	return files, false, ""
+}
 
-	// Summary and next steps
-	fmt.Println("📊 Preview Summary:")
-	fmt.Printf("   • Sample size: %d files from each directory set\n", previewCount)
-	fmt.Printf("   • Files processed from Set 1: %d\n", len(set1.Files))
-	fmt.Printf("   • Files processed from Set 2: %d\n", len(set2.Files))
-	if showModified {
-		fmt.Printf("   • Modified files in sample: %d\n", len(result.SameNameDifferentHash))
+// pathErrorReason returns the reason of an error without the path a *fs.PathError carries (e.g. "permission
+// denied"), so --preflight can print it next to an anonymized root
+func pathErrorReason(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
 	}
-	if showUniqueToSet2 {
-		fmt.Printf("   • Unique to Set 2 in sample: %d\n", len(result.UniqueToSet2))
+	return err.Error()
+}
+
+// printPreflight prints the --preflight table and returns false if any root is missing or unreadable
+func printPreflight(statuses []RootStatus, anonymizer *Anonymizer) bool {
+	fmt.Printf("🛫 Preflight check (%d directories):\n", len(statuses))
+	fmt.Println("=" + strings.Repeat("=", 50))
+	fmt.Println()
+
+	labelWidth, rootWidth := 0, 0
+	for _, status := range statuses {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(setLabel(status.Set)))
+		rootWidth = max(rootWidth, utf8.RuneCountInString(anonymizer.Path(status.Root)))
 	}
-	if showUniqueToSet1 {
-		fmt.Printf("   • Unique to Set 1 in sample: %d\n", len(result.UniqueToSet1))
+
+	problems := 0
+	for _, status := range statuses {
+		icon, description := "✅", fmt.Sprintf("readable, %d files", status.Files)
+		switch {
+		case status.Remote:
+			icon, description = "🌐", "remote, not checked"
+		case status.Problem != "":
+			icon, description = "❌", status.Problem
+			problems++
+		case status.Large:
+			description = fmt.Sprintf("readable, large (%d+ files and directories)", preflightCountLimit)
+		}
+		fmt.Printf("   %s %-*s  %-*s  %s\n", icon, labelWidth, setLabel(status.Set), rootWidth, anonymizer.Path(status.Root), description)
 	}
 	fmt.Println()
-	fmt.Println("💡 To see complete results, run the same command without --preview")
+
+	if problems > 0 {
+		fmt.Printf("❌ Preflight failed: %d of %d directories are missing or unreadable. Nothing was scanned.\n", problems, len(statuses))
+		return false
+	}
+	return true
 }
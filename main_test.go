@@ -3,10 +3,16 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -2838,6 +2844,50 @@ func TestWalkDirectoriesWithLimit(t *testing.T) {
 			t.Errorf("Expected 2 files (all available), got %d", len(fileSet.Files))
 		}
 	})
+
+	t.Run("stable sample", func(t *testing.T) {
+		structure := map[string]string{}
+		for i := 0; i < 40; i++ {
+			structure[fmt.Sprintf("dir%d/file%d.txt", i%4, i)] = fmt.Sprintf("content%d", i)
+		}
+		// The second tree holds the same paths plus extra files the walk reaches first
+		structure2 := map[string]string{"aaa/first.txt": "first", "aaa/second.txt": "second"}
+		for path, content := range structure {
+			structure2[path] = content
+		}
+
+		sampledPaths := func(dir string) []string {
+			fileSet, err := walkDirectoriesWithOptions([]string{dir}, 5, ScanOptions{StableSample: true})
+			if err != nil {
+				t.Fatalf("walkDirectoriesWithOptions() error = %v", err)
+			}
+			var paths []string
+			for _, file := range fileSet.Files {
+				paths = append(paths, filepath.ToSlash(file.RelativePath))
+			}
+			sort.Strings(paths)
+			return paths
+		}
+
+		first := sampledPaths(createTempDir(t, structure))
+		if len(first) != 5 {
+			t.Fatalf("Expected 5 sampled files, got %v", first)
+		}
+		if again := sampledPaths(createTempDir(t, structure)); strings.Join(first, ",") != strings.Join(again, ",") {
+			t.Errorf("Expected the same sample from an identical tree, got %v and %v", first, again)
+		}
+
+		// Each path's rank doesn't depend on the other files, so the extras can only displace sampled paths
+		inFirst := make(map[string]bool)
+		for _, path := range first {
+			inFirst[path] = true
+		}
+		for _, path := range sampledPaths(createTempDir(t, structure2)) {
+			if !strings.HasPrefix(path, "aaa/") && !inFirst[path] {
+				t.Errorf("Sampled %s from the larger tree but not from the smaller one (%v)", path, first)
+			}
+		}
+	})
 }
 
 // Test cases for runPreview function
@@ -2860,7 +2910,7 @@ func TestRunPreview(t *testing.T) {
 
 		// Capture output from runPreview
 		output := captureOutput(t, func() {
-			runPreview([]string{set1Dir}, []string{set2Dir}, 5, true, true, true, true)
+			runPreview([]string{set1Dir}, []string{set2Dir}, 5, true, true, true, true, ScanOptions{}, CompareOptions{})
 		})
 
 		// Verify preview mode indicators
@@ -2904,7 +2954,7 @@ func TestRunPreview(t *testing.T) {
 
 		// Test with only showUniqueToSet2 enabled
 		output := captureOutput(t, func() {
-			runPreview([]string{set1Dir}, []string{set2Dir}, 3, false, false, false, true)
+			runPreview([]string{set1Dir}, []string{set2Dir}, 3, false, false, false, true, ScanOptions{}, CompareOptions{})
 		})
 
 		// Should show unique to set 2 but not other categories
@@ -2930,7 +2980,7 @@ func TestRunPreview(t *testing.T) {
 
 		// Test with custom preview count
 		output := captureOutput(t, func() {
-			runPreview([]string{set1Dir}, []string{set2Dir}, 1, false, false, false, false)
+			runPreview([]string{set1Dir}, []string{set2Dir}, 1, false, false, false, false, ScanOptions{}, CompareOptions{})
 		})
 
 		if !strings.Contains(output, "Processing first 1 files as sample") {
@@ -3174,7 +3224,7 @@ func TestHashWorker(t *testing.T) {
 		var wg sync.WaitGroup
 
 		wg.Add(1)
-		go hashWorker(jobs, results, progress, &wg)
+		go hashWorker(jobs, results, progress, &wg, ScanOptions{})
 
 		jobs <- FileJob{
 			Files: []FileTask{{
@@ -3238,7 +3288,7 @@ func TestHashWorker(t *testing.T) {
 		var wg sync.WaitGroup
 
 		wg.Add(1)
-		go hashWorker(jobs, results, progress, &wg)
+		go hashWorker(jobs, results, progress, &wg, ScanOptions{})
 
 		jobs <- FileJob{Files: tasks}
 		close(jobs)
@@ -3270,7 +3320,7 @@ func TestHashWorker(t *testing.T) {
 		var wg sync.WaitGroup
 
 		wg.Add(1)
-		go hashWorker(jobs, results, progress, &wg)
+		go hashWorker(jobs, results, progress, &wg, ScanOptions{})
 
 		jobs <- FileJob{
 			Files: []FileTask{{
@@ -3325,7 +3375,7 @@ func TestProcessFilesSequentially(t *testing.T) {
 		})
 	}
 
-	fileSet, err := processFilesSequentially(tasks, 1000)
+	fileSet, err := processFilesSequentially(tasks, 1000, ScanOptions{})
 	if err != nil {
 		t.Fatalf("processFilesSequentially failed: %v", err)
 	}
@@ -3385,7 +3435,7 @@ func TestProcessFilesInParallel(t *testing.T) {
 		})
 	}
 
-	fileSet, err := processFilesInParallel(tasks, 2500)
+	fileSet, err := processFilesInParallel(tasks, 2500, ScanOptions{})
 	if err != nil {
 		t.Fatalf("processFilesInParallel failed: %v", err)
 	}
@@ -3416,7 +3466,7 @@ func TestProcessFilesInParallel(t *testing.T) {
 // Test edge cases for parallel processing
 func TestProcessFilesInParallelEdgeCases(t *testing.T) {
 	t.Run("empty task list", func(t *testing.T) {
-		fileSet, err := processFilesInParallel([]FileTask{}, 0)
+		fileSet, err := processFilesInParallel([]FileTask{}, 0, ScanOptions{})
 		if err != nil {
 			t.Fatalf("processFilesInParallel failed: %v", err)
 		}
@@ -3447,7 +3497,7 @@ func TestProcessFilesInParallelEdgeCases(t *testing.T) {
 			RelPath: filename,
 		}}
 
-		fileSet, err := processFilesInParallel(tasks, info.Size())
+		fileSet, err := processFilesInParallel(tasks, info.Size(), ScanOptions{})
 		if err != nil {
 			t.Fatalf("processFilesInParallel failed: %v", err)
 		}
@@ -3717,7 +3767,7 @@ func TestHashWorkerWithProgress(t *testing.T) {
 		// Start worker
 		var wg sync.WaitGroup
 		wg.Add(1)
-		go hashWorker(jobs, results, progress, &wg)
+		go hashWorker(jobs, results, progress, &wg, ScanOptions{})
 
 		// Send job
 		jobs <- FileJob{Files: tasks}
@@ -3773,7 +3823,7 @@ func TestHashWorkerWithProgress(t *testing.T) {
 
 		var wg sync.WaitGroup
 		wg.Add(1)
-		go hashWorker(jobs, results, progress, &wg)
+		go hashWorker(jobs, results, progress, &wg, ScanOptions{})
 
 		jobs <- FileJob{Files: tasks}
 		close(jobs)
@@ -3838,7 +3888,7 @@ func TestProcessFilesInParallelWithProgress(t *testing.T) {
 		}
 
 		// Process files
-		fileSet, err := processFilesInParallel(tasks, totalSize)
+		fileSet, err := processFilesInParallel(tasks, totalSize, ScanOptions{})
 		if err != nil {
 			t.Fatalf("processFilesInParallel failed: %v", err)
 		}
@@ -3909,3 +3959,3435 @@ func TestWalkDirectoriesWithLimitProgress(t *testing.T) {
 		}
 	})
 }
+
+// Test cases for overlapping root detection
+func TestRemoveOverlappingRoots(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"sub/file.txt":   "nested",
+		"other/file.txt": "other",
+	})
+	sub := filepath.Join(tmpDir, "sub")
+	other := filepath.Join(tmpDir, "other")
+
+	tests := []struct {
+		name     string
+		dirs     []string
+		expected []string
+	}{
+		{
+			name:     "disjoint roots are kept",
+			dirs:     []string{sub, other},
+			expected: []string{sub, other},
+		},
+		{
+			name:     "nested root after parent is skipped",
+			dirs:     []string{tmpDir, sub},
+			expected: []string{tmpDir},
+		},
+		{
+			name:     "nested root before parent is skipped",
+			dirs:     []string{sub, tmpDir},
+			expected: []string{tmpDir},
+		},
+		{
+			name:     "duplicate root keeps first occurrence",
+			dirs:     []string{sub, sub + string(filepath.Separator)},
+			expected: []string{sub},
+		},
+		{
+			name:     "sibling with shared prefix is not nested",
+			dirs:     []string{sub, sub + "2"},
+			expected: []string{sub, sub + "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, warnings := removeOverlappingRoots(tt.dirs)
+
+			if len(warnings) != len(tt.dirs)-len(tt.expected) {
+				t.Errorf("Expected one warning per skipped root, got %v", warnings)
+			}
+			if len(kept) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, kept)
+			}
+			for i := range kept {
+				if kept[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, kept)
+				}
+			}
+		})
+	}
+}
+
+func TestWalkDirectoriesOverlappingRoots(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"top.txt":      "top",
+		"sub/a.txt":    "a",
+		"sub/b/c.txt":  "c",
+		"sibling.txt":  "sibling",
+		"sub/d/e.txt":  "e",
+		"sub/d/f.txt":  "f",
+		"sub/d/g.txt":  "g",
+		"sub/d/h.txt":  "h",
+		"sub/d/i.txt":  "i",
+		"sub/d/j.txt":  "j",
+		"sub/d/k.txt":  "k",
+		"sub/d/l.txt":  "l",
+		"sub/d/m.txt":  "m",
+		"sub/d/n.txt":  "n",
+		"sub/d/o.txt":  "o",
+		"sub/d/p.txt":  "p",
+		"sub/d/q.txt":  "q",
+		"sub/d/r.txt":  "r",
+		"sub/d/s.txt":  "s",
+		"sub/d/t.txt":  "t",
+		"sub/d/u.txt":  "u",
+		"sub/d/v.txt":  "v",
+		"sub/d/w.txt":  "w",
+		"sub/d/xy.txt": "xy",
+	})
+
+	var fileSet *FileSet
+	var err error
+	output := captureOutput(t, func() {
+		fileSet, err = walkDirectories([]string{tmpDir, filepath.Join(tmpDir, "sub")})
+	})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	if len(fileSet.Files) != 24 {
+		t.Errorf("Expected each file to be counted once (24), got %d", len(fileSet.Files))
+	}
+	if !strings.Contains(output, "skipping to avoid counting files twice") {
+		t.Errorf("Expected a warning about the nested root, got: %s", output)
+	}
+}
+
+// Test cases for run metadata header
+func TestCollectRunMetadata(t *testing.T) {
+	args := []string{"set1", "set2", "--title", "Nightly"}
+	meta := collectRunMetadata("Nightly", args, []string{"set1"}, []string{"set2"})
+
+	if meta.Title != "Nightly" {
+		t.Errorf("Expected title 'Nightly', got %q", meta.Title)
+	}
+	if meta.Version != version {
+		t.Errorf("Expected version %q, got %q", version, meta.Version)
+	}
+	if meta.Hostname == "" {
+		t.Error("Hostname should not be empty")
+	}
+	if meta.Timestamp.IsZero() {
+		t.Error("Timestamp should be set")
+	}
+	if len(meta.Arguments) != len(args) {
+		t.Errorf("Expected %d arguments, got %d", len(args), len(meta.Arguments))
+	}
+}
+
+func TestPrintRunMetadata(t *testing.T) {
+	t.Run("with title", func(t *testing.T) {
+		meta := collectRunMetadata("Nightly backup check", []string{"a", "b"}, []string{"a"}, []string{"b"})
+		output := captureOutput(t, func() {
+			printRunMetadata(meta)
+		})
+
+		expected := []string{
+			"📝 Nightly backup check",
+			"🕒 Generated:",
+			"💻 Host: " + meta.Hostname,
+			"Version: " + version,
+			"Arguments: a b",
+			"📂 Set 1 directories: a",
+			"📂 Set 2 directories: b",
+		}
+		for _, want := range expected {
+			if !strings.Contains(output, want) {
+				t.Errorf("Output should contain %q, got: %s", want, output)
+			}
+		}
+	})
+
+	t.Run("without title or arguments", func(t *testing.T) {
+		meta := collectRunMetadata("", nil, []string{"a"}, []string{"b"})
+		output := captureOutput(t, func() {
+			printRunMetadata(meta)
+		})
+
+		if strings.Contains(output, "📝") {
+			t.Error("Title line should be omitted when no title is given")
+		}
+		if strings.Contains(output, "Arguments:") {
+			t.Error("Arguments line should be omitted when there are no arguments")
+		}
+	})
+}
+
+// Test cases for --filter expression parsing and matching
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "size comparison", expr: "size>100MB"},
+		{name: "age comparison", expr: "age<7d"},
+		{name: "or expression", expr: "size>100MB || age<7d"},
+		{name: "and with parentheses", expr: "(ext==jpg || ext==.png) && size>=1KB"},
+		{name: "quoted name pattern", expr: "name=='report *.txt'"},
+		{name: "single equals", expr: "ext=txt"},
+		{name: "empty expression", expr: "", wantErr: true},
+		{name: "unknown field", expr: "owner==root", wantErr: true},
+		{name: "invalid size", expr: "size>lots", wantErr: true},
+		{name: "invalid age unit", expr: "age<7y", wantErr: true},
+		{name: "ordered ext comparison", expr: "ext>txt", wantErr: true},
+		{name: "missing operand", expr: "size>", wantErr: true},
+		{name: "missing parenthesis", expr: "(size>1KB", wantErr: true},
+		{name: "dangling operator", expr: "size>1KB ||", wantErr: true},
+		{name: "unterminated quote", expr: "name=='abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parseFilter(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFilter(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if !tt.wantErr && node == nil {
+				t.Errorf("parseFilter(%q) returned nil node", tt.expr)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Now()
+	// fakeFileInfo reports the current time as its modification time, so shifting
+	// "now" forward ages the file
+	tenDaysLater := now.Add(10 * 24 * time.Hour)
+
+	big := &fakeFileInfo{name: "movie.MKV", size: 200 * 1024 * 1024}
+	small := &fakeFileInfo{name: "notes.txt", size: 512}
+
+	tests := []struct {
+		name string
+		expr string
+		info os.FileInfo
+		now  time.Time
+		want bool
+	}{
+		{name: "large file passes size filter", expr: "size>100MB", info: big, now: now, want: true},
+		{name: "small file fails size filter", expr: "size>100MB", info: small, now: now, want: false},
+		{name: "recent small file passes or", expr: "size>100MB || age<7d", info: small, now: now, want: true},
+		{name: "old small file fails or", expr: "size>100MB || age<7d", info: small, now: tenDaysLater, want: false},
+		{name: "and requires both", expr: "ext==txt && size<1KB", info: small, now: now, want: true},
+		{name: "and fails on one side", expr: "ext==txt && size>1KB", info: small, now: now, want: false},
+		{name: "ext is case insensitive", expr: "ext==.mkv", info: big, now: now, want: true},
+		{name: "ext not equal", expr: "ext!=mkv", info: big, now: now, want: false},
+		{name: "name glob", expr: "name==notes.*", info: small, now: now, want: true},
+		{name: "name glob negated", expr: "name!=notes.*", info: small, now: now, want: false},
+		{name: "and binds tighter than or", expr: "ext==mkv || ext==txt && size>1KB", info: big, now: now, want: true},
+		{name: "parentheses override precedence", expr: "(ext==mkv || ext==txt) && size<1KB", info: big, now: now, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("parseFilter(%q) failed: %v", tt.expr, err)
+			}
+			if got := node.Match(tt.info, tt.now); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkDirectoriesWithFilter(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"keep.txt":     "kept content",
+		"skip.log":     "skipped content",
+		"sub/also.txt": "also kept",
+	})
+
+	filter, err := parseFilter("ext==txt")
+	if err != nil {
+		t.Fatalf("parseFilter failed: %v", err)
+	}
+
+	fileSet, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{Filter: filter})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+
+	if len(fileSet.Files) != 2 {
+		t.Errorf("Expected 2 files to pass the filter, got %d", len(fileSet.Files))
+	}
+	if _, exists := fileSet.NameMap["skip.log"]; exists {
+		t.Error("Filtered file should not be in the FileSet")
+	}
+}
+
+// Test cases for interactive review of modified files
+func TestParseReviewChoice(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantAction string
+		wantQuit   bool
+		wantOK     bool
+	}{
+		{"1", ReviewKeepSet1, false, true},
+		{"2", ReviewKeepSet2, false, true},
+		{"s", ReviewSkip, false, true},
+		{"SKIP", ReviewSkip, false, true},
+		{"", ReviewSkip, false, true},
+		{"q", "", true, true},
+		{"3", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			action, quit, ok := parseReviewChoice(tt.input)
+			if action != tt.wantAction || quit != tt.wantQuit || ok != tt.wantOK {
+				t.Errorf("parseReviewChoice(%q) = (%q, %v, %v), want (%q, %v, %v)",
+					tt.input, action, quit, ok, tt.wantAction, tt.wantQuit, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRunInteractiveReview(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{"docs/report.txt": "original"})
+	set2Dir := createTempDir(t, map[string]string{"docs/report.txt": "changed content"})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	result := compareFileSets(set1, set2)
+
+	tests := []struct {
+		name          string
+		input         string
+		wantDecisions int
+		wantAction    string
+	}{
+		{name: "keep set 2", input: "2", wantDecisions: 1, wantAction: ReviewKeepSet2},
+		{name: "quit immediately", input: "q", wantDecisions: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldStdin := os.Stdin
+			r, w, _ := os.Pipe()
+			os.Stdin = r
+			defer func() {
+				os.Stdin = oldStdin
+				r.Close()
+			}()
+
+			go func() {
+				defer w.Close()
+				_, _ = w.Write([]byte(tt.input + "\n")) // Ignore error for test input
+			}()
+
+			var decisions []ReviewDecision
+			output := captureOutput(t, func() {
+				decisions = runInteractiveReview(result)
+			})
+
+			if !strings.Contains(output, filepath.Join("docs", "report.txt")) {
+				t.Errorf("Review should show the file path, got: %s", output)
+			}
+			if len(decisions) != tt.wantDecisions {
+				t.Fatalf("Expected %d decisions, got %d", tt.wantDecisions, len(decisions))
+			}
+			if tt.wantDecisions > 0 {
+				if decisions[0].Action != tt.wantAction {
+					t.Errorf("Expected action %s, got %s", tt.wantAction, decisions[0].Action)
+				}
+				if decisions[0].Set1File == nil || decisions[0].Set2File == nil {
+					t.Error("Decision should reference both versions of the file")
+				}
+			}
+		})
+	}
+}
+
+func TestWriteReviewDecisions(t *testing.T) {
+	decisions := []ReviewDecision{
+		{
+			Action:   ReviewKeepSet1,
+			Set1File: &FileInfo{AbsolutePath: "/set1/a.txt"},
+			Set2File: &FileInfo{AbsolutePath: "/set2/a.txt"},
+		},
+		{
+			Action:   ReviewSkip,
+			Set2File: &FileInfo{AbsolutePath: "/set2/b.txt"},
+		},
+	}
+
+	outPath := filepath.Join(t.TempDir(), "decisions.tsv")
+	if err := writeReviewDecisions(outPath, decisions); err != nil {
+		t.Fatalf("writeReviewDecisions failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read decisions file: %v", err)
+	}
+
+	for _, want := range []string{"keep-set1\t/set1/a.txt\t/set2/a.txt", "skip\t-\t/set2/b.txt"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Decisions file should contain %q, got: %s", want, content)
+		}
+	}
+}
+
+// Test cases for directory content equivalence
+func TestComputeSubtreeDigests(t *testing.T) {
+	tmpDir1 := createTempDir(t, map[string]string{
+		"photos/a.jpg":     "image a",
+		"photos/sub/b.jpg": "image b",
+	})
+	tmpDir2 := createTempDir(t, map[string]string{
+		"flat/b.jpg":   "image b",
+		"flat/a.jpg":   "image a",
+		"other/c.jpg":  "image c",
+		"other/d.jpeg": "image a",
+	})
+
+	set1, err := walkDirectories([]string{tmpDir1})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{tmpDir2})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	digests1 := computeSubtreeDigests(set1)
+	digests2 := computeSubtreeDigests(set2)
+
+	if digests1["photos"].FileCount != 2 {
+		t.Errorf("Expected photos subtree to contain 2 files, got %d", digests1["photos"].FileCount)
+	}
+	if digests1["."].FileCount != 2 {
+		t.Errorf("Expected root subtree to contain 2 files, got %d", digests1["."].FileCount)
+	}
+	if digests1["photos"].Digest != digests2["flat"].Digest {
+		t.Error("Directories with the same files in a different layout should share a digest")
+	}
+	if digests1["photos"].Digest == digests2["other"].Digest {
+		t.Error("Directories with different files should not share a digest")
+	}
+}
+
+func TestFindEquivalentDirectories(t *testing.T) {
+	tmpDir1 := createTempDir(t, map[string]string{
+		"2023/photos/a.jpg":      "image a",
+		"2023/photos/trip/b.jpg": "image b",
+		"docs/readme.txt":        "readme",
+	})
+	tmpDir2 := createTempDir(t, map[string]string{
+		"archive/2023/a.jpg":      "image a",
+		"archive/2023/trip/b.jpg": "image b",
+		"archive/index.txt":       "index",
+		"docs/readme.txt":         "changed readme",
+	})
+
+	set1, err := walkDirectories([]string{tmpDir1})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{tmpDir2})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	equivalences := findEquivalentDirectories(set1, set2)
+
+	// 2023 and 2023/photos both hold {a, b}, but only the topmost pairs are reported
+	expected := map[string]string{
+		"2023": filepath.Join("archive", "2023"),
+	}
+	found := make(map[string]string)
+	for _, equivalence := range equivalences {
+		found[equivalence.Set1Dir] = equivalence.Set2Dir
+	}
+
+	for dir1, dir2 := range expected {
+		if found[dir1] != dir2 {
+			t.Errorf("Expected %s to be equivalent to %s, got %v", dir1, dir2, equivalences)
+		}
+	}
+	if _, exists := found["docs"]; exists {
+		t.Error("Directories with different content should not be equivalent")
+	}
+	for _, equivalence := range equivalences {
+		if equivalence.Set1Dir == filepath.Join("2023", "photos") && equivalence.Set2Dir == filepath.Join("archive", "2023") {
+			t.Error("Nested pair should not be reported once its parent pair is reported")
+		}
+	}
+
+	output := captureOutput(t, func() {
+		printDirectoryEquivalences(equivalences)
+	})
+	if !strings.Contains(output, "Content-equivalent directories") {
+		t.Errorf("Output should contain the equivalence header, got: %s", output)
+	}
+
+	output = captureOutput(t, func() {
+		printDirectoryEquivalences(nil)
+	})
+	if !strings.Contains(output, "No content-equivalent directories") {
+		t.Errorf("Output should report no equivalences, got: %s", output)
+	}
+}
+
+// Test cases for warning suppression and collection
+func TestScanWarnings(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{"file.txt": "content"})
+	missing := filepath.Join(t.TempDir(), "does-not-exist")
+
+	t.Run("warnings printed inline by default", func(t *testing.T) {
+		var fileSet *FileSet
+		output := captureOutput(t, func() {
+			var err error
+			fileSet, err = walkDirectoriesWithOptions([]string{tmpDir, missing}, -1, ScanOptions{})
+			if err != nil {
+				t.Errorf("walkDirectoriesWithOptions failed: %v", err)
+			}
+		})
+
+		if !strings.Contains(output, "Warning: Directory "+missing+" does not exist") {
+			t.Errorf("Expected inline warning, got: %s", output)
+		}
+		if len(fileSet.Warnings) != 1 {
+			t.Errorf("Expected 1 recorded warning, got %v", fileSet.Warnings)
+		}
+	})
+
+	t.Run("warnings suppressed but recorded", func(t *testing.T) {
+		var fileSet *FileSet
+		output := captureOutput(t, func() {
+			var err error
+			fileSet, err = walkDirectoriesWithOptions([]string{tmpDir, missing}, -1, ScanOptions{QuietWarnings: true})
+			if err != nil {
+				t.Errorf("walkDirectoriesWithOptions failed: %v", err)
+			}
+		})
+
+		if strings.Contains(output, "Warning:") {
+			t.Errorf("Expected no inline warnings, got: %s", output)
+		}
+		if len(fileSet.Warnings) != 1 || !strings.Contains(fileSet.Warnings[0].Message, "does not exist") {
+			t.Errorf("Expected the missing directory warning to be recorded, got %v", fileSet.Warnings)
+		}
+		if len(fileSet.Files) != 1 {
+			t.Errorf("Expected 1 file from the existing directory, got %d", len(fileSet.Files))
+		}
+	})
+
+	t.Run("hash failures recorded", func(t *testing.T) {
+		info, err := os.Stat(filepath.Join(tmpDir, "file.txt"))
+		if err != nil {
+			t.Fatalf("Failed to stat test file: %v", err)
+		}
+		tasks := []FileTask{{Path: filepath.Join(tmpDir, "gone.txt"), Info: info, RootDir: tmpDir, RelPath: "gone.txt"}}
+
+		fileSet, err := processFilesSequentially(tasks, info.Size(), ScanOptions{QuietWarnings: true})
+		if err != nil {
+			t.Fatalf("processFilesSequentially failed: %v", err)
+		}
+		if len(fileSet.Warnings) != 1 || !strings.Contains(fileSet.Warnings[0].Message, "Could not hash file") {
+			t.Errorf("Expected a hash failure warning, got %v", fileSet.Warnings)
+		}
+		if fileSet.Warnings[0].Reason != WarningReadError || fileSet.Warnings[0].Path != tasks[0].Path {
+			t.Errorf("Expected a read error for %s, got %+v", tasks[0].Path, fileSet.Warnings[0])
+		}
+	})
+
+	t.Run("warnings handed to OnWarning", func(t *testing.T) {
+		var received []ScanWarning
+		opts := ScanOptions{OnWarning: func(w ScanWarning) { received = append(received, w) }}
+		var fileSet *FileSet
+		output := captureOutput(t, func() {
+			var err error
+			fileSet, err = walkDirectoriesWithOptions([]string{tmpDir, missing, filepath.Join(tmpDir, ".")}, -1, opts)
+			if err != nil {
+				t.Errorf("walkDirectoriesWithOptions failed: %v", err)
+			}
+		})
+
+		if strings.Contains(output, "Warning:") {
+			t.Errorf("Expected warnings to go to the handler instead of being printed, got: %s", output)
+		}
+		if len(received) != 2 || len(fileSet.Warnings) != 2 {
+			t.Fatalf("Expected 2 warnings both handed over and recorded, got %v and %v", received, fileSet.Warnings)
+		}
+		reasons := map[WarningReason]bool{}
+		for _, w := range received {
+			reasons[w.Reason] = true
+		}
+		if !reasons[WarningMissingRoot] || !reasons[WarningSkippedRoot] {
+			t.Errorf("Expected a missing root and a skipped root, got %v", received)
+		}
+	})
+}
+
+func TestReadWarningReason(t *testing.T) {
+	if got := readWarning("a.txt", fs.ErrPermission, "denied").Reason; got != WarningPermissionDenied {
+		t.Errorf("Expected %s for a permission error, got %s", WarningPermissionDenied, got)
+	}
+	wrapped := &hashFailure{path: "a.txt", err: &fs.PathError{Op: "open", Path: "a.txt", Err: fs.ErrPermission}}
+	if got := readWarning("a.txt", wrapped, wrapped.Error()).Reason; got != WarningPermissionDenied {
+		t.Errorf("Expected %s for a wrapped permission error, got %s", WarningPermissionDenied, got)
+	}
+	if got := readWarning("a.txt", io.ErrUnexpectedEOF, "short read").Reason; got != WarningReadError {
+		t.Errorf("Expected %s for other errors, got %s", WarningReadError, got)
+	}
+}
+
+func TestPrintSuppressedWarnings(t *testing.T) {
+	warnings := []ScanWarning{
+		{Reason: WarningPermissionDenied, Path: "a.txt", Message: "Could not hash file a.txt: permission denied"},
+		{Reason: WarningPermissionDenied, Path: "b.txt", Message: "Could not hash file b.txt: permission denied"},
+	}
+
+	t.Run("count only", func(t *testing.T) {
+		output := captureOutput(t, func() {
+			printSuppressedWarnings(warnings, false)
+		})
+		if !strings.Contains(output, "2 files or directories skipped due to errors; use --verbose to list them") {
+			t.Errorf("Expected a warning count, got: %s", output)
+		}
+		if strings.Contains(output, "a.txt") {
+			t.Error("Individual warnings should not be listed without --verbose")
+		}
+	})
+
+	t.Run("verbose listing", func(t *testing.T) {
+		output := captureOutput(t, func() {
+			printSuppressedWarnings(warnings, true)
+		})
+		if !strings.Contains(output, "a.txt") || !strings.Contains(output, "b.txt") {
+			t.Errorf("Expected every warning to be listed, got: %s", output)
+		}
+	})
+
+	t.Run("other reasons counted separately", func(t *testing.T) {
+		mixed := append([]ScanWarning{
+			{Reason: WarningNotRegular, Path: "fifo", Message: "Skipping named pipe fifo"},
+			{Reason: WarningMissingRoot, Path: "/gone", Message: "Directory /gone does not exist"},
+		}, warnings...)
+		output := captureOutput(t, func() {
+			printSuppressedWarnings(mixed, false)
+		})
+		if !strings.Contains(output, "2 files or directories skipped due to errors, 1 special files (pipes, sockets, devices) skipped, 1 directories missing;") {
+			t.Errorf("Expected errors and other reasons counted apart, got: %s", output)
+		}
+
+		output = captureOutput(t, func() {
+			printSuppressedWarnings(mixed, true)
+		})
+		if !strings.Contains(output, "Skipped due to errors (2):") || !strings.Contains(output, "Special files skipped (1):") || !strings.Contains(output, "Missing directories (1):") {
+			t.Errorf("Expected a section per reason, got: %s", output)
+		}
+	})
+
+	t.Run("nothing to report", func(t *testing.T) {
+		output := captureOutput(t, func() {
+			printSuppressedWarnings(nil, true)
+		})
+		if output != "" {
+			t.Errorf("Expected no output without warnings, got: %s", output)
+		}
+	})
+}
+
+// Test cases for resolving set directories against --base
+func TestResolveAgainstBase(t *testing.T) {
+	absDir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		dirs     []string
+		base     string
+		expected []string
+	}{
+		{
+			name:     "no base leaves directories untouched",
+			dirs:     []string{"daily", absDir},
+			base:     "",
+			expected: []string{"daily", absDir},
+		},
+		{
+			name:     "relative directories joined onto base",
+			dirs:     []string{"daily", filepath.Join("weekly", "sub")},
+			base:     filepath.Join("mnt", "backups"),
+			expected: []string{filepath.Join("mnt", "backups", "daily"), filepath.Join("mnt", "backups", "weekly", "sub")},
+		},
+		{
+			name:     "absolute directories ignore base",
+			dirs:     []string{absDir},
+			base:     filepath.Join("mnt", "backups"),
+			expected: []string{absDir},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := resolveAgainstBase(tt.dirs, tt.base)
+			if len(resolved) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, resolved)
+			}
+			for i := range resolved {
+				if resolved[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, resolved)
+				}
+			}
+		})
+	}
+}
+
+func TestWalkDirectoriesWithBase(t *testing.T) {
+	baseDir := createTempDir(t, map[string]string{
+		"daily/a.txt":  "daily a",
+		"weekly/a.txt": "weekly a",
+		"weekly/b.txt": "weekly b",
+	})
+
+	fileSet, err := walkDirectoriesWithOptions([]string{"weekly"}, -1, ScanOptions{BaseDir: baseDir})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+
+	if len(fileSet.Files) != 2 {
+		t.Errorf("Expected 2 files from the weekly directory under the base, got %d", len(fileSet.Files))
+	}
+	for _, file := range fileSet.Files {
+		if file.RootDir != filepath.Join(baseDir, "weekly") {
+			t.Errorf("Expected root %s, got %s", filepath.Join(baseDir, "weekly"), file.RootDir)
+		}
+	}
+}
+
+// TestFindDirectoryMoves tests reporting whole directories that moved as one line each
+func TestFindDirectoryMoves(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"2023/photos/a.jpg":     "photo a",
+		"2023/photos/sub/b.jpg": "photo b",
+		"2023/notes.txt":        "notes",
+		"docs/keep.txt":         "stays put",
+		"music/x.mp3":           "song x",
+		"music/y.mp3":           "song y",
+		"archive/old.txt":       "already archived",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"archive/2023/photos/a.jpg":     "photo a",
+		"archive/2023/photos/sub/b.jpg": "photo b",
+		"archive/old.txt":               "already archived",
+		"2023/notes.txt":                "notes",
+		"docs/keep.txt":                 "stays put",
+		"audio/x.mp3":                   "song x",
+		"audio/y.mp3":                   "edited song y",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	// 2023 itself stayed (notes.txt), music lost an unchanged y.mp3, and photos/sub moved along with photos
+	moves := findDirectoryMoves(set1, set2)
+	want := DirectoryMove{
+		From:  filepath.Join("2023", "photos"),
+		To:    filepath.Join("archive", "2023", "photos"),
+		Files: 2,
+		Size:  int64(len("photo a") + len("photo b")),
+	}
+	if len(moves) != 1 || moves[0] != want {
+		t.Fatalf("Expected only %+v, got %+v", want, moves)
+	}
+
+	output := captureOutput(t, func() {
+		printDirectoryMoves(moves)
+	})
+	sep := string(filepath.Separator)
+	if !strings.Contains(output, want.From+sep+" → "+want.To+sep+" (2 files") {
+		t.Errorf("Expected an old/ → new/ line, got: %s", output)
+	}
+}
+
+// Test cases for timestamp-only change detection
+func TestTimestampOnlyChanged(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"touched.txt":   "same content",
+		"untouched.txt": "also same",
+		"edited.txt":    "before",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"touched.txt":      "same content",
+		"untouched.txt":    "also same",
+		"edited.txt":       "after",
+		"moved/copy.txt":   "also same",
+		"moved/touched.md": "same content",
+	})
+
+	// Align mod times, then touch a single file in set 2
+	base := time.Now().Add(-time.Hour)
+	for _, dir := range []string{set1Dir, set2Dir} {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			return os.Chtimes(path, base, base)
+		})
+		if err != nil {
+			t.Fatalf("Failed to set mod times: %v", err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(set2Dir, "touched.txt"), time.Now(), time.Now()); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	result := compareFileSets(set1, set2)
+
+	if len(result.TimestampOnlyChanged) != 1 || result.TimestampOnlyChanged[0].RelativePath != "touched.txt" {
+		t.Fatalf("Expected only touched.txt to be a timestamp-only change, got %v", result.TimestampOnlyChanged)
+	}
+	if len(result.SameNameDifferentHash) != 1 || result.SameNameDifferentHash[0].Name != "edited.txt" {
+		t.Errorf("Expected only edited.txt to be modified, got %v", result.SameNameDifferentHash)
+	}
+
+	output := captureOutput(t, func() {
+		printTimestampOnlyChanges(result.TimestampOnlyChanged)
+	})
+	if !strings.Contains(output, "touched.txt (timestamp changed, content same)") {
+		t.Errorf("Expected annotated file, got: %s", output)
+	}
+
+	output = captureOutput(t, func() {
+		printTimestampOnlyChanges(nil)
+	})
+	if !strings.Contains(output, "No files with only a timestamp change") {
+		t.Errorf("Expected empty message, got: %s", output)
+	}
+}
+
+// Test cases for diff-able snapshot output
+func TestWriteSnapshot(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"b.txt":     "bravo",
+		"a.txt":     "alpha",
+		"sub/c.txt": "charlie",
+	})
+
+	fileSet, err := walkDirectories([]string{tmpDir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "set.txt")
+	if err := writeSnapshot(outPath, fileSet); err != nil {
+		t.Fatalf("writeSnapshot failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	expectedPaths := []string{"a.txt", "b.txt", "sub/c.txt"}
+	if len(lines) != len(expectedPaths) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(expectedPaths), len(lines), lines)
+	}
+
+	for i, line := range lines {
+		parts := strings.Split(line, "\t")
+		if len(parts) != 2 {
+			t.Fatalf("Expected '<relpath>\\t<hash>', got %q", line)
+		}
+		if parts[0] != expectedPaths[i] {
+			t.Errorf("Line %d: expected path %s, got %s", i, expectedPaths[i], parts[0])
+		}
+		if len(parts[1]) != 64 {
+			t.Errorf("Line %d: expected a SHA256 hash, got %s", i, parts[1])
+		}
+	}
+}
+
+// Test cases for reporting sets whose directories are missing
+func TestAllRootsMissing(t *testing.T) {
+	existing := createTempDir(t, map[string]string{"file.txt": "content"})
+	empty := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "typo")
+
+	tests := []struct {
+		name        string
+		dirs        []string
+		wantMissing bool
+	}{
+		{name: "all roots missing", dirs: []string{missing}, wantMissing: true},
+		{name: "genuinely empty", dirs: []string{empty}, wantMissing: false},
+		{name: "some roots missing", dirs: []string{existing, missing}, wantMissing: false},
+		{name: "empty and missing", dirs: []string{empty, missing}, wantMissing: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fileSet *FileSet
+			captureOutput(t, func() {
+				var err error
+				fileSet, err = walkDirectories(tt.dirs)
+				if err != nil {
+					t.Errorf("walkDirectories failed: %v", err)
+				}
+			})
+
+			if got := allRootsMissing(fileSet); got != tt.wantMissing {
+				t.Errorf("allRootsMissing() = %v, want %v (missing roots: %v)", got, tt.wantMissing, fileSet.MissingRoots)
+			}
+		})
+	}
+}
+
+func TestReportMissingSets(t *testing.T) {
+	present := &FileSet{Files: []*FileInfo{{Name: "a.txt"}}, Roots: []string{"/present"}}
+	missing := &FileSet{Roots: []string{"/typo"}, MissingRoots: []string{"/typo"}}
+	empty := &FileSet{Roots: []string{"/empty"}}
+
+	var isMissing bool
+	output := captureOutput(t, func() {
+		isMissing = reportMissingSets(missing, present)
+	})
+	if !isMissing {
+		t.Error("Expected a missing set to be reported")
+	}
+	if !strings.Contains(output, "Set 1 has no files because none of its directories exist: /typo") {
+		t.Errorf("Expected a prominent warning naming the missing directory, got: %s", output)
+	}
+
+	output = captureOutput(t, func() {
+		isMissing = reportMissingSets(present, empty)
+	})
+	if isMissing {
+		t.Error("An existing but empty set should not count as missing")
+	}
+	if !strings.Contains(output, "Set 2 directories exist but contain no files") {
+		t.Errorf("Expected a note about the empty set, got: %s", output)
+	}
+}
+
+// Test cases for ranking directories by differences
+func TestRankDirectoriesByDifferences(t *testing.T) {
+	files := []*FileInfo{
+		{RelativePath: filepath.Join("photos", "a.jpg"), Name: "a.jpg", Size: 100},
+		{RelativePath: filepath.Join("photos", "b.jpg"), Name: "b.jpg", Size: 100},
+		{RelativePath: filepath.Join("photos", "c.jpg"), Name: "c.jpg", Size: 100},
+		{RelativePath: filepath.Join("docs", "big.pdf"), Name: "big.pdf", Size: 5000},
+		{RelativePath: filepath.Join("docs", "small.txt"), Name: "small.txt", Size: 10},
+		{RelativePath: filepath.Join("music", "x.mp3"), Name: "x.mp3", Size: 300},
+		{RelativePath: filepath.Join("music", "y.mp3"), Name: "y.mp3", Size: 300},
+		{RelativePath: "root.txt", Name: "root.txt", Size: 1},
+	}
+
+	stats := rankDirectoriesByDifferences(files, 3)
+	expected := []struct {
+		dir   string
+		count int
+	}{
+		{"photos", 3},
+		{"docs", 2}, // Ties with music on count but has more bytes
+		{"music", 2},
+	}
+
+	if len(stats) != len(expected) {
+		t.Fatalf("Expected %d directories, got %d: %v", len(expected), len(stats), stats)
+	}
+	for i, want := range expected {
+		if stats[i].Dir != want.dir || stats[i].FileCount != want.count {
+			t.Errorf("Rank %d: expected %s with %d files, got %s with %d files",
+				i+1, want.dir, want.count, stats[i].Dir, stats[i].FileCount)
+		}
+	}
+	if stats[1].TotalSize != 5010 {
+		t.Errorf("Expected docs total size 5010, got %d", stats[1].TotalSize)
+	}
+
+	all := rankDirectoriesByDifferences(files, 0)
+	if len(all) != 4 {
+		t.Errorf("Expected every directory including the root without a limit, got %d", len(all))
+	}
+
+	output := captureOutput(t, func() {
+		printTopDirectories(stats)
+	})
+	if !strings.Contains(output, "Top 3 directories") || !strings.Contains(output, "photos"+string(filepath.Separator)+" — 3 files") {
+		t.Errorf("Unexpected top directories output: %s", output)
+	}
+}
+
+func TestCollectDirectoryStatsNested(t *testing.T) {
+	files := []*FileInfo{
+		{RelativePath: filepath.Join("a", "b", "c", "deep.txt"), Name: "deep.txt", Size: 1},
+		{RelativePath: filepath.Join("a", "top.txt"), Name: "top.txt", Size: 2},
+	}
+
+	var stats []DirectoryStats
+	collectDirectoryStats(buildTree(files), ".", &stats)
+
+	found := make(map[string]int)
+	for _, entry := range stats {
+		found[entry.Dir] = entry.FileCount
+	}
+	if found[filepath.Join("a", "b", "c")] != 1 || found["a"] != 1 {
+		t.Errorf("Expected files counted in their own directories, got %v", found)
+	}
+	if _, exists := found[filepath.Join("a", "b")]; exists {
+		t.Error("Directories without direct files should not be listed")
+	}
+}
+
+// Test cases for content-only matching with --ignore-paths
+func TestCompareFileSetsIgnorePaths(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"a/config.json":   "original config",
+		"a/photo.jpg":     "photo bytes",
+		"only1/notes.txt": "set1 notes",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"b/config.json":        "changed config",
+		"reorganized/pic.jpg":  "photo bytes",
+		"only2/notes.txt":      "set2 notes",
+		"only2/brand-new.txt":  "brand new",
+		"elsewhere/notes2.txt": "set1 notes",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	defaultResult := compareFileSets(set1, set2)
+	if len(defaultResult.SameNameDifferentHash) != 2 {
+		t.Errorf("Default mode should flag same-name files as modified, got %d", len(defaultResult.SameNameDifferentHash))
+	}
+
+	result := compareFileSetsWithOptions(set1, set2, CompareOptions{IgnorePaths: true})
+
+	if len(result.SameNameDifferentHash) != 0 {
+		t.Errorf("Content-only mode should not report modified files, got %d", len(result.SameNameDifferentHash))
+	}
+
+	sortFileInfoSlice(result.UniqueToSet2)
+	expected2 := []string{
+		filepath.Join("b", "config.json"),
+		filepath.Join("only2", "brand-new.txt"),
+		filepath.Join("only2", "notes.txt"),
+	}
+	if len(result.UniqueToSet2) != len(expected2) {
+		t.Fatalf("Expected %d files unique to set 2, got %d", len(expected2), len(result.UniqueToSet2))
+	}
+	for i, file := range result.UniqueToSet2 {
+		if file.RelativePath != expected2[i] {
+			t.Errorf("Expected %s, got %s", expected2[i], file.RelativePath)
+		}
+	}
+
+	// Only the original config has no content match anywhere in set 2
+	if len(result.UniqueToSet1) != 1 || result.UniqueToSet1[0].RelativePath != filepath.Join("a", "config.json") {
+		t.Errorf("Expected only a/config.json to be unique to set 1, got %v", result.UniqueToSet1)
+	}
+}
+
+// Test cases for resumable scan checkpoints
+func TestCheckpointResume(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"a.txt":     "alpha",
+		"b.txt":     "bravo",
+		"sub/c.txt": "charlie",
+	})
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+
+	// First run records every hashed file
+	checkpoint, err := openCheckpoint(checkpointPath, false, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint failed: %v", err)
+	}
+	first, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if err := checkpoint.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Resuming loads the recorded hashes
+	resumed, err := openCheckpoint(checkpointPath, true, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint (resume) failed: %v", err)
+	}
+	defer resumed.Close()
+	if resumed.Len() != len(first.Files) {
+		t.Fatalf("Expected %d checkpoint entries, got %d", len(first.Files), resumed.Len())
+	}
+
+	// Unchanged files are served from the checkpoint instead of being rehashed
+	recorded := filepath.Join(tmpDir, "a.txt")
+	info, err := os.Stat(recorded)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	hash, ok := resumed.Lookup(recorded, info)
+	if !ok || hash != "8ed3f6ad685b959ead7022518e1af76cd816f8e8ec7ccdda1ed4018e8f2223f8" {
+		t.Errorf("Expected recorded hash of a.txt, got %q (found=%v)", hash, ok)
+	}
+
+	second, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{Checkpoint: resumed})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions (resume) failed: %v", err)
+	}
+	if len(second.Files) != len(first.Files) {
+		t.Errorf("Expected %d files after resume, got %d", len(first.Files), len(second.Files))
+	}
+}
+
+// TestCheckpointFileLeftOut tests that a scan doesn't hash the checkpoint it is writing, or a default one
+func TestCheckpointFileLeftOut(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"a.txt":                 "alpha",
+		defaultCheckpointPath:   "stale checkpoint",
+		"sub/scan.checkpoint":   "",
+		"other/scan.checkpoint": "same name, not the checkpoint",
+	})
+
+	checkpoint, err := openCheckpoint(filepath.Join(tmpDir, "sub", "scan.checkpoint"), false, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint failed: %v", err)
+	}
+	defer checkpoint.Close()
+
+	fileSet, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if err := expectRelPaths(fileSet.Files, "a.txt", "other/scan.checkpoint"); err != nil {
+		t.Errorf("Scanned files: %v", err)
+	}
+}
+
+// TestCheckpointWriteFailure tests that files are still compared when the checkpoint can't be written
+func TestCheckpointWriteFailure(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to simulate a full disk")
+	}
+	tmpDir := createTempDir(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo"})
+
+	checkpoint, err := openCheckpoint("/dev/full", false, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint failed: %v", err)
+	}
+	fileSet, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{Checkpoint: checkpoint, QuietWarnings: true})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if len(fileSet.Files) != 2 || len(fileSet.Warnings) != 0 {
+		t.Errorf("Expected both files hashed without warnings, got %d files and %v", len(fileSet.Files), fileSet.Warnings)
+	}
+	if err := checkpoint.Close(); err == nil {
+		t.Error("Expected Close to report the failed write")
+	}
+	if err := checkpoint.Close(); err == nil {
+		t.Error("Expected a second Close to report the failed write again")
+	}
+}
+
+func TestCheckpointLookupDetectsChanges(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{"file.txt": "original"})
+	path := filepath.Join(tmpDir, "file.txt")
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+
+	checkpoint, err := openCheckpoint(checkpointPath, false, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint failed: %v", err)
+	}
+	defer checkpoint.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if err := checkpoint.Record(path, info, "recorded-hash"); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	if hash, ok := checkpoint.Lookup(path, info); !ok || hash != "recorded-hash" {
+		t.Errorf("Expected recorded hash for unchanged file, got %q (found=%v)", hash, ok)
+	}
+
+	// Rewriting the file changes its size and mod time, so the entry must not be reused
+	if err := os.WriteFile(path, []byte("rewritten content"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	changed, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if _, ok := checkpoint.Lookup(path, changed); ok {
+		t.Error("Changed file should not be served from the checkpoint")
+	}
+}
+
+func TestCheckpointIgnoresMalformedLines(t *testing.T) {
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+	content := "sha256\tabc\t5\t100\t/some/file\n" +
+		"truncated line\n" +
+		"sha256\tdef\tnot-a-size\t100\t/bad/size\n" +
+		"sha256\tghi\t7\t200\t/path/with\ttab\n" +
+		"git\tmno\t7\t200\t/other/algorithm\n" +
+		"sha256\tjkl\t9"
+	if err := os.WriteFile(checkpointPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	checkpoint, err := openCheckpoint(checkpointPath, true, HashSHA256)
+	if err != nil {
+		t.Fatalf("openCheckpoint failed: %v", err)
+	}
+	defer checkpoint.Close()
+
+	if checkpoint.Len() != 2 {
+		t.Errorf("Expected 2 valid entries, got %d", checkpoint.Len())
+	}
+}
+
+// TestHashFileWithAlgorithm tests git blob hashing and algorithm selection
+func TestHashFileWithAlgorithm(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"empty.txt": "",
+		"hello.txt": "hello world",
+	})
+
+	tests := []struct {
+		name      string
+		file      string
+		algorithm string
+		expected  string
+	}{
+		{"git empty blob", "empty.txt", HashGit, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+		{"git blob", "hello.txt", HashGit, "95d09f2b10159347eece71399a7e2e907ea3df4f"},
+		{"explicit sha256", "hello.txt", HashSHA256, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+		{"default sha256", "hello.txt", "", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := hashFileWithAlgorithm(filepath.Join(tmpDir, tt.file), tt.algorithm)
+			if err != nil {
+				t.Fatalf("hashFileWithAlgorithm failed: %v", err)
+			}
+			if hash != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, hash)
+			}
+		})
+	}
+
+	if _, err := hashFileWithAlgorithm(filepath.Join(tmpDir, "hello.txt"), "crc32"); err == nil {
+		t.Error("Expected error for unsupported algorithm")
+	}
+}
+
+// TestCalculateTransferSize tests the backup delta size of new and changed files
+func TestCalculateTransferSize(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"same.txt":    "unchanged",
+		"changed.txt": "old",
+		"removed.txt": "only in set 1",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"same.txt":    "unchanged",
+		"changed.txt": "new content",
+		"added.txt":   "brand new",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	result := compareFileSets(set1, set2)
+	expected := int64(len("new content") + len("brand new"))
+	if got := calculateTransferSize(result); got != expected {
+		t.Errorf("Expected %d bytes to transfer, got %d", expected, got)
+	}
+
+	if got := calculateTransferSize(&ComparisonResult{}); got != 0 {
+		t.Errorf("Expected 0 bytes for empty result, got %d", got)
+	}
+}
+
+// TestNetContentChange tests counting added and removed content once per distinct hash
+func TestNetContentChange(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"same.txt":        "unchanged",
+		"changed.txt":     "old",
+		"removed.txt":     "only in set 1",
+		"old/removed.txt": "only in set 1",
+		"noise.tmp":       "noise one",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"same.txt":        "unchanged",
+		"moved/same.txt":  "unchanged",
+		"changed.txt":     "new content",
+		"added.txt":       "brand new",
+		"copies/a.txt":    "brand new",
+		"copies/b.txt":    "brand new",
+		"other/noise.tmp": "noise two",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	added, removed := netContentChange(set1, set2, nil)
+	if want := int64(len("new content") + len("brand new") + len("noise two")); added != want {
+		t.Errorf("Expected %d bytes added, got %d", want, added)
+	}
+	if want := int64(len("old") + len("only in set 1") + len("noise one")); removed != want {
+		t.Errorf("Expected %d bytes removed, got %d", want, removed)
+	}
+
+	ignore := map[string]bool{}
+	for _, file := range append(set1.Files, set2.Files...) {
+		if strings.HasPrefix(file.Name, "noise") {
+			ignore[file.Hash] = true
+		}
+	}
+	added, removed = netContentChange(set1, set2, ignore)
+	if want := int64(len("new content") + len("brand new")); added != want {
+		t.Errorf("Expected %d bytes added without blocklisted content, got %d", want, added)
+	}
+	if want := int64(len("old") + len("only in set 1")); removed != want {
+		t.Errorf("Expected %d bytes removed without blocklisted content, got %d", want, removed)
+	}
+
+	// Copies that skipped hashing are hashed before summing, so they still count once
+	skipped, err := walkDirectoriesWithOptions([]string{set1Dir}, -1, ScanOptions{SkipHash: func(FileTask) bool { return true }})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	hashSkippedDuplicates(skipped, ScanOptions{})
+	for _, file := range skipped.Files {
+		unique := file.Name == "changed.txt" // "unchanged" and "noise one" share a size, as do the two removed copies
+		if strings.HasPrefix(file.Hash, unhashedPrefix) != unique {
+			t.Errorf("Expected only files with a size of their own to keep a placeholder, got %s for %s", file.Hash, file.RelativePath)
+		}
+	}
+	_, removed = netContentChange(skipped, set2, nil)
+	if want := int64(len("old") + len("only in set 1") + len("noise one")); removed != want {
+		t.Errorf("Expected %d bytes removed with skipped copies, got %d", want, removed)
+	}
+}
+
+// TestRollUpToDirectories tests rolling differences up to top-level directories
+func TestRollUpToDirectories(t *testing.T) {
+	modified := []*FileInfo{
+		{RelativePath: filepath.Join("src", "api", "handler.go")},
+		{RelativePath: filepath.Join("src", "main.go")},
+		{RelativePath: "README.md"},
+	}
+	uniqueToSet2 := []*FileInfo{
+		{RelativePath: filepath.Join("docs", "guide", "intro.md")},
+		{RelativePath: filepath.Join("src", "new.go")},
+	}
+	uniqueToSet1 := []*FileInfo{
+		{RelativePath: filepath.Join("legacy", "old.go")},
+	}
+
+	changes := rollUpToDirectories(modified, uniqueToSet2, uniqueToSet1)
+
+	expected := []DirectoryChange{
+		{Dir: ".", Modified: 1},
+		{Dir: "docs", UniqueToSet2: 1},
+		{Dir: "legacy", UniqueToSet1: 1},
+		{Dir: "src", Modified: 2, UniqueToSet2: 1},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changed directories, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], changes[i])
+		}
+	}
+
+	output := captureOutput(t, func() {
+		printDirectoryChanges(changes)
+	})
+	if !strings.Contains(output, "src"+string(filepath.Separator)+" — 2 modified, 1 unique to Set 2") {
+		t.Errorf("Expected per-directory counts in output, got:\n%s", output)
+	}
+	if strings.Contains(output, "handler.go") {
+		t.Errorf("Expected no per-file detail in output, got:\n%s", output)
+	}
+}
+
+// TestCalculateBatchSize tests that batch sizes stay within bounds without starving workers
+func TestCalculateBatchSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		taskCount  int
+		numWorkers int
+		expected   int
+	}{
+		{"few files spread over all workers", 100, 6, 17},
+		{"small workload uses minimum batch", 300, 4, 64},
+		{"medium workload aims for 2 batches per worker", 10000, 4, 1250},
+		{"millions of tiny files capped", 5000000, 8, maxBatchSize},
+		{"single file", 1, 8, 1},
+		{"no workers treated as one", 200, 0, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calculateBatchSize(tt.taskCount, tt.numWorkers); got != tt.expected {
+				t.Errorf("calculateBatchSize(%d, %d) = %d, expected %d", tt.taskCount, tt.numWorkers, got, tt.expected)
+			}
+		})
+	}
+
+	// Streaming scans size batches for the files found so far, or for the limit when there is one
+	if got := streamBatchSize(5000000, -1, 8); got != maxBatchSize {
+		t.Errorf("Expected a large streaming scan to reach %d per batch, got %d", maxBatchSize, got)
+	}
+	if got := streamBatchSize(1, -1, 8); got != 1 {
+		t.Errorf("Expected the first file to go out at once, got batches of %d", got)
+	}
+	if got := streamBatchSize(1, 10000, 4); got != 1250 {
+		t.Errorf("Expected a limit to size batches from the start, got %d", got)
+	}
+}
+
+// Benchmark a tree dominated by tiny files, where per-batch overhead outweighs hashing
+func BenchmarkWalkDirectoriesTinyFiles(b *testing.B) {
+	structure := make(map[string]string)
+	for i := 0; i < 5000; i++ {
+		structure[fmt.Sprintf("dir_%d/file_%d.txt", i%50, i)] = fmt.Sprintf("%d", i)
+	}
+	tmpDir := createTempDir(b, structure)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := walkDirectoriesWithLimit([]string{tmpDir}, -1)
+		if err != nil {
+			b.Fatalf("walkDirectoriesWithLimit error: %v", err)
+		}
+	}
+}
+
+// TestFindACLDifferences tests reporting same-content files whose permissions differ
+func TestFindACLDifferences(t *testing.T) {
+	if !aclSupported {
+		t.Skip("ACLs are not supported on this platform")
+	}
+
+	set1Dir := createTempDir(t, map[string]string{
+		"shared.txt":  "same content",
+		"locked.txt":  "same content too",
+		"changed.txt": "old",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"shared.txt":  "same content",
+		"locked.txt":  "same content too",
+		"changed.txt": "new",
+	})
+	if err := os.Chmod(filepath.Join(set1Dir, "locked.txt"), 0o644); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(set2Dir, "locked.txt"), 0o600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	differences, warnings := findACLDifferences(set1, set2)
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+	if len(differences) != 1 {
+		t.Fatalf("Expected 1 ACL difference, got %d: %+v", len(differences), differences)
+	}
+	difference := differences[0]
+	if difference.Set2File.RelativePath != "locked.txt" {
+		t.Errorf("Expected locked.txt, got %s", difference.Set2File.RelativePath)
+	}
+	if difference.Set1ACL != "user::rw-,group::r--,other::r--" || difference.Set2ACL != "user::rw-,group::---,other::---" {
+		t.Errorf("Unexpected ACLs: %q vs %q", difference.Set1ACL, difference.Set2ACL)
+	}
+
+	output := captureOutput(t, func() {
+		printACLDifferences(differences)
+	})
+	if !strings.Contains(output, "same content but different ACLs (1 files)") || !strings.Contains(output, "Set 2: user::rw-,group::---,other::---") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+// TestEstimate tests counting files without hashing and estimating the run time
+func TestEstimate(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"a.txt":     strings.Repeat("a", 1000),
+		"sub/b.txt": strings.Repeat("b", 24),
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"c.txt": strings.Repeat("c", 2048),
+	})
+
+	collection, err := collectFileTasks([]string{set1Dir}, -1, ScanOptions{})
+	if err != nil {
+		t.Fatalf("collectFileTasks failed: %v", err)
+	}
+	if len(collection.Tasks) != 2 || collection.TotalSize != 1024 {
+		t.Errorf("Expected 2 files totaling 1024 bytes, got %d files totaling %d", len(collection.Tasks), collection.TotalSize)
+	}
+
+	throughput, sampled := measureHashThroughput(collection.Tasks, ScanOptions{})
+	if throughput <= 0 || sampled != 2 {
+		t.Errorf("Expected positive throughput over 2 files, got %f over %d", throughput, sampled)
+	}
+
+	tests := []struct {
+		size       int64
+		throughput float64
+		expected   time.Duration
+	}{
+		{100 * 1024 * 1024, 10 * 1024 * 1024, 10 * time.Second},
+		{3600, 1, time.Hour},
+		{1024, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := estimateDuration(tt.size, tt.throughput); got != tt.expected {
+			t.Errorf("estimateDuration(%d, %f) = %v, expected %v", tt.size, tt.throughput, got, tt.expected)
+		}
+	}
+
+	output := captureOutput(t, func() {
+		runEstimate([]string{set1Dir}, []string{set2Dir}, ScanOptions{}, 1024)
+	})
+	for _, expected := range []string{
+		"Set 1: 2 files, 1.00 KB",
+		"Set 2: 1 files, 2.00 KB",
+		"Total to hash: 3 files, 3.00 KB",
+		"(assumed)",
+		"Estimated hashing time: 3s",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+}
+
+// TestSelectPreviewTasks tests that previews sample the same relative paths from both sets
+func TestSelectPreviewTasks(t *testing.T) {
+	makeTasks := func(paths ...string) []FileTask {
+		var tasks []FileTask
+		for _, path := range paths {
+			tasks = append(tasks, FileTask{RelPath: path})
+		}
+		return tasks
+	}
+	relPaths := func(tasks []FileTask) []string {
+		var paths []string
+		for _, task := range tasks {
+			paths = append(paths, task.RelPath)
+		}
+		return paths
+	}
+
+	tasks1 := makeTasks("a.txt", "b.txt", "shared1.txt", "c.txt", "shared2.txt")
+	tasks2 := makeTasks("x.txt", "shared2.txt", "y.txt", "shared1.txt")
+
+	selected1, selected2, matched := selectPreviewTasks(tasks1, tasks2, 3)
+	if matched != 2 {
+		t.Errorf("Expected 2 matched paths, got %d", matched)
+	}
+	if got := strings.Join(relPaths(selected1), ","); got != "shared1.txt,shared2.txt,a.txt" {
+		t.Errorf("Unexpected set 1 sample: %s", got)
+	}
+	if got := strings.Join(relPaths(selected2), ","); got != "shared1.txt,shared2.txt,x.txt" {
+		t.Errorf("Unexpected set 2 sample: %s", got)
+	}
+
+	// A differently ordered tree no longer shows files as unique just because they sort late
+	set1Structure := map[string]string{"zz_shared.txt": "same"}
+	set2Structure := map[string]string{"zz_shared.txt": "same"}
+	for i := 0; i < 5; i++ {
+		set1Structure[fmt.Sprintf("a%d.txt", i)] = fmt.Sprintf("set1 %d", i)
+		set2Structure[fmt.Sprintf("b%d.txt", i)] = fmt.Sprintf("set2 %d", i)
+	}
+	set1Dir := createTempDir(t, set1Structure)
+	set2Dir := createTempDir(t, set2Structure)
+
+	output := captureOutput(t, func() {
+		runPreview([]string{set1Dir}, []string{set2Dir}, 2, false, true, true, true, ScanOptions{}, CompareOptions{})
+	})
+	if !strings.Contains(output, "Sampled 1 paths present in both sets") {
+		t.Errorf("Expected the shared path to be sampled, got:\n%s", output)
+	}
+	if strings.Contains(output, "zz_shared.txt") {
+		t.Errorf("Expected zz_shared.txt to match rather than appear as unique, got:\n%s", output)
+	}
+}
+
+// TestGroupFilesByRoot tests splitting unique files into one tree per root directory
+func TestGroupFilesByRoot(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"docs/readme.txt": "shared",
+	})
+	rootA := createTempDir(t, map[string]string{
+		"docs/readme.txt": "shared",
+		"docs/a-only.txt": "from root a",
+	})
+	rootB := createTempDir(t, map[string]string{
+		"docs/b-only.txt": "from root b",
+		"b2.txt":          "also from root b",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{rootB, rootA})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	result := compareFileSets(set1, set2)
+
+	groups := groupFilesByRoot(result.UniqueToSet2, set2.Roots)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 root groups, got %d", len(groups))
+	}
+	if groups[0].Root != rootB || len(groups[0].Files) != 2 {
+		t.Errorf("Expected first group to be %s with 2 files, got %s with %d", rootB, groups[0].Root, len(groups[0].Files))
+	}
+	if groups[1].Root != rootA || len(groups[1].Files) != 1 {
+		t.Errorf("Expected second group to be %s with 1 file, got %s with %d", rootA, groups[1].Root, len(groups[1].Files))
+	}
+
+	output := captureOutput(t, func() {
+		printTreeByRoot(result.UniqueToSet2, set2, set1, TreeDisplayOptions{}, false)
+	})
+	indexA := strings.Index(output, "📂 "+rootA+" (1 files):")
+	indexB := strings.Index(output, "📂 "+rootB+" (2 files):")
+	if indexA < 0 || indexB < 0 || indexB > indexA {
+		t.Fatalf("Expected labeled trees for %s then %s, got:\n%s", rootB, rootA, output)
+	}
+	if !strings.Contains(output[indexA:], "a-only.txt") || strings.Contains(output[indexA:], "b-only.txt") {
+		t.Errorf("Expected root a's tree to hold only its own files, got:\n%s", output)
+	}
+}
+
+// TestRunSelfTest tests that the built-in self test passes on this platform
+func TestRunSelfTest(t *testing.T) {
+	var passed bool
+	output := captureOutput(t, func() {
+		passed = runSelfTest()
+	})
+	if !passed {
+		t.Fatalf("Expected self test to pass, got:\n%s", output)
+	}
+	if strings.Contains(output, "FAIL") || !strings.Contains(output, "✅ PASS (") {
+		t.Errorf("Unexpected self test output:\n%s", output)
+	}
+}
+
+// TestExpectRelPaths tests the self test's path assertion helper
+func TestExpectRelPaths(t *testing.T) {
+	files := []*FileInfo{
+		{RelativePath: filepath.Join("b", "two.txt")},
+		{RelativePath: "one.txt"},
+	}
+	if err := expectRelPaths(files, "one.txt", "b/two.txt"); err != nil {
+		t.Errorf("Expected paths to match: %v", err)
+	}
+	if err := expectRelPaths(files, "one.txt"); err == nil {
+		t.Error("Expected mismatch error for missing path")
+	}
+}
+
+// TestHashFileBuffered tests that the read buffer size does not change the hash
+func TestHashFileBuffered(t *testing.T) {
+	content := strings.Repeat("0123456789abcdef", 10000) // 160KB, several reads at any buffer size
+	tmpDir := createTempDir(t, map[string]string{"data.bin": content})
+	path := filepath.Join(tmpDir, "data.bin")
+
+	expected := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	for _, size := range []int{0, 1, 4096, 1024 * 1024} {
+		for _, algorithm := range []string{HashSHA256, HashGit} {
+			want := expected
+			if algorithm == HashGit {
+				want, _ = hashFileWithAlgorithm(path, HashGit)
+			}
+			got, err := hashFileBuffered(path, algorithm, newHashBuffer(size))
+			if err != nil {
+				t.Fatalf("hashFileBuffered(%d, %s) failed: %v", size, algorithm, err)
+			}
+			if got != want {
+				t.Errorf("hashFileBuffered with %d-byte buffer (%s) = %s, expected %s", size, algorithm, got, want)
+			}
+		}
+	}
+
+	if newHashBuffer(0) != nil {
+		t.Error("Expected nil buffer for size 0")
+	}
+
+	set, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{BufferSize: 8192})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if len(set.Files) != 1 || set.Files[0].Hash != expected {
+		t.Errorf("Expected scan with custom buffer to hash to %s", expected)
+	}
+}
+
+// Benchmark hashing a large file with different read buffer sizes
+func BenchmarkHashFileBufferSize(b *testing.B) {
+	const fileSize = 64 * 1024 * 1024
+	tmpDir := b.TempDir()
+	path := filepath.Join(tmpDir, "large.bin")
+	if err := os.WriteFile(path, make([]byte, fileSize), 0o600); err != nil {
+		b.Fatalf("WriteFile failed: %v", err)
+	}
+
+	for _, size := range []int{32 * 1024, 256 * 1024, 1024 * 1024, 4 * 1024 * 1024} {
+		b.Run(formatSize(int64(size)), func(b *testing.B) {
+			buf := newHashBuffer(size)
+			b.SetBytes(fileSize)
+			for i := 0; i < b.N; i++ {
+				if _, err := hashFileBuffered(path, HashSHA256, buf); err != nil {
+					b.Fatalf("hashFileBuffered failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// TestRemoteRoots tests ssh:// sets by running the remote listing script with a local shell
+func TestRemoteRoots(t *testing.T) {
+	tests := []struct {
+		root     string
+		expected RemoteRoot
+		wantErr  bool
+	}{
+		{"ssh://backup@nas.local/srv/backup", RemoteRoot{Target: "backup@nas.local", Path: "/srv/backup"}, false},
+		{"ssh://nas.local:2222/data", RemoteRoot{Target: "nas.local", Port: "2222", Path: "/data"}, false},
+		{"ssh://nas.local", RemoteRoot{}, true},
+		{"ssh:///no/host", RemoteRoot{}, true},
+		{"sftp://backup@nas.local/srv/backup", RemoteRoot{Target: "backup@nas.local", Path: "/srv/backup", SFTP: true}, false},
+		{"ftp://nas.local/srv/backup", RemoteRoot{}, true},
+	}
+	for _, tt := range tests {
+		remote, err := parseRemoteRoot(tt.root)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRemoteRoot(%q) error = %v, wantErr %v", tt.root, err, tt.wantErr)
+			continue
+		}
+		if err == nil && *remote != tt.expected {
+			t.Errorf("parseRemoteRoot(%q) = %+v, expected %+v", tt.root, *remote, tt.expected)
+		}
+	}
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no POSIX shell available to stand in for the remote host")
+	}
+
+	localDir := createTempDir(t, map[string]string{
+		"same.txt":     "same",
+		"docs/old.txt": "old",
+	})
+	remoteDir := createTempDir(t, map[string]string{
+		"same.txt":              "same",
+		"docs/old.txt":          "new",
+		"it's a file\twith.txt": "odd name",
+	})
+
+	// The stand-in host reports one unreadable subdirectory while listing, the way find does, and records
+	// which files it was asked to hash
+	var hashRequests []string
+	original := runRemoteCommand
+	defer func() { runRemoteCommand = original }()
+	runRemoteCommand = func(remote *RemoteRoot, script string, stdin []byte) ([]byte, string, error) {
+		if remote.Path != remoteDir {
+			return nil, "", fmt.Errorf("no such directory")
+		}
+		if strings.Contains(script, "find .") {
+			script += "; echo 'find: ./locked: Permission denied' >&2; exit 1"
+		} else {
+			hashRequests = append(hashRequests, strings.Split(strings.TrimSuffix(string(stdin), "\x00"), "\x00")...)
+		}
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Stdin = bytes.NewReader(stdin)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		return output, stderr.String(), err
+	}
+
+	root := "ssh://backup@nas.local" + remoteDir
+	set1, err := walkDirectories([]string{localDir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{root})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	if len(set2.Files) != 3 {
+		t.Fatalf("Expected 3 remote files, got %d (warnings: %v)", len(set2.Files), set2.Warnings)
+	}
+	if len(set2.Roots) != 1 || set2.Roots[0] != root {
+		t.Errorf("Expected remote root to be recorded, got %v", set2.Roots)
+	}
+	if len(set2.MissingRoots) != 0 || len(set2.Warnings) != 1 || set2.Warnings[0].Reason != WarningPermissionDenied {
+		t.Errorf("Expected the unreadable subdirectory as a warning, not a missing root, got %v and %v", set2.MissingRoots, set2.Warnings)
+	}
+
+	result := compareFileSets(set1, set2)
+	if err := expectRelPaths(result.SameNameDifferentHash, "docs/old.txt"); err != nil {
+		t.Errorf("Modified files: %v", err)
+	}
+	if err := expectRelPaths(result.UniqueToSet2, "it's a file\twith.txt"); err != nil {
+		t.Errorf("Unique to Set 2: %v", err)
+	}
+
+	// Only files passing the filter are hashed on the remote host
+	filter, err := parseFilter("size>4")
+	if err != nil {
+		t.Fatalf("parseFilter failed: %v", err)
+	}
+	hashRequests = nil
+	filtered, err := walkDirectoriesWithOptions([]string{root}, -1, ScanOptions{Filter: filter, QuietWarnings: true})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if err := expectRelPaths(filtered.Files, "it's a file\twith.txt"); err != nil {
+		t.Errorf("Filtered remote files: %v", err)
+	}
+	if len(hashRequests) != 1 || hashRequests[0] != "it's a file\twith.txt" {
+		t.Errorf("Expected only the filtered file to be hashed, got %q", hashRequests)
+	}
+
+	missing, err := walkDirectoriesWithOptions([]string{"ssh://nas.local/does/not/exist"}, -1, ScanOptions{QuietWarnings: true})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if !allRootsMissing(missing) {
+		t.Errorf("Expected unreachable remote root to be reported missing, got %v", missing.MissingRoots)
+	}
+
+	// Hash modes the remote shell can't reproduce skip an ssh:// root rather than mismatch every file
+	for _, opts := range []ScanOptions{{HashAlgorithm: HashMD5}, {IgnoreTrailingNulls: true}, {IgnoreBOM: true}, {HashSkipBytes: 8}, {HashLimitBytes: 8}} {
+		opts.QuietWarnings = true
+		rejected, err := walkDirectoriesWithOptions([]string{root}, -1, opts)
+		if err != nil {
+			t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+		}
+		if len(rejected.Files) != 0 || !allRootsMissing(rejected) {
+			t.Errorf("Expected the remote root to be skipped with %s, got %d files", hashMode(opts), len(rejected.Files))
+		}
+	}
+
+	// A root that can't be entered fails as a whole, unlike find's status after an unreadable subdirectory
+	_, err = exec.Command("sh", "-c", remoteListingScript(filepath.Join(remoteDir, "does-not-exist"))).Output()
+	if !remoteCommandFailed(err) {
+		t.Errorf("Expected a missing remote directory to fail the listing, got %v", err)
+	}
+}
+
+// TestPreflightRoots tests the existence, readability and file count checks of --preflight
+func TestPreflightRoots(t *testing.T) {
+	dir := createTempDir(t, map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "b",
+		"sub/deep/c.go": "c",
+	})
+
+	if files, large, problem := checkRoot(dir, 100); files != 3 || large || problem != "" {
+		t.Errorf("Expected 3 files and no problem, got %d files, large=%v, problem %q", files, large, problem)
+	}
+	if files, large, _ := checkRoot(dir, 2); files != 1 || !large {
+		t.Errorf("Expected counting to stop after a.txt and sub as large, got %d files, large=%v", files, large)
+	}
+	// Directories count toward the limit, so a tree of empty directories is large too
+	emptyDirs := t.TempDir()
+	for i := 0; i < 5; i++ {
+		if err := os.MkdirAll(filepath.Join(emptyDirs, fmt.Sprintf("d%d", i), "inner"), 0o755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+	}
+	if files, large, _ := checkRoot(emptyDirs, 4); files != 0 || !large {
+		t.Errorf("Expected directories alone to reach the limit, got %d files, large=%v", files, large)
+	}
+	if files, _, problem := checkRoot(filepath.Join(dir, "a.txt"), 100); files != 1 || problem != "" {
+		t.Errorf("Expected a file root to count as one readable file, got %d, %q", files, problem)
+	}
+	// Problems leave the path out, since --anonymize only hides the root printed next to them
+	if _, _, problem := checkRoot(filepath.Join(dir, "a.txt", "inner"), 100); problem == "" || strings.Contains(problem, dir) {
+		t.Errorf("Expected a problem without the path, got %q", problem)
+	}
+	if got := pathErrorReason(&fs.PathError{Op: "open", Path: "/secret/client", Err: fs.ErrPermission}); got != "permission denied" {
+		t.Errorf("Expected only the reason, got %q", got)
+	}
+
+	statuses := preflightRoots([]string{dir, "typo"}, []string{"ssh://host/data"}, filepath.Dir(dir))
+	if len(statuses) != 3 {
+		t.Fatalf("Expected 3 statuses, got %d", len(statuses))
+	}
+	if statuses[0].Problem != "" || statuses[1].Problem != "missing" || statuses[1].Root != filepath.Join(filepath.Dir(dir), "typo") {
+		t.Errorf("Unexpected set 1 statuses: %+v", statuses[:2])
+	}
+	if !statuses[2].Remote || statuses[2].Set != 1 {
+		t.Errorf("Expected the remote root to be skipped as set 2, got %+v", statuses[2])
+	}
+
+	var ok bool
+	output := captureOutput(t, func() { ok = printPreflight(statuses, nil) })
+	if ok || !strings.Contains(output, "1 of 3 directories are missing or unreadable") {
+		t.Errorf("Expected the missing root to fail the preflight, got:\n%s", output)
+	}
+}
+
+// TestCommonPathPrefix tests finding the directory shared by all set directories and stripping it
+func TestCommonPathPrefix(t *testing.T) {
+	p := filepath.FromSlash
+	tests := []struct {
+		paths    []string
+		expected string
+	}{
+		{[]string{p("/Volumes/Big/Media/2023"), p("/Volumes/Big/Media/2024/")}, p("/Volumes/Big/Media/")},
+		{[]string{p("/Volumes/Big/Media/a"), p("/Volumes/Big/Media/a/b"), p("/Volumes/Big/Other")}, p("/Volumes/Big/")},
+		{[]string{p("/data/set"), p("/data/set")}, p("/data/")},
+		{[]string{p("/data/a"), p("/srv/b")}, ""},
+		{[]string{p("/data")}, ""},
+		{[]string{p("projects/a"), p("projects/b")}, p("projects/")},
+		{[]string{p("a"), p("b")}, ""},
+	}
+	for _, test := range tests {
+		if prefix := commonPathPrefix(test.paths); prefix != test.expected {
+			t.Errorf("commonPathPrefix(%v) = %q, expected %q", test.paths, prefix, test.expected)
+		}
+	}
+
+	stripped := stripPathPrefixes([]string{p("/Volumes/Big/Media/2023/"), p("/elsewhere")}, p("/Volumes/Big/Media/"))
+	if stripped[0] != "2023" || stripped[1] != p("/elsewhere") {
+		t.Errorf("Unexpected stripped paths %v", stripped)
+	}
+	if stripPathPrefix(p("/data/a"), "") != p("/data/a") {
+		t.Error("Expected an empty prefix to leave paths untouched")
+	}
+}
+
+// TestFlattenSingleChildDirectories tests collapsing chains of single-child directories
+func TestFlattenSingleChildDirectories(t *testing.T) {
+	files := []*FileInfo{
+		{RelativePath: filepath.Join("a", "b", "c", "d", "deep.txt"), Name: "deep.txt"},
+		{RelativePath: filepath.Join("x", "y", "one.txt"), Name: "one.txt"},
+		{RelativePath: filepath.Join("x", "z", "two.txt"), Name: "two.txt"},
+		{RelativePath: filepath.Join("p", "q", "r", "three.txt"), Name: "three.txt"},
+		{RelativePath: filepath.Join("p", "top.txt"), Name: "top.txt"},
+		{RelativePath: "root.txt", Name: "root.txt"},
+	}
+	tree := buildTree(files)
+	flattenSingleChildDirectories(tree)
+
+	chain := tree.Children["a/b/c/d"]
+	if chain == nil || len(chain.Files) != 1 || chain.Files[0].Name != "deep.txt" {
+		t.Fatalf("Expected a/b/c/d to be collapsed into one node holding deep.txt, got children %v", tree.Children)
+	}
+	if chain.Parent != tree {
+		t.Error("Expected collapsed node to keep its parent")
+	}
+
+	// A directory with two subdirectories is a branch point and stays put
+	if tree.Children["x"] == nil || len(tree.Children["x"].Children) != 2 {
+		t.Error("Expected x to remain with two children")
+	}
+
+	// A directory holding a file is not collapsed, but its own single-child chain is
+	p := tree.Children["p"]
+	if p == nil || p.Children["q/r"] == nil {
+		t.Errorf("Expected p to remain and q/r to be collapsed, got %v", p)
+	}
+
+	output := captureOutput(t, func() {
+		printTree(tree, "", true, false, nil)
+	})
+	if !strings.Contains(output, "📁 a/b/c/d/") {
+		t.Errorf("Expected collapsed chain in output, got:\n%s", output)
+	}
+	if strings.Count(output, "\n") != 12 {
+		t.Errorf("Expected 12 lines after flattening, got:\n%s", output)
+	}
+}
+
+// TestPrintTreeWithHashes tests appending short and full hashes to file lines
+func TestPrintTreeWithHashes(t *testing.T) {
+	fullHash := "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	tree := buildTree([]*FileInfo{
+		{RelativePath: filepath.Join("docs", "hello.txt"), Name: "hello.txt", Hash: fullHash, Size: 2048},
+	})
+
+	tests := []struct {
+		name     string
+		opts     TreeDisplayOptions
+		expected string
+		absent   string
+	}{
+		{"hidden by default", TreeDisplayOptions{}, "📄 hello.txt\n", "[b94d"},
+		{"short hash", TreeDisplayOptions{ShowHashes: true}, "📄 hello.txt [b94d27b9934d]\n", fullHash},
+		{"full hash with details", TreeDisplayOptions{ShowDetails: true, ShowHashes: true, FullHashes: true}, "📄 hello.txt (2.00 KB) [" + fullHash + "]\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := captureOutput(t, func() {
+				printTreeWithOptions(tree, "", true, nil, tt.opts)
+			})
+			if !strings.Contains(output, tt.expected) {
+				t.Errorf("Expected %q in output, got:\n%s", tt.expected, output)
+			}
+			if tt.absent != "" && strings.Contains(output, tt.absent) {
+				t.Errorf("Did not expect %q in output, got:\n%s", tt.absent, output)
+			}
+		})
+	}
+
+	if got := formatHashForDisplay("abc", false); got != "abc" {
+		t.Errorf("Expected short hashes to be left alone, got %s", got)
+	}
+}
+
+// TestMatchingNameCandidates tests preferring the same-name file in the same directory
+func TestMatchingNameCandidates(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"a/config.json": "a v1",
+		"b/config.json": "b v1",
+		"c/notes.txt":   "notes v1",
+		"d/notes.txt":   "other notes v1",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"a/config.json": "a v2",
+		"b/config.json": "b v1",
+		"e/notes.txt":   "notes v2",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	result := compareFileSets(set1, set2)
+
+	output := captureOutput(t, func() {
+		printTree(buildTree(result.SameNameDifferentHash), "", true, false, result.NameMappings)
+	})
+
+	// The modified a/config.json maps to a/config.json, not whichever config.json came first
+	expected := "📄 config.json → " + filepath.Join("a", "config.json") + "\n"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %q in output, got:\n%s", expected, output)
+	}
+
+	// e/notes.txt has no counterpart in its own directory, so both candidates are listed
+	expected = "📄 notes.txt → one of: " + filepath.Join("c", "notes.txt") + ", " + filepath.Join("d", "notes.txt") + "\n"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected %q in output, got:\n%s", expected, output)
+	}
+}
+
+// TestManifestRoundTrip tests that comparing exported manifests matches comparing the live directories
+func TestManifestRoundTrip(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"same.txt":        "same",
+		"docs/report.txt": "v1",
+		"old/gone.txt":    "only in set 1",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"same.txt":        "same",
+		"docs/report.txt": "v2",
+		"new/added.txt":   "only in set 2",
+	})
+
+	live1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	live2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	manifestDir := t.TempDir()
+	path1 := filepath.Join(manifestDir, "set1.json")
+	path2 := filepath.Join(manifestDir, "set2.json")
+	if err := writeManifest(path1, live1, ""); err != nil {
+		t.Fatalf("writeManifest failed: %v", err)
+	}
+	if err := writeManifest(path2, live2, HashSHA256); err != nil {
+		t.Fatalf("writeManifest failed: %v", err)
+	}
+
+	loaded1, manifest1, err := loadManifest(path1)
+	if err != nil {
+		t.Fatalf("loadManifest failed: %v", err)
+	}
+	loaded2, _, err := loadManifest(path2)
+	if err != nil {
+		t.Fatalf("loadManifest failed: %v", err)
+	}
+	if manifestAlgorithm(manifest1) != HashSHA256 || len(manifest1.Roots) != 1 || manifest1.Roots[0] != set1Dir {
+		t.Errorf("Unexpected manifest header: %+v", manifest1)
+	}
+
+	// The manifests alone must be enough once the directories are gone
+	if err := os.RemoveAll(set1Dir); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+
+	result := compareFileSets(loaded1, loaded2)
+	if err := expectRelPaths(result.SameNameDifferentHash, "docs/report.txt"); err != nil {
+		t.Errorf("Modified files: %v", err)
+	}
+	if err := expectRelPaths(result.UniqueToSet2, "new/added.txt"); err != nil {
+		t.Errorf("Unique to Set 2: %v", err)
+	}
+	if err := expectRelPaths(result.UniqueToSet1, "old/gone.txt"); err != nil {
+		t.Errorf("Unique to Set 1: %v", err)
+	}
+	for _, file := range loaded2.Files {
+		if file.RelativePath == "same.txt" && (file.Size != 4 || file.ModTime.IsZero() || file.RootDir != set2Dir) {
+			t.Errorf("Expected file metadata to survive the round trip, got %+v", file)
+		}
+	}
+}
+
+// TestLoadManifestErrors tests rejecting malformed and unsupported manifests
+func TestLoadManifestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"not JSON", "path\thash\n"},
+		{"newer version", `{"version": 99, "files": []}`},
+		{"entry without hash", `{"version": 1, "files": [{"path": "a.txt"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "manifest.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			if _, _, err := loadManifest(path); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if _, _, err := loadManifest(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing manifest")
+	}
+}
+
+// TestCheckCoverage tests finding live files whose content is in none of several backups
+func TestCheckCoverage(t *testing.T) {
+	liveDir := createTempDir(t, map[string]string{
+		"docs/a.txt":  "in backup 1",
+		"docs/b.txt":  "in backup 2",
+		"both.txt":    "in both backups",
+		"new/c.txt":   "nowhere",
+		"moved/d.txt": "renamed in backup 1",
+	})
+	backup1Dir := createTempDir(t, map[string]string{
+		"docs/a.txt":   "in backup 1",
+		"both.txt":     "in both backups",
+		"old/name.txt": "renamed in backup 1",
+	})
+	backup2Dir := createTempDir(t, map[string]string{
+		"b.txt":    "in backup 2",
+		"both.txt": "in both backups",
+	})
+
+	var sets []*FileSet
+	for _, dir := range []string{liveDir, backup1Dir, backup2Dir} {
+		fileSet, err := walkDirectories([]string{dir})
+		if err != nil {
+			t.Fatalf("walkDirectories failed: %v", err)
+		}
+		sets = append(sets, fileSet)
+	}
+
+	report := checkCoverage(sets[0], sets[1:])
+	if err := expectRelPaths(report.NotBackedUp, "new/c.txt"); err != nil {
+		t.Errorf("Not backed up: %v", err)
+	}
+	if report.Covered != 4 {
+		t.Errorf("Expected 4 files backed up somewhere, got %d", report.Covered)
+	}
+	if len(report.ByManifest) != 2 || report.ByManifest[0] != 3 || report.ByManifest[1] != 2 {
+		t.Errorf("Expected 3 and 2 files per backup, got %v", report.ByManifest)
+	}
+
+	merged := mergeBackupHashes(sets[1:])
+	if len(merged.HashMap) != 4 {
+		t.Errorf("Expected the 4 distinct backed up contents, got %d", len(merged.HashMap))
+	}
+}
+
+// TestColorBySize tests coloring size annotations by magnitude
+func TestColorBySize(t *testing.T) {
+	tests := []struct {
+		size  int64
+		color string
+	}{
+		{0, ansiGreen},
+		{1024*1024 - 1, ansiGreen},
+		{1024 * 1024, ansiYellow},
+		{100*1024*1024 - 1, ansiYellow},
+		{100 * 1024 * 1024, ansiRed},
+	}
+	for _, tt := range tests {
+		if got := colorBySize("x", tt.size); got != tt.color+"x"+ansiReset {
+			t.Errorf("colorBySize(%d) = %q, expected color %q", tt.size, got, tt.color)
+		}
+	}
+
+	tree := buildTree([]*FileInfo{{RelativePath: "big.iso", Name: "big.iso", Size: 200 * 1024 * 1024}})
+	colored := captureOutput(t, func() {
+		printTreeWithOptions(tree, "", true, nil, TreeDisplayOptions{ShowDetails: true, Color: true})
+	})
+	if !strings.Contains(colored, ansiRed+"(204800.00 KB)"+ansiReset) {
+		t.Errorf("Expected red size annotation, got %q", colored)
+	}
+	plain := captureOutput(t, func() {
+		printTreeWithOptions(tree, "", true, nil, TreeDisplayOptions{ShowDetails: true})
+	})
+	if strings.Contains(plain, "\033[") {
+		t.Errorf("Expected no escapes without color, got %q", plain)
+	}
+
+	// captureOutput redirects stdout to a pipe, which is never a terminal
+	var colorOnPipe bool
+	captureOutput(t, func() {
+		colorOnPipe = useColor(false)
+	})
+	if colorOnPipe {
+		t.Error("Expected no color when stdout is not a terminal")
+	}
+	if useColor(true) {
+		t.Error("Expected --no-color to disable color")
+	}
+}
+
+// TestSetLabels tests that --label1/--label2 names replace "Set 1"/"Set 2" in the output
+func TestSetLabels(t *testing.T) {
+	defer func(label1, label2 string) { set1Label, set2Label = label1, label2 }(set1Label, set2Label)
+	set1Label, set2Label = "backup", "live"
+
+	set1Dir := createTempDir(t, map[string]string{"old.txt": "only in backup"})
+	set2Dir := createTempDir(t, map[string]string{"new.txt": "only in live"})
+
+	output := captureOutput(t, func() {
+		runPreview([]string{set1Dir}, []string{set2Dir}, 5, false, true, true, true, ScanOptions{}, CompareOptions{})
+	})
+	for _, expected := range []string{
+		"📂 backup directories: " + set1Dir,
+		"📂 live directories: " + set2Dir,
+		"Files unique to live (1 in sample)",
+		"Files unique to backup (1 in sample)",
+		"Files processed from backup: 1",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "Set 1") || strings.Contains(output, "Set 2") {
+		t.Errorf("Expected no generic set names in output:\n%s", output)
+	}
+
+	output = captureOutput(t, func() {
+		printDirectoryChanges([]DirectoryChange{{Dir: "docs", UniqueToSet1: 2}})
+	})
+	if !strings.Contains(output, "2 unique to backup") {
+		t.Errorf("Expected labeled directory change, got:\n%s", output)
+	}
+
+	if got := setLabel(0) + "/" + setLabel(1); got != "backup/live" {
+		t.Errorf("Expected backup/live, got %s", got)
+	}
+}
+
+// TestSizeIndexSkipsSizeMismatches tests that only same-name files whose size is absent from the other set skip hashing
+func TestSizeIndexSkipsSizeMismatches(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"same.txt":           "unchanged",
+		"grown.txt":          "ol",
+		"resized.txt":        "0123456789",
+		"moved/resized2.txt": "abc",
+		"only1.txt":          "only in set 1",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"same.txt":     "unchanged",
+		"grown.txt":    "much longer now",
+		"resized.txt":  "abcdef",
+		"resized2.txt": "xyz",
+		"only2.txt":    "only in set 2",
+	})
+
+	// Set 1 is always fully hashed; its scan is the index set 2's hashing is checked against
+	full1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	var skipped int64
+	fast2, err := walkDirectoriesWithOptions([]string{set2Dir}, -1, ScanOptions{SkipHash: skipSizeMismatches(indexSetSizes(full1), &skipped)})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+
+	// grown.txt and resized.txt differ in size from set 1; resized2.txt's size exists in set 1
+	if skipped != 2 {
+		t.Errorf("Expected 2 files skipped, got %d", skipped)
+	}
+	for _, file := range fast2.Files {
+		expected := file.Name == "grown.txt" || file.Name == "resized.txt"
+		if strings.HasPrefix(file.Hash, unhashedPrefix) != expected {
+			t.Errorf("Expected skipped=%v for %s", expected, file.RelativePath)
+		}
+	}
+
+	// The fast path must produce the same comparison as hashing everything
+	full2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	relPaths := func(files []*FileInfo) string {
+		var paths []string
+		for _, f := range files {
+			paths = append(paths, f.RelativePath)
+		}
+		sort.Strings(paths)
+		return strings.Join(paths, ",")
+	}
+	fast := compareFileSets(full1, fast2)
+	full := compareFileSets(full1, full2)
+	if relPaths(fast.SameNameDifferentHash) != relPaths(full.SameNameDifferentHash) ||
+		relPaths(fast.UniqueToSet1) != relPaths(full.UniqueToSet1) ||
+		relPaths(fast.UniqueToSet2) != relPaths(full.UniqueToSet2) {
+		t.Errorf("Fast path differs from full hashing:\nfast: %v / %v / %v\nfull: %v / %v / %v",
+			relPaths(fast.SameNameDifferentHash), relPaths(fast.UniqueToSet1), relPaths(fast.UniqueToSet2),
+			relPaths(full.SameNameDifferentHash), relPaths(full.UniqueToSet1), relPaths(full.UniqueToSet2))
+	}
+}
+
+// TestCombinedTree tests that --combined merges both sets into one tagged tree
+func TestCombinedTree(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"docs/readme.txt": "same",
+		"src/main.go":     "old",
+		"src/legacy.go":   "removed",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"docs/readme.txt": "same",
+		"src/main.go":     "new",
+		"src/feature.go":  "added",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	result := compareFileSets(set1, set2)
+
+	output := captureOutput(t, func() {
+		printCombinedTree(set2, result, TreeDisplayOptions{}, false)
+	})
+	for _, expected := range []string{
+		"Combined view of Set 1 and Set 2 (4 files)",
+		"= 📄 readme.txt",
+		"+ 📄 feature.go",
+		"− 📄 legacy.go",
+		"● 📄 main.go",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+
+	// Files within a directory are listed alphabetically regardless of status
+	feature := strings.Index(output, "feature.go")
+	legacy := strings.Index(output, "legacy.go")
+	main := strings.Index(output, "main.go")
+	if !(feature < legacy && legacy < main) {
+		t.Errorf("Expected src files in name order:\n%s", output)
+	}
+}
+
+// BenchmarkPrintTreeLarge measures rendering a large result tree to stdout
+func BenchmarkPrintTreeLarge(b *testing.B) {
+	var files []*FileInfo
+	for dir := 0; dir < 100; dir++ {
+		for file := 0; file < 1000; file++ {
+			files = append(files, &FileInfo{
+				Name:         fmt.Sprintf("file%04d.txt", file),
+				RelativePath: filepath.Join(fmt.Sprintf("dir%03d", dir), fmt.Sprintf("file%04d.txt", file)),
+				Size:         int64(file),
+			})
+		}
+	}
+	tree := buildTree(files)
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatalf("Open %s failed: %v", os.DevNull, err)
+	}
+	defer devNull.Close()
+	oldStdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = oldStdout }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		printTreeWithOptions(tree, "", true, nil, TreeDisplayOptions{ShowDetails: true})
+	}
+}
+
+// TestIgnoreHashes tests that blocklisted content is left out of every difference category
+func TestIgnoreHashes(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"logo.png":   "placeholder",
+		"old.txt":    "only in set 1",
+		"report.txt": "draft",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"images/banner.png": "placeholder",
+		"report.txt":        "final",
+		"new.txt":           "only in set 2",
+	})
+
+	placeholder := fmt.Sprintf("%x", sha256.Sum256([]byte("placeholder")))
+	only1 := fmt.Sprintf("%x", sha256.Sum256([]byte("only in set 1")))
+	blocklistPath := filepath.Join(t.TempDir(), "noise.txt")
+	blocklist := "# known noise\n\n" + placeholder + "  placeholder.png\n" + strings.ToUpper(only1) + "\n"
+	if err := os.WriteFile(blocklistPath, []byte(blocklist), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	ignoreHashes, err := loadHashBlocklist(blocklistPath)
+	if err != nil {
+		t.Fatalf("loadHashBlocklist failed: %v", err)
+	}
+	if len(ignoreHashes) != 2 || !ignoreHashes[placeholder] || !ignoreHashes[only1] {
+		t.Fatalf("Unexpected blocklist: %v", ignoreHashes)
+	}
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	result := compareFileSetsWithOptions(set1, set2, CompareOptions{IgnoreHashes: ignoreHashes})
+	if err := expectRelPaths(result.SameNameDifferentHash, "report.txt"); err != nil {
+		t.Errorf("Modified: %v", err)
+	}
+	if err := expectRelPaths(result.UniqueToSet2, "new.txt"); err != nil {
+		t.Errorf("Unique to set 2: %v", err)
+	}
+	if err := expectRelPaths(result.UniqueToSet1); err != nil {
+		t.Errorf("Unique to set 1: %v", err)
+	}
+	if err := expectRelPaths(result.IgnoredByHash, "images/banner.png", "logo.png", "old.txt"); err != nil {
+		t.Errorf("Ignored: %v", err)
+	}
+
+	if _, err := loadHashBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected error for missing blocklist")
+	}
+}
+
+// TestScanSetsInParallel tests that scanning both sets concurrently gives the same sets as scanning them in turn
+func TestScanSetsInParallel(t *testing.T) {
+	files1 := make(map[string]string)
+	files2 := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		files1[fmt.Sprintf("dir%d/file%d.txt", i%5, i)] = fmt.Sprintf("set 1 content %d", i)
+		files2[fmt.Sprintf("dir%d/file%d.txt", i%5, i)] = fmt.Sprintf("set 2 content %d", i%10)
+	}
+	set1Dir := createTempDir(t, files1)
+	set2Dir := createTempDir(t, files2)
+
+	set1, set2, err1, err2 := scanSetsInParallel([]string{set1Dir}, []string{set2Dir}, ScanOptions{}, ScanOptions{})
+	if err1 != nil || err2 != nil {
+		t.Fatalf("scanSetsInParallel failed: %v, %v", err1, err2)
+	}
+
+	for i, pair := range []struct {
+		dir string
+		set *FileSet
+	}{{set1Dir, set1}, {set2Dir, set2}} {
+		expected, err := walkDirectories([]string{pair.dir})
+		if err != nil {
+			t.Fatalf("walkDirectories failed: %v", err)
+		}
+		if len(pair.set.Files) != len(expected.Files) || len(pair.set.HashMap) != len(expected.HashMap) {
+			t.Errorf("Set %d: expected %d files with %d hashes, got %d files with %d hashes",
+				i+1, len(expected.Files), len(expected.HashMap), len(pair.set.Files), len(pair.set.HashMap))
+		}
+	}
+}
+
+// TestStreamingScanMatchesCollectedScan tests that hashing files while walking finds the same files and hashes
+// as collecting every task first, including when a limit stops the walk part way
+func TestStreamingScanMatchesCollectedScan(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 3*minBatchSize+7; i++ {
+		files[fmt.Sprintf("dir%d/file%d.txt", i%7, i)] = fmt.Sprintf("content %d", i%40)
+	}
+	dir := createTempDir(t, files)
+
+	for _, limit := range []int{-1, minBatchSize + 3} {
+		streamed, err := streamFilesInParallel([]string{dir}, limit, ScanOptions{HideProgress: true})
+		if err != nil {
+			t.Fatalf("streamFilesInParallel failed: %v", err)
+		}
+		collection, err := collectFileTasks([]string{dir}, limit, ScanOptions{})
+		if err != nil {
+			t.Fatalf("collectFileTasks failed: %v", err)
+		}
+		collected, err := hashTaskCollection(collection, collection.Tasks, ScanOptions{HideProgress: true})
+		if err != nil {
+			t.Fatalf("hashTaskCollection failed: %v", err)
+		}
+
+		hashes := func(fileSet *FileSet) map[string]string {
+			byPath := make(map[string]string)
+			for _, file := range fileSet.Files {
+				byPath[file.RelativePath] = file.Hash
+			}
+			return byPath
+		}
+		streamedHashes, collectedHashes := hashes(streamed), hashes(collected)
+		if len(streamedHashes) != len(collectedHashes) {
+			t.Fatalf("Limit %d: streamed %d files, collected %d", limit, len(streamedHashes), len(collectedHashes))
+		}
+		for path, hash := range collectedHashes {
+			if streamedHashes[path] != hash {
+				t.Errorf("Limit %d: %s streamed as %q, collected as %q", limit, path, streamedHashes[path], hash)
+			}
+		}
+		if len(streamed.Roots) != 1 || streamed.Roots[0] != dir {
+			t.Errorf("Limit %d: expected roots [%s], got %v", limit, dir, streamed.Roots)
+		}
+	}
+}
+
+// TestCanceledScanIsPartial tests that a scan whose context is canceled stops without warnings and is marked partial
+func TestCanceledScanIsPartial(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 30; i++ {
+		files[fmt.Sprintf("file%d.txt", i)] = fmt.Sprintf("content %d", i)
+	}
+	dir := createTempDir(t, files)
+
+	complete, err := walkDirectoriesWithOptions([]string{dir}, -1, ScanOptions{Context: context.Background()})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if complete.Partial || len(complete.Files) != 30 {
+		t.Errorf("Expected a complete scan of 30 files, got %d files (partial=%v)", len(complete.Files), complete.Partial)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stopped, err := walkDirectoriesWithOptions([]string{dir}, -1, ScanOptions{Context: ctx})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if !stopped.Partial || len(stopped.Files) != 0 || len(stopped.Warnings) != 0 {
+		t.Errorf("Expected an empty partial scan without warnings, got %d files, %v (partial=%v)", len(stopped.Files), stopped.Warnings, stopped.Partial)
+	}
+
+	// A file being read when the scan stops isn't hashed to the end
+	if _, err := hashFileContent(filepath.Join(dir, "file0.txt"), ScanOptions{Context: ctx}, nil); !errors.Is(err, errScanStopped) {
+		t.Errorf("Expected errScanStopped, got %v", err)
+	}
+}
+
+// TestMemoryMonitor tests that the peak heap covers memory that was freed before Stop
+func TestMemoryMonitor(t *testing.T) {
+	monitor := startMemoryMonitor(time.Millisecond)
+
+	block := make([]byte, 64*1024*1024)
+	for i := range block {
+		block[i] = byte(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	runtime.KeepAlive(block)
+	block = nil
+	runtime.GC()
+
+	report := monitor.Stop()
+	if report.PeakHeapAlloc < 64*1024*1024 {
+		t.Errorf("Expected a peak heap of at least 64MB, got %s", formatSize(int64(report.PeakHeapAlloc)))
+	}
+	if report.TotalAlloc < report.PeakHeapAlloc || report.Sys == 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+}
+
+// TestIgnoreTrailingNulls tests that trailing null padding only affects hashes when it isn't ignored
+func TestIgnoreTrailingNulls(t *testing.T) {
+	content := strings.Repeat("disk image data\n", 10000)
+	tmpDir := createTempDir(t, map[string]string{
+		"original.bin": content,
+		"padded.bin":   content + strings.Repeat("\x00", 3*trailingNullScanSize+17),
+		"inner.bin":    "a\x00\x00b",
+		"inner2.bin":   "a\x00\x00b\x00",
+		"zeros.bin":    strings.Repeat("\x00", 100),
+		"empty.bin":    "",
+	})
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+
+	for _, algorithm := range []string{HashSHA256, HashGit} {
+		ignore := ScanOptions{HashAlgorithm: algorithm, IgnoreTrailingNulls: true}
+		hash := func(name string, opts ScanOptions) string {
+			h, err := hashFileContent(path(name), opts, nil)
+			if err != nil {
+				t.Fatalf("hashFileContent(%s) failed: %v", name, err)
+			}
+			return h
+		}
+
+		if hash("original.bin", ignore) != hash("padded.bin", ignore) {
+			t.Errorf("%s: expected padded file to match the original when ignoring trailing nulls", algorithm)
+		}
+		if hash("original.bin", ignore) != hash("original.bin", ScanOptions{HashAlgorithm: algorithm}) {
+			t.Errorf("%s: expected unpadded file's hash to be unchanged", algorithm)
+		}
+		if hash("original.bin", ScanOptions{HashAlgorithm: algorithm}) == hash("padded.bin", ScanOptions{HashAlgorithm: algorithm}) {
+			t.Errorf("%s: expected padding to matter by default", algorithm)
+		}
+		if hash("inner.bin", ignore) != hash("inner2.bin", ignore) {
+			t.Errorf("%s: expected only trailing nulls to be dropped", algorithm)
+		}
+		if hash("zeros.bin", ignore) != hash("empty.bin", ignore) {
+			t.Errorf("%s: expected an all-null file to hash like an empty one", algorithm)
+		}
+	}
+
+	if hashMode(ScanOptions{}) == hashMode(ScanOptions{IgnoreTrailingNulls: true}) {
+		t.Error("Expected --ignore-trailing-nulls to change the hash mode")
+	}
+}
+
+// TestIgnoreBOM tests that a leading byte-order mark only affects hashes when it isn't ignored, and that
+// the files it kept from being reported as modified are found
+func TestIgnoreBOM(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"notes.txt":   "\xEF\xBB\xBFhello\n",
+		"utf16.csv":   "\xFF\xFEh\x00i\x00",
+		"same.txt":    "\xEF\xBB\xBFunchanged\n",
+		"data.bin":    "\xEF\xBB\xBFxyz",
+		"changed.txt": "\xEF\xBB\xBFold\n",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"notes.txt":   "hello\n",
+		"utf16.csv":   "h\x00i\x00",
+		"same.txt":    "\xEF\xBB\xBFunchanged\n",
+		"data.bin":    "xyz",
+		"changed.txt": "new\n",
+	})
+
+	for _, algorithm := range []string{HashSHA256, HashGit} {
+		ignore := ScanOptions{HashAlgorithm: algorithm, IgnoreBOM: true}
+		hash := func(dir, name string, opts ScanOptions) string {
+			h, err := hashFileContent(filepath.Join(dir, name), opts, nil)
+			if err != nil {
+				t.Fatalf("hashFileContent(%s) failed: %v", name, err)
+			}
+			return h
+		}
+
+		for _, name := range []string{"notes.txt", "utf16.csv"} {
+			if hash(set1Dir, name, ignore) != hash(set2Dir, name, ignore) {
+				t.Errorf("%s: expected %s to match when ignoring the BOM", algorithm, name)
+			}
+			if hash(set1Dir, name, ScanOptions{HashAlgorithm: algorithm}) == hash(set2Dir, name, ScanOptions{HashAlgorithm: algorithm}) {
+				t.Errorf("%s: expected the BOM of %s to matter by default", algorithm, name)
+			}
+		}
+		if hash(set2Dir, "notes.txt", ignore) != hash(set2Dir, "notes.txt", ScanOptions{HashAlgorithm: algorithm}) {
+			t.Errorf("%s: expected a file without a BOM to hash as usual", algorithm)
+		}
+		if hash(set1Dir, "data.bin", ignore) == hash(set2Dir, "data.bin", ignore) {
+			t.Errorf("%s: expected non-text files to keep their leading bytes", algorithm)
+		}
+	}
+
+	opts := ScanOptions{IgnoreBOM: true}
+	set1, err := walkDirectoriesWithOptions([]string{set1Dir}, -1, opts)
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	set2, err := walkDirectoriesWithOptions([]string{set2Dir}, -1, opts)
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	differences, warnings := findBOMDifferences(set1, set2)
+	if len(warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+	if len(differences) != 2 ||
+		differences[0].Set2File.RelativePath != "notes.txt" || differences[0].Set1BOM != "UTF-8" || differences[0].Set2BOM != "" ||
+		differences[1].Set2File.RelativePath != "utf16.csv" || differences[1].Set1BOM != "UTF-16LE" {
+		t.Errorf("Expected notes.txt and utf16.csv, got %+v", differences)
+	}
+
+	mode := hashMode(ScanOptions{IgnoreBOM: true, IgnoreTrailingNulls: true})
+	var applied ScanOptions
+	if err := applyHashMode(&applied, mode); err != nil || !applied.IgnoreBOM || !applied.IgnoreTrailingNulls {
+		t.Errorf("Expected %q to round-trip, got %+v (%v)", mode, applied, err)
+	}
+}
+
+// TestHashRegion tests that --hash-skip-bytes and --hash-limit-bytes restrict the hash to a region of each file
+func TestHashRegion(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{
+		"a.log":    "2024-01-01|stable body|tail A",
+		"b.log":    "2025-06-30|stable body|tail B",
+		"c.log":    "2025-06-30|other body|tail A",
+		"short1":   "abc",
+		"short2":   "xyz",
+		"body.txt": "stable body",
+	})
+	hash := func(name string, opts ScanOptions) string {
+		h, err := hashFileContent(filepath.Join(tmpDir, name), opts, nil)
+		if err != nil {
+			t.Fatalf("hashFileContent(%s) failed: %v", name, err)
+		}
+		return h
+	}
+
+	skip := ScanOptions{HashSkipBytes: 11}
+	region := ScanOptions{HashSkipBytes: 11, HashLimitBytes: 11}
+	if hash("a.log", skip) == hash("b.log", skip) {
+		t.Error("Expected different tails to matter with only --hash-skip-bytes")
+	}
+	if hash("a.log", region) != hash("b.log", region) {
+		t.Error("Expected files with the same region to match")
+	}
+	if hash("a.log", region) == hash("c.log", region) {
+		t.Error("Expected a different region to matter")
+	}
+	if hash("a.log", region) != hash("body.txt", ScanOptions{}) {
+		t.Error("Expected the region to hash like a file holding just that region")
+	}
+	if hash("short1", skip) != hash("short2", skip) {
+		t.Error("Expected files no longer than the skipped bytes to hash as empty")
+	}
+	for _, algorithm := range []string{HashGit, HashMD5} {
+		regionWith := ScanOptions{HashAlgorithm: algorithm, HashSkipBytes: 11, HashLimitBytes: 11}
+		if hash("a.log", regionWith) != hash("body.txt", ScanOptions{HashAlgorithm: algorithm}) {
+			t.Errorf("%s: expected the region to hash like a file holding just that region", algorithm)
+		}
+	}
+
+	mode := hashMode(region)
+	if mode != "sha256+skip-bytes=11+limit-bytes=11" {
+		t.Errorf("Unexpected hash mode %q", mode)
+	}
+	var applied ScanOptions
+	if err := applyHashMode(&applied, mode); err != nil || applied.HashSkipBytes != 11 || applied.HashLimitBytes != 11 {
+		t.Errorf("Expected %q to round-trip, got %+v (%v)", mode, applied, err)
+	}
+	if err := applyHashMode(&applied, "sha256+skip-bytes=-1"); err == nil {
+		t.Error("Expected a negative skip to be rejected")
+	}
+}
+
+// TestIdenticalCountsByDirectory tests per-directory counts of files present and identical in set 2
+func TestIdenticalCountsByDirectory(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"photos/2023/a.jpg": "a",
+		"photos/2023/b.jpg": "b",
+		"photos/2024/c.jpg": "c",
+		"photos/2024/d.jpg": "d",
+		"notes.txt":         "notes",
+		"cache/thumb.db":    "noise",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"photos/2023/a.jpg": "a",
+		"renamed/b.jpg":     "b",
+		"photos/2024/c.jpg": "c",
+		"photos/2024/d.jpg": "changed",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	noise := fmt.Sprintf("%x", sha256.Sum256([]byte("noise")))
+	result := compareFileSetsWithOptions(set1, set2, CompareOptions{IgnoreHashes: map[string]bool{noise: true}})
+
+	expected := []DirectoryCoverage{
+		{Dir: ".", Identical: 0, Total: 1},
+		{Dir: filepath.Join("photos", "2023"), Identical: 2, Total: 2},
+		{Dir: filepath.Join("photos", "2024"), Identical: 1, Total: 2},
+	}
+	coverage := identicalCountsByDirectory(set1, result)
+	if len(coverage) != len(expected) {
+		t.Fatalf("Expected %d directories, got %+v", len(expected), coverage)
+	}
+	for i := range expected {
+		if coverage[i] != expected[i] {
+			t.Errorf("Directory %d: expected %+v, got %+v", i, expected[i], coverage[i])
+		}
+	}
+
+	output := captureOutput(t, func() { printIdenticalCountsByDirectory(coverage) })
+	if !strings.Contains(output, "✅ "+formatDirForDisplay(filepath.Join("photos", "2023"))+": 2/2 files present and identical in Set 2") {
+		t.Errorf("Expected complete directory line in output:\n%s", output)
+	}
+	if !strings.Contains(output, formatDirForDisplay(filepath.Join("photos", "2024"))+": 1/2 files") {
+		t.Errorf("Expected incomplete directory line in output:\n%s", output)
+	}
+}
+
+// TestArgsWithEnvironmentSets tests the DATACOMPARER_SET1/DATACOMPARER_SET2 default directory pair
+func TestArgsWithEnvironmentSets(t *testing.T) {
+	t.Setenv(envSet1, "/mnt/backup")
+	t.Setenv(envSet2, "/home/user,/srv/data")
+
+	tests := []struct {
+		args     []string
+		expected []string
+		ok       bool
+	}{
+		{[]string{"dir-compare"}, []string{"dir-compare", "/mnt/backup", "/home/user,/srv/data"}, true},
+		{[]string{"dir-compare", "--details", "--show-modified"}, []string{"dir-compare", "/mnt/backup", "/home/user,/srv/data", "--details", "--show-modified"}, true},
+		{[]string{"dir-compare", "/a", "/b"}, []string{"dir-compare", "/a", "/b"}, false},
+		{[]string{"dir-compare", "--compare-manifests", "a.json"}, []string{"dir-compare", "--compare-manifests", "a.json"}, false},
+		{[]string{"dir-compare", "--manifest-in", "a.json"}, []string{"dir-compare", "--manifest-in", "a.json"}, false},
+		{[]string{"dir-compare", "--export-manifest", "a.json"}, []string{"dir-compare", "--export-manifest", "a.json"}, false},
+		{[]string{"dir-compare", "--coverage", "/a"}, []string{"dir-compare", "--coverage", "/a"}, false},
+		{[]string{"dir-compare", "--help"}, []string{"dir-compare", "--help"}, false},
+		{[]string{"dir-compare", "-h"}, []string{"dir-compare", "-h"}, false},
+		{[]string{"dir-compare", "--details", "--help"}, []string{"dir-compare", "--details", "--help"}, false},
+	}
+	for _, tt := range tests {
+		args, ok := argsWithEnvironmentSets(tt.args)
+		if ok != tt.ok || strings.Join(args, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("argsWithEnvironmentSets(%v) = %v, %v; expected %v, %v", tt.args, args, ok, tt.expected, tt.ok)
+		}
+	}
+
+	t.Setenv(envSet2, "")
+	if args, ok := argsWithEnvironmentSets([]string{"dir-compare"}); ok || len(args) != 1 {
+		t.Errorf("Expected no change with only %s set, got %v", envSet1, args)
+	}
+}
+
+// TestManifestHashModeDetection tests that a live scan picks up the hash algorithm of a manifest
+func TestManifestHashModeDetection(t *testing.T) {
+	manifestWith := func(algorithm string, hashes ...string) *Manifest {
+		manifest := &Manifest{HashAlgorithm: algorithm}
+		for i, hash := range hashes {
+			manifest.Files = append(manifest.Files, ManifestFile{Path: fmt.Sprintf("file%d", i), Hash: hash})
+		}
+		return manifest
+	}
+	md5Hash := strings.Repeat("a", 32)
+	gitHash := strings.Repeat("b", 40)
+	sha256Hash := strings.Repeat("c", 64)
+
+	tests := []struct {
+		name     string
+		manifest *Manifest
+		expected string
+	}{
+		{"recorded", manifestWith(HashGit+"+ignore-trailing-nulls", md5Hash), HashGit + "+ignore-trailing-nulls"},
+		{"md5 length", manifestWith("", md5Hash, md5Hash), HashMD5},
+		{"git length", manifestWith("", gitHash), HashGit},
+		{"sha256 length", manifestWith("", sha256Hash), HashSHA256},
+		{"mixed lengths", manifestWith("", md5Hash, sha256Hash), HashSHA256},
+		{"empty", manifestWith(""), HashSHA256},
+	}
+	for _, tt := range tests {
+		if got := manifestAlgorithm(tt.manifest); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+
+	var opts ScanOptions
+	if _, err := useManifestHashMode(&opts, manifestWith("", md5Hash)); err != nil || opts.HashAlgorithm != HashMD5 {
+		t.Errorf("Expected md5 to be picked, got %q (%v)", opts.HashAlgorithm, err)
+	}
+	opts = ScanOptions{}
+	if _, err := useManifestHashMode(&opts, manifestWith(HashSHA256+"+ignore-trailing-nulls")); err != nil || !opts.IgnoreTrailingNulls {
+		t.Errorf("Expected trailing nulls to be ignored to match the manifest (%v)", err)
+	}
+	opts = ScanOptions{HashAlgorithm: HashGit}
+	if _, err := useManifestHashMode(&opts, manifestWith("", md5Hash)); err == nil {
+		t.Error("Expected error when --hash contradicts the manifest")
+	}
+	opts = ScanOptions{}
+	if _, err := useManifestHashMode(&opts, manifestWith("crc32")); err == nil {
+		t.Error("Expected error for a manifest with an unsupported algorithm")
+	}
+
+	// An MD5 listing hashed by another tool matches an md5 scan of the same content
+	tmpDir := createTempDir(t, map[string]string{"hello.txt": "hello world"})
+	hash, err := hashFileWithAlgorithm(filepath.Join(tmpDir, "hello.txt"), HashMD5)
+	if err != nil || hash != "5eb63bbbe01eeed093cb22bb8f5acdc3" {
+		t.Errorf("Expected md5 of hello world, got %s (%v)", hash, err)
+	}
+}
+
+// TestFindLongPaths tests the --max-path-length report
+func TestFindLongPaths(t *testing.T) {
+	files := []*FileInfo{
+		{RelativePath: "short.txt"},
+		{RelativePath: "exactly-10"},
+		{RelativePath: filepath.Join("deep", "nested", "directory", "file.txt")},
+		{RelativePath: "ünïcödé-ñámé.txt"},
+		{RelativePath: "eleven-char"},
+	}
+
+	long := findLongPaths(files, 10)
+	expected := []string{filepath.Join("deep", "nested", "directory", "file.txt"), "ünïcödé-ñámé.txt", "eleven-char"}
+	if len(long) != len(expected) {
+		t.Fatalf("Expected %d long paths, got %d", len(expected), len(long))
+	}
+	for i, path := range expected {
+		if long[i].RelativePath != path {
+			t.Errorf("Position %d: expected %s, got %s", i, path, long[i].RelativePath)
+		}
+	}
+
+	// Multi-byte characters count once
+	if got := findLongPaths(files[3:4], 16); len(got) != 0 {
+		t.Errorf("Expected 16-character Unicode name to fit a limit of 16, got %d", len(got))
+	}
+
+	output := captureOutput(t, func() { printLongPaths(long, 10) })
+	if !strings.Contains(output, "longer than 10 characters (3 files)") || !strings.Contains(output, "  11  eleven-char") {
+		t.Errorf("Unexpected report:\n%s", output)
+	}
+}
+
+// TestCountParity tests per-directory file count comparison
+func TestCountParity(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"top.txt":           "a",
+		"photos/1.jpg":      "1",
+		"photos/2.jpg":      "2",
+		"docs/a.txt":        "a",
+		"docs/old/b.txt":    "b",
+		"only1/c.txt":       "c",
+		"same/changed.txt":  "old",
+		"same/other.txt":    "x",
+		"photos/raw/3.raw":  "3",
+		"photos/raw/4.raw":  "4",
+		"photos/raw/5.raw":  "5",
+		"photos/raw/6.raw":  "6",
+		"photos/raw/7.raw":  "7",
+		"photos/raw/8.raw":  "8",
+		"photos/raw/9.raw":  "9",
+		"photos/raw/10.raw": "10",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"top.txt":          "a",
+		"photos/1.jpg":     "1",
+		"photos/2.jpg":     "2",
+		"photos/new.jpg":   "n",
+		"docs/a.txt":       "a",
+		"docs/old/b.txt":   "b",
+		"only2/d.txt":      "d",
+		"same/changed.txt": "new",
+		"same/other.txt":   "x",
+		"photos/raw/3.raw": "3",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	expected := []CountParity{
+		{Dir: "photos", Set1Count: 2, Set2Count: 3},
+		{Dir: filepath.Join("photos", "raw"), Set1Count: 8, Set2Count: 1},
+	}
+	mismatches := findCountParityMismatches(set1, set2)
+	if len(mismatches) != len(expected) {
+		t.Fatalf("Expected %d mismatches, got %+v", len(expected), mismatches)
+	}
+	for i := range expected {
+		if mismatches[i] != expected[i] {
+			t.Errorf("Mismatch %d: expected %+v, got %+v", i, expected[i], mismatches[i])
+		}
+	}
+
+	output := captureOutput(t, func() { printCountParityMismatches(mismatches) })
+	if !strings.Contains(output, "📁 photos"+string(filepath.Separator)+" — 2 in Set 1, 3 in Set 2") {
+		t.Errorf("Unexpected report:\n%s", output)
+	}
+}
+
+// TestAnonymizer tests that --anonymize placeholders are stable, keep extensions and keep matching intact
+func TestAnonymizer(t *testing.T) {
+	anonymizer := newAnonymizer()
+
+	path := anonymizer.FilePath(filepath.Join("clients", "acme", "contract.pdf"))
+	parts := strings.Split(path, string(filepath.Separator))
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "dir_") || !strings.HasPrefix(parts[2], "file_") || !strings.HasSuffix(parts[2], ".pdf") {
+		t.Errorf("Unexpected anonymized path %s", path)
+	}
+	if strings.Contains(path, "acme") || strings.Contains(path, "contract") {
+		t.Errorf("Expected names to be hidden, got %s", path)
+	}
+	if again := anonymizer.FilePath(filepath.Join("clients", "acme", "contract.pdf")); again != path {
+		t.Errorf("Expected stable placeholders, got %s and %s", path, again)
+	}
+	if got := anonymizer.Path("/srv/clients"); got != "/"+anonymizer.Path("srv")+"/"+parts[0] {
+		t.Errorf("Expected leading separator and shared placeholder, got %s", got)
+	}
+	// A different run uses a different key, so a placeholder can't be confirmed by hashing a guessed name
+	if other := newAnonymizer().Path(filepath.Join("clients", "acme", "contract")); other == anonymizer.Path(filepath.Join("clients", "acme", "contract")) {
+		t.Errorf("Expected placeholders to differ between runs, got %s twice", other)
+	}
+	if got := anonymizer.Label("label", "acme backup"); !strings.HasPrefix(got, "label_") || strings.Contains(got, "acme") {
+		t.Errorf("Expected label to be hidden, got %s", got)
+	}
+	args := anonymizer.Args([]string{"/srv/clients", "/mnt/clients", "--title", "Acme audit", "--label1", "acme backup", "--verbose"})
+	if args[3] != anonymizer.Label("title", "Acme audit") || args[5] != anonymizer.Label("label", "acme backup") || args[6] != "--verbose" {
+		t.Errorf("Expected --title and --label1 values to be hidden, got %v", args)
+	}
+	if got := anonymizer.FilePath(".bashrc"); strings.Contains(got, "bashrc") {
+		t.Errorf("Expected dotfile name to be hidden, got %s", got)
+	}
+	if got := anonymizer.Path("ssh://nas/backup"); !strings.HasPrefix(got, "ssh://dir_") {
+		t.Errorf("Expected ssh:// prefix to be kept, got %s", got)
+	}
+	var none *Anonymizer
+	if got := none.FilePath("/home/me/file.txt"); got != "/home/me/file.txt" {
+		t.Errorf("Expected nil Anonymizer to leave paths alone, got %s", got)
+	}
+
+	// Sets are compared on their real names and anonymized afterwards, as in main, so --anonymize leaves the
+	// comparison unchanged; placeholders alone would no longer pair Resume.txt with resume.txt under --loose-names
+	set1Dir := createTempDir(t, map[string]string{"docs/report.txt": "draft", "old.txt": "old", "Resume.txt": "v1"})
+	set2Dir := createTempDir(t, map[string]string{"docs/report.txt": "final", "new.txt": "new", "resume.txt": "v2"})
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	result := compareFileSetsWithOptions(set1, set2, CompareOptions{LooseNames: true})
+	anonymizer.FileSet(set1)
+	anonymizer.FileSet(set2)
+	if err := expectRelPaths(result.SameNameDifferentHash, filepath.ToSlash(anonymizer.FilePath(filepath.Join("docs", "report.txt"))), anonymizer.FilePath("resume.txt")); err != nil {
+		t.Errorf("Modified: %v", err)
+	}
+	if err := expectRelPaths(result.UniqueToSet2, anonymizer.FilePath("new.txt")); err != nil {
+		t.Errorf("Unique to set 2: %v", err)
+	}
+	if err := expectRelPaths(result.UniqueToSet1, anonymizer.FilePath("old.txt")); err != nil {
+		t.Errorf("Unique to set 1: %v", err)
+	}
+	if set1.Roots[0] == set1Dir || set1.Files[0].AbsolutePath == "" {
+		t.Errorf("Expected roots anonymized and absolute paths kept")
+	}
+
+	mapPath := filepath.Join(t.TempDir(), "map.tsv")
+	if err := anonymizer.WriteMap(mapPath); err != nil {
+		t.Fatalf("WriteMap failed: %v", err)
+	}
+	data, err := os.ReadFile(mapPath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.Contains(string(data), anonymizer.FilePath("new.txt")+"\tnew.txt\n") {
+		t.Errorf("Expected map entry for new.txt, got:\n%s", data)
+	}
+}
+
+// TestFailOn tests parsing --fail-on and selecting which differences fail the run
+func TestFailOn(t *testing.T) {
+	failOn, err := parseFailOn("modified, unique1")
+	if err != nil {
+		t.Fatalf("parseFailOn failed: %v", err)
+	}
+	if len(failOn) != 2 || !failOn[failOnModified] || !failOn[failOnUnique1] {
+		t.Errorf("Unexpected categories: %v", failOn)
+	}
+	if _, err := parseFailOn("modified,extra"); err == nil {
+		t.Error("Expected error for unknown category")
+	}
+
+	onlyExtra := &ComparisonResult{UniqueToSet2: []*FileInfo{{Name: "extra.txt"}}}
+	if failing := failingCategories(onlyExtra, failOn); len(failing) != 0 {
+		t.Errorf("Expected extra files in set 2 to be accepted, got %v", failing)
+	}
+
+	changed := &ComparisonResult{
+		SameNameDifferentHash: []*FileInfo{{Name: "a.txt"}, {Name: "b.txt"}},
+		UniqueToSet1:          []*FileInfo{{Name: "missing.txt"}},
+		UniqueToSet2:          []*FileInfo{{Name: "extra.txt"}},
+	}
+	failing := failingCategories(changed, failOn)
+	if strings.Join(failing, ", ") != "modified (2), unique1 (1)" {
+		t.Errorf("Unexpected failing categories: %v", failing)
+	}
+}
+
+// TestPresenceColumns tests the two-column listing of every path in both sets
+func TestPresenceColumns(t *testing.T) {
+	set1Dir := createTempDir(t, map[string]string{
+		"photos/img1.jpg": "one",
+		"same.txt":        "same",
+		"changed.txt":     "old",
+	})
+	set2Dir := createTempDir(t, map[string]string{
+		"same.txt":    "same",
+		"changed.txt": "new",
+		"added.txt":   "added",
+	})
+
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	var lines []string
+	for _, row := range buildPresenceRows(set1, set2) {
+		lines = append(lines, formatPresenceRow(row))
+	}
+	expected := []string{
+		"[✗][✓] added.txt",
+		"[≠][≠] changed.txt",
+		"[✓][✗] " + filepath.Join("photos", "img1.jpg"),
+		"[✓][✓] same.txt",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	output := captureOutput(t, func() { printPresenceColumns(buildPresenceRows(set1, set2)) })
+	if !strings.Contains(output, "(4 paths)") || !strings.Contains(output, "[✓][✓] same.txt") {
+		t.Errorf("Unexpected listing:\n%s", output)
+	}
+}
+
+// TestLooseNames tests case- and accent-insensitive name matching
+func TestLooseNames(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		match bool
+	}{
+		{"Résumé.PDF", "resume.pdf", true},
+		{"re\u0301sume\u0301.pdf", "résumé.pdf", true}, // Decomposed (macOS) vs precomposed
+		{"Ærøskøbing.txt", "aeroskobing.TXT", true},
+		{"Straße.doc", "strasse.doc", true},
+		{"resume.pdf", "resume2.pdf", false},
+	}
+	for _, tt := range tests {
+		if got := looseNameKey(tt.a) == looseNameKey(tt.b); got != tt.match {
+			t.Errorf("looseNameKey(%q) == looseNameKey(%q): expected %v", tt.a, tt.b, tt.match)
+		}
+	}
+
+	set1Dir := createTempDir(t, map[string]string{"Résumé.PDF": "version 1", "Notes.txt": "same"})
+	set2Dir := createTempDir(t, map[string]string{"resume.pdf": "version 2", "notes.TXT": "same"})
+	set1, err := walkDirectories([]string{set1Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+	set2, err := walkDirectories([]string{set2Dir})
+	if err != nil {
+		t.Fatalf("walkDirectories failed: %v", err)
+	}
+
+	strict := compareFileSets(set1, set2)
+	if len(strict.SameNameDifferentHash) != 0 || len(strict.UniqueToSet1) != 1 || len(strict.UniqueToSet2) != 1 {
+		t.Errorf("Expected exact names not to match: %d modified, %d/%d unique",
+			len(strict.SameNameDifferentHash), len(strict.UniqueToSet1), len(strict.UniqueToSet2))
+	}
+
+	loose := compareFileSetsWithOptions(set1, set2, CompareOptions{LooseNames: true})
+	if err := expectRelPaths(loose.SameNameDifferentHash, "resume.pdf"); err != nil {
+		t.Errorf("Modified: %v", err)
+	}
+	if len(loose.UniqueToSet1) != 0 || len(loose.UniqueToSet2) != 0 {
+		t.Errorf("Expected no unique files with loose names, got %d/%d", len(loose.UniqueToSet1), len(loose.UniqueToSet2))
+	}
+	if mapped := loose.NameMappings["resume.pdf"]; len(mapped) != 1 || mapped[0].Name != "Résumé.PDF" {
+		t.Errorf("Expected resume.pdf to map to Résumé.PDF, got %v", mapped)
+	}
+}
+
+// TestExecOnFiles tests filling in --exec placeholders and stopping or continuing after failures
+func TestExecOnFiles(t *testing.T) {
+	file := &FileInfo{
+		AbsolutePath: "/data/it's here.txt",
+		RelativePath: "it's here.txt",
+		Hash:         "abc123",
+		Size:         42,
+	}
+	expected := "cp '/data/it'\\''s here.txt' /staging/'it'\\''s here.txt' # abc123 42"
+	if runtime.GOOS == "windows" {
+		expected = `cp "/data/it's here.txt" /staging/"it's here.txt" # abc123 42`
+	}
+	if got := expandExecCommand("cp {path} /staging/{relpath} # {hash} {size}", file); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	defer func(original func(string) error) { runShellCommand = original }(runShellCommand)
+	var mu sync.Mutex
+	var commands []string
+	runShellCommand = func(command string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, command)
+		if strings.Contains(command, "bad") {
+			return fmt.Errorf("exit status 1")
+		}
+		return nil
+	}
+
+	files := []*FileInfo{{RelativePath: "a"}, {RelativePath: "bad"}, {RelativePath: "c"}}
+	ran, failures := runExecOnFiles(files, ExecOptions{Command: "touch {relpath}"})
+	if ran != 2 || len(failures) != 1 || len(commands) != 2 {
+		t.Errorf("Expected to stop after the failure: ran %d, %d failures, commands %v", ran, len(failures), commands)
+	}
+
+	commands = nil
+	ran, failures = runExecOnFiles(files, ExecOptions{Command: "touch {relpath}", Parallel: 2, ContinueOnError: true})
+	if ran != 3 || len(failures) != 1 || len(commands) != 3 {
+		t.Errorf("Expected to continue after the failure: ran %d, %d failures, commands %v", ran, len(failures), commands)
+	}
+}
+
+// TestParseSFTPListLine tests parsing sftp's "ls -lan" lines, with times for recent files and years for old ones
+func TestParseSFTPListLine(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		line     string
+		expected sftpEntry
+		ok       bool
+	}{
+		{"-rw-r--r--    1 1000     1000            3 Jan  2  2020 /backup/a.txt",
+			sftpEntry{name: "a.txt", kind: '-', size: 3, modTime: time.Date(2020, time.January, 2, 0, 0, 0, 0, time.Local)}, true},
+		{"-rw-r--r--    ? 0        0               2 Feb 17 05:40 /backup/docs/two  spaces.txt",
+			sftpEntry{name: "two  spaces.txt", kind: '-', size: 2, modTime: time.Date(2026, time.February, 17, 5, 40, 0, 0, time.Local)}, true},
+		{"drwxr-xr-x    2 0        0            4096 Dec 24 18:00 docs",
+			sftpEntry{name: "docs", kind: 'd', size: 4096, modTime: time.Date(2025, time.December, 24, 18, 0, 0, 0, time.Local)}, true},
+		{`Can't ls: "/backup/nope" not found`, sftpEntry{}, false},
+		{"", sftpEntry{}, false},
+	}
+	for _, tt := range tests {
+		entry, ok := parseSFTPListLine(tt.line, now)
+		if ok != tt.ok || (ok && (entry.name != tt.expected.name || entry.kind != tt.expected.kind || entry.size != tt.expected.size || !entry.modTime.Equal(tt.expected.modTime))) {
+			t.Errorf("parseSFTPListLine(%q) = %+v, %v, expected %+v, %v", tt.line, entry, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+// TestSFTPRoots tests scanning sftp:// roots against a stand-in for the sftp client that answers "ls -lan"
+// and "get -p" batch commands from a local directory the way the real client prints them
+func TestSFTPRoots(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("remote paths in the stand-in are local paths, which need forward slashes")
+	}
+	localDir := createTempDir(t, map[string]string{
+		"same.txt":     "same",
+		"docs/old.txt": "old",
+	})
+	remoteDir := createTempDir(t, map[string]string{
+		"same.txt":          "same",
+		"docs/old.txt":      "new",
+		"odd \"name*\".txt": "odd name",
+	})
+	modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.Local)
+	if err := os.Chtimes(filepath.Join(remoteDir, "same.txt"), modTime, modTime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	unquote := func(s string) string {
+		return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`))
+	}
+	var downloads []string
+	original := runSFTPBatch
+	defer func() { runSFTPBatch = original }()
+	runSFTPBatch = func(remote *RemoteRoot, batch string) ([]byte, string, error) {
+		var stdout, stderr strings.Builder
+		for _, command := range strings.Split(strings.TrimSuffix(batch, "\n"), "\n") {
+			stdout.WriteString(sftpEchoPrefix + command + "\n")
+			switch {
+			case strings.HasPrefix(command, "-ls -lan "):
+				dir := unquote(strings.TrimPrefix(command, "-ls -lan "))
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					fmt.Fprintf(&stderr, "Can't ls: %q not found\n", dir)
+					continue
+				}
+				for _, entry := range entries {
+					info, err := entry.Info()
+					if err != nil {
+						t.Fatalf("Info failed: %v", err)
+					}
+					fmt.Fprintf(&stdout, "%s    ? 0        0        %8d %s %s\n", info.Mode(), info.Size(), info.ModTime().Format("Jan _2  2006"), dir+"/"+entry.Name())
+				}
+			case strings.HasPrefix(command, "-get -p "):
+				remotePath, localPath, _ := strings.Cut(strings.TrimPrefix(command, "-get -p "), `" "`)
+				remotePath, localPath = unquote(remotePath+`"`), unquote(`"`+localPath)
+				downloads = append(downloads, remotePath)
+				data, err := os.ReadFile(remotePath)
+				if err != nil {
+					fmt.Fprintf(&stderr, "File %q not found.\n", remotePath)
+					continue
+				}
+				info, _ := os.Stat(remotePath)
+				if err := os.WriteFile(localPath, data, 0o600); err != nil {
+					t.Fatalf("WriteFile failed: %v", err)
+				}
+				if err := os.Chtimes(localPath, info.ModTime(), info.ModTime()); err != nil {
+					t.Fatalf("Chtimes failed: %v", err)
+				}
+			}
+		}
+		return []byte(stdout.String()), stderr.String(), nil
+	}
+
+	root := "sftp://backup@nas.local" + remoteDir
+	// SFTP files are hashed locally, so hash modes a remote shell couldn't reproduce work too
+	for _, opts := range []ScanOptions{{}, {HashAlgorithm: HashMD5}} {
+		local, err := walkDirectoriesWithOptions([]string{localDir}, -1, opts)
+		if err != nil {
+			t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+		}
+		set2, err := walkDirectoriesWithOptions([]string{root}, -1, opts)
+		if err != nil {
+			t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+		}
+		if len(set2.Files) != 3 || len(set2.Warnings) != 0 {
+			t.Fatalf("%s: expected 3 remote files and no warnings, got %d files (warnings: %v)", hashMode(opts), len(set2.Files), set2.Warnings)
+		}
+		result := compareFileSets(local, set2)
+		if err := expectRelPaths(result.SameNameDifferentHash, "docs/old.txt"); err != nil {
+			t.Errorf("%s: modified files: %v", hashMode(opts), err)
+		}
+		if err := expectRelPaths(result.UniqueToSet2, "odd \"name*\".txt"); err != nil {
+			t.Errorf("%s: unique to Set 2: %v", hashMode(opts), err)
+		}
+		same := set2.NameMap["same.txt"][0]
+		if !same.ModTime.Equal(modTime) || same.Hash != local.NameMap["same.txt"][0].Hash {
+			t.Errorf("%s: expected same.txt's exact time and local hash, got %v and %s", hashMode(opts), same.ModTime, same.Hash)
+		}
+	}
+
+	// Only files passing the filter are downloaded
+	filter, err := parseFilter("size>4")
+	if err != nil {
+		t.Fatalf("parseFilter failed: %v", err)
+	}
+	downloads = nil
+	filtered, err := walkDirectoriesWithOptions([]string{root}, -1, ScanOptions{Filter: filter, QuietWarnings: true})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if err := expectRelPaths(filtered.Files, "odd \"name*\".txt"); err != nil {
+		t.Errorf("Filtered remote files: %v", err)
+	}
+	if len(downloads) != 1 {
+		t.Errorf("Expected only the filtered file to be downloaded, got %q", downloads)
+	}
+
+	missing, err := walkDirectoriesWithOptions([]string{"sftp://nas.local" + filepath.Join(remoteDir, "does-not-exist")}, -1, ScanOptions{QuietWarnings: true})
+	if err != nil {
+		t.Fatalf("walkDirectoriesWithOptions failed: %v", err)
+	}
+	if !allRootsMissing(missing) {
+		t.Errorf("Expected a missing remote directory to be reported missing, got %v", missing.MissingRoots)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestWalkSkipsSpecialFiles tests that FIFOs and devices are skipped instead of hanging the scan
+func TestWalkSkipsSpecialFiles(t *testing.T) {
+	tmpDir := createTempDir(t, map[string]string{"regular.txt": "content"})
+	fifo := filepath.Join(tmpDir, "pipe")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Skipf("cannot create FIFO: %v", err)
+	}
+	if err := os.Symlink(fifo, filepath.Join(tmpDir, "link-to-pipe")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	if err := os.Symlink("regular.txt", filepath.Join(tmpDir, "link-to-regular")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	done := make(chan *FileSet)
+	go func() {
+		fileSet, err := walkDirectoriesWithOptions([]string{tmpDir}, -1, ScanOptions{QuietWarnings: true})
+		if err != nil {
+			t.Errorf("walkDirectoriesWithOptions failed: %v", err)
+		}
+		done <- fileSet
+	}()
+
+	var fileSet *FileSet
+	select {
+	case fileSet = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Scan hung on a FIFO")
+	}
+	if fileSet == nil {
+		return
+	}
+
+	if err := expectRelPaths(fileSet.Files, "link-to-regular", "regular.txt"); err != nil {
+		t.Errorf("Scanned files: %v", err)
+	}
+	if len(fileSet.Warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", fileSet.Warnings)
+	}
+	for _, warning := range fileSet.Warnings {
+		if !strings.HasPrefix(warning.Message, "Skipping named pipe ") || warning.Reason != WarningNotRegular {
+			t.Errorf("Unexpected warning: %s", warning)
+		}
+	}
+
+	if info, err := os.Lstat("/dev/null"); err == nil {
+		if kind := specialFileKind("/dev/null", info); kind != "character device" {
+			t.Errorf("Expected /dev/null to be a character device, got %q", kind)
+		}
+	}
+}